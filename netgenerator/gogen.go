@@ -8,9 +8,9 @@ import (
 
 func WriteGo(messages []Message, messageMap map[string]Message) {
 	gobuf := &bytes.Buffer{}
-	gobuf.WriteString("package messages\n\nimport (\n\t\"encoding/binary\"\n\t\"log\"\n\t\"math\"\n)\n\n")
+	gobuf.WriteString("package messages\n\nimport (\n\t\"encoding/binary\"\n\t\"log\"\n\t\"math\"\n\t\"strconv\"\n)\n\n")
 	// 1. List type values!
-	gobuf.WriteString("type Net interface {\n\tSerialize([]byte)\n\tDeserialize([]byte)\n\tLen() int\n}\n\n")
+	gobuf.WriteString("type Net interface {\n\tSerialize([]byte)\n\tDeserialize([]byte) error\n\tLen() int\n}\n\n")
 	gobuf.WriteString("type MessageType uint16\n\n")
 	gobuf.WriteString("const (\n\tUnknownMsgType MessageType = iota\n\tAckMsgType\n")
 	for _, t := range messages {
@@ -20,7 +20,21 @@ func WriteGo(messages []Message, messageMap map[string]Message) {
 	}
 	gobuf.WriteString(")\n\n")
 
-	// 1.a. Parent parser function
+	// 1.a. Names for printing
+	gobuf.WriteString("func (t MessageType) String() string {\n")
+	gobuf.WriteString("\tswitch t {\n")
+	gobuf.WriteString("\tcase UnknownMsgType:\n\t\treturn \"Unknown\"\n")
+	gobuf.WriteString("\tcase AckMsgType:\n\t\treturn \"Ack\"\n")
+	for _, t := range messages {
+		gobuf.WriteString("\tcase ")
+		gobuf.WriteString(t.Name)
+		gobuf.WriteString("MsgType:\n\t\treturn \"")
+		gobuf.WriteString(t.Name)
+		gobuf.WriteString("\"\n")
+	}
+	gobuf.WriteString("\t}\n\treturn \"MessageType(\" + strconv.Itoa(int(t)) + \")\"\n}\n\n")
+
+	// 1.b. Parent parser function
 	gobuf.WriteString("// ParseNetMessage accepts input of raw bytes from a NetMessage. Parses and returns a Net message.\n")
 	gobuf.WriteString("func ParseNetMessage(packet Packet, content []byte) Net {\n")
 	gobuf.WriteString("\tvar msg Net\n")
@@ -33,7 +47,7 @@ func WriteGo(messages []Message, messageMap map[string]Message) {
 		gobuf.WriteString(t.Name)
 		gobuf.WriteString("{}\n")
 	}
-	gobuf.WriteString("\tdefault:\n\t\tlog.Printf(\"Unknown message type: %d\", packet.Frame.MsgType)\n\t\treturn nil\n\t}\n\tmsg.Deserialize(content)\n\treturn msg\n}\n\n")
+	gobuf.WriteString("\tdefault:\n\t\tlog.Printf(\"Unknown message type: %d\", packet.Frame.MsgType)\n\t\treturn nil\n\t}\n\tif err := msg.Deserialize(content); err != nil {\n\t\treturn nil\n\t}\n\treturn msg\n}\n\n")
 
 	// 2. Generate go classes
 	for _, msg := range messages {
@@ -58,12 +72,12 @@ func WriteGo(messages []Message, messageMap map[string]Message) {
 
 		gobuf.WriteString("func (m *")
 		gobuf.WriteString(msg.Name)
-		gobuf.WriteString(") Deserialize(buffer []byte) {\n\tidx := 0\n")
+		gobuf.WriteString(") Deserialize(buffer []byte) error {\n\tidx := 0\n")
 		for _, f := range msg.Fields {
 			WriteGoDeserial(f, 1, gobuf, messageMap)
 		}
 		// cause im lazy.
-		gobuf.WriteString("\n\t_ = idx\n}\n\n")
+		gobuf.WriteString("\n\t_ = idx\n\treturn nil\n}\n\n")
 
 		gobuf.WriteString("func (m *")
 		gobuf.WriteString(msg.Name)
@@ -292,7 +306,33 @@ func writeNumericDeserialFunc(f MessageField, scopeDepth int, buf *bytes.Buffer)
 	buf.WriteString(")")
 }
 
+// writeLenCheck makes the deserializer return ErrTruncated when fewer than size bytes are left.
+// The current line's indent has already been written.
+func writeLenCheck(size string, scopeDepth int, buf *bytes.Buffer) {
+	writeErrCheck("len(buffer)-idx < "+size, scopeDepth, buf)
+}
+
+func writeErrCheck(cond string, scopeDepth int, buf *bytes.Buffer) {
+	buf.WriteString("if ")
+	buf.WriteString(cond)
+	buf.WriteString(" {\n")
+	for i := 0; i <= scopeDepth; i++ {
+		buf.WriteString("\t")
+	}
+	buf.WriteString("return ErrTruncated\n")
+	for i := 0; i < scopeDepth; i++ {
+		buf.WriteString("\t")
+	}
+	buf.WriteString("}\n")
+	for i := 0; i < scopeDepth; i++ {
+		buf.WriteString("\t")
+	}
+}
+
+// writeArrayLenRead reads the length of a string or array. Every element takes at least a
+// byte, so a length longer than what is left can't be valid and is rejected before allocating.
 func writeArrayLenRead(lname string, scopeDepth int, buf *bytes.Buffer) {
+	writeLenCheck("4", scopeDepth, buf)
 	buf.WriteString(lname)
 	buf.WriteString(" := int(binary.LittleEndian.Uint32(buffer[idx:]))\n")
 	for i := 0; i < scopeDepth; i++ {
@@ -302,6 +342,7 @@ func writeArrayLenRead(lname string, scopeDepth int, buf *bytes.Buffer) {
 	for i := 0; i < scopeDepth; i++ {
 		buf.WriteString("\t")
 	}
+	writeErrCheck(lname+" < 0 || len(buffer)-idx < "+lname, scopeDepth, buf)
 }
 
 func WriteGoDeserial(f MessageField, scopeDepth int, buf *bytes.Buffer, messages map[string]Message) {
@@ -310,6 +351,7 @@ func WriteGoDeserial(f MessageField, scopeDepth int, buf *bytes.Buffer, messages
 	}
 	switch f.Type {
 	case "byte":
+		writeLenCheck("1", scopeDepth, buf)
 		if scopeDepth == 1 {
 			buf.WriteString("m.")
 		}
@@ -317,6 +359,14 @@ func WriteGoDeserial(f MessageField, scopeDepth int, buf *bytes.Buffer, messages
 		buf.WriteString(" = buffer[idx]\n")
 		writeIdxInc(f, scopeDepth, buf)
 	case "int16", "int32", "int64", "uint16", "uint32", "uint64", "float64":
+		switch f.Type {
+		case "int16", "uint16":
+			writeLenCheck("2", scopeDepth, buf)
+		case "int32", "uint32":
+			writeLenCheck("4", scopeDepth, buf)
+		default:
+			writeLenCheck("8", scopeDepth, buf)
+		}
 		if scopeDepth == 1 {
 			buf.WriteString("m.")
 		}
@@ -396,11 +446,23 @@ func WriteGoDeserial(f MessageField, scopeDepth int, buf *bytes.Buffer, messages
 			for i := 0; i < scopeDepth; i++ {
 				buf.WriteString("\t")
 			}
+			buf.WriteString("if err := ")
 			if scopeDepth == 1 {
 				buf.WriteString("m.")
 			}
 			buf.WriteString(f.Name)
-			buf.WriteString(".Deserialize(buffer[idx:])\n")
+			buf.WriteString(".Deserialize(buffer[idx:]); err != nil {\n")
+			for i := 0; i <= scopeDepth; i++ {
+				buf.WriteString("\t")
+			}
+			buf.WriteString("return err\n")
+			for i := 0; i < scopeDepth; i++ {
+				buf.WriteString("\t")
+			}
+			buf.WriteString("}\n")
+			for i := 0; i < scopeDepth; i++ {
+				buf.WriteString("\t")
+			}
 			buf.WriteString("idx+=")
 			if scopeDepth == 1 {
 				buf.WriteString("m.")
@@ -1,9 +1,14 @@
 package main
 
 import (
+	"bufio"
+	"flag"
 	"fmt"
 	"os"
 	"os/signal"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/lologarithm/slink/slinkserv"
 )
@@ -11,10 +16,19 @@ import (
 func main() {
 	exit := make(chan int, 10)
 	complete := make(chan int, 1)
+	cfg := slinkserv.DefaultConfig()
+	flag.StringVar(&cfg.CapturePath, "capture", "", "record every datagram to this file, read it with slinkcap")
+	flag.StringVar(&cfg.AccountsPath, "accounts", "accounts.log", "file accounts are saved to, empty keeps them in memory only")
+	flag.StringVar(&cfg.NameBlocklistPath, "blocklist", "", "file of words, one per line, that can't be used in player names")
+	flag.StringVar(&cfg.ServerKeyPath, "key", "server.key", "file the server's private key is kept in, created if missing")
+	flag.BoolVar(&cfg.RequireEncryption, "encrypt", true, "refuse logins from clients that haven't set up an encrypted session")
+	flag.Parse()
+
 	fmt.Println("Starting Server!")
 	// Launch server manager
-	s := slinkserv.NewServer(exit)
+	s := slinkserv.NewServer(exit, cfg)
 	go slinkserv.RunServer(s, exit, complete)
+	go readCommands(s.GameManager())
 
 	// go func() {
 	// 	for {
@@ -44,3 +58,31 @@ func main() {
 	fmt.Println("Goodbye!")
 	return
 }
+
+// readCommands runs admin commands typed into the server's console:
+//
+//	mute <name> <minutes> [reason]
+//	unmute <name>
+func readCommands(gm *slinkserv.GameManager) {
+	scanner := bufio.NewScanner(os.Stdin)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		switch {
+		case len(fields) >= 3 && fields[0] == "mute":
+			minutes, err := strconv.Atoi(fields[2])
+			if err != nil || minutes <= 0 {
+				fmt.Println("Minutes must be a positive number.")
+				continue
+			}
+			reason := "Muted by an admin."
+			if len(fields) > 3 {
+				reason = strings.Join(fields[3:], " ")
+			}
+			gm.Mute(fields[1], time.Duration(minutes)*time.Minute, reason)
+		case len(fields) == 2 && fields[0] == "unmute":
+			gm.Unmute(fields[1])
+		case len(fields) > 0:
+			fmt.Println("Commands: mute <name> <minutes> [reason], unmute <name>")
+		}
+	}
+}
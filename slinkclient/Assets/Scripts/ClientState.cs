@@ -17,17 +17,33 @@ public class ClientState : MonoBehaviour
     public Camera mainCam;
 
 	private NetworkMessenger net;
+	private string serverAddr;
+	private const int ServerPort = 24816;
+	// The server sends a heartbeat every 2 seconds, this long without hearing anything means the
+	// connection is gone or our address changed, so we reconnect and resume our session. It is longer
+	// than the 5 seconds the server waits before marking us lost, since only lost sessions are handed back.
+	private static readonly TimeSpan ReconnectAfter = TimeSpan.FromSeconds(8);
 	private uint mySnake;
+	private uint watching; // Snake the camera follows while spectating, when mySnake is 0.
 
 	private Queue<NetPacket> message_queue = new Queue<NetPacket>();
 	private Dictionary<uint, Multipart[]> multipart_cache = new Dictionary<uint, Multipart[]>();
 
     // Account
     private uint accountID;
+    private string playerName;
+    private bool guest; // Playing under a name the server made up, so there is nothing to log back in to.
+    private byte[] sessionToken = new byte[0]; // Lets us resume our session if the connection drops.
+    private SessionCipher sessionCipher; // Its key proves the session token is ours when resuming.
+    private bool resumed; // The last Connected gave us our old session back, so there's no need to log in once encrypted.
+    private bool badServerKey; // The server isn't the one we expect, so we stop talking to it.
 
 	// Game state
 	private GameInstance game;
 	private long latencyms;
+	private Heartbeat connectionQuality; // Latest connection stats from the server.
+	private Leaderboard leaderboard; // Biggest snakes in the game, sent every second.
+	private Minimap minimap; // Food density grid and the biggest snakes, sent every couple of seconds.
 
 	// Unity objects state
 	private Dictionary<uint, GameObject> segments = new Dictionary<uint, GameObject> ();
@@ -45,19 +61,16 @@ public class ClientState : MonoBehaviour
 
         // TODO: allow handoff of network messenger from another scene?
         // Or do we pass the entire client state manager from scene to scene?
-        string addr = PlayerPrefs.GetString("ip");
-        if (addr == "" || addr == null) {
-            addr = "127.0.0.1";
+        this.serverAddr = PlayerPrefs.GetString("ip");
+        if (this.serverAddr == "" || this.serverAddr == null) {
+            this.serverAddr = "127.0.0.1";
         }
-        int serverPort = 24816;
-        Debug.Log("Connecting to " + addr + ":" + serverPort);
-		net = new NetworkMessenger(this.message_queue, addr, serverPort);
-        string name = PlayerPrefs.GetString("name");
-        if (name == "" || name == null)
-        {
-            name = "Random Name lol";
-        }
-        this.CreateAccount(name, name);
+        Debug.Log("Connecting to " + this.serverAddr + ":" + ServerPort);
+		net = new NetworkMessenger(this.message_queue, this.serverAddr, ServerPort);
+        // Without a name we play as a guest and the server picks one.
+        this.playerName = PlayerPrefs.GetString("name");
+        // First Connect is padded with a blank cookie, server won't answer anything smaller.
+        this.Connect(new byte[40]);
 	}
 
 	// Update is called once per frame?
@@ -73,6 +86,7 @@ public class ClientState : MonoBehaviour
 			    this.ParseAndProcess(msg);
             }
 		}
+		this.checkConnection();
 		// If game is null, we have nothing to do but process network.
 		if (this.game == null)
 		{
@@ -81,10 +95,19 @@ public class ClientState : MonoBehaviour
 
         this.game.UpdateTick();
 
+        if (this.mySnake == 0 && Input.GetKeyDown(KeyCode.Tab)) {
+            this.SpectateNext();
+        }
+
         if (this.game.LastTickUpdated >= this.game.Tick) {
             return;
         }
 
+        if (this.mySnake == 0) {
+            // Spectating, there is nothing to steer.
+            this.updateGame();
+            return;
+        }
         if (!this.game.entities.ContainsKey(this.mySnake)) {
             return;
         }
@@ -119,6 +142,54 @@ public class ClientState : MonoBehaviour
 	}
 
 	// Public functions game can call.
+	public void Connect(byte[] cookie)
+	{
+		Connect outmsg = new Connect();
+		outmsg.Cookie = cookie;
+		outmsg.Token = this.sessionToken;
+		outmsg.Proof = new byte[0];
+		if (this.sessionCipher != null && this.sessionToken.Length > 0) {
+			outmsg.Proof = this.sessionCipher.ResumeProof(cookie);
+		}
+		this.net.sendNetPacket(MsgType.Connect, outmsg);
+	}
+
+	// checkServerKey returns true if key is the one the server we want to talk to has. That is the
+	// key we ship with, or without one the key this address sent the first time we connected.
+	private bool checkServerKey(byte[] key)
+	{
+		if (key.Length == 0) {
+			return false;
+		}
+		string got = BitConverter.ToString(key).Replace("-", "").ToLower();
+		string want = GameConstants.ServerPublicKey;
+		if (want == "") {
+			string pref = "serverkey:" + this.serverAddr;
+			want = PlayerPrefs.GetString(pref);
+			if (want == "") {
+				PlayerPrefs.SetString(pref, got);
+				return true;
+			}
+		}
+		return got == want;
+	}
+
+	// checkConnection starts over on a new socket when the socket failed or the server has gone
+	// quiet. The Connect carries our session token so the server hands our session back.
+	private void checkConnection()
+	{
+		if (this.badServerKey) {
+			return;
+		}
+		if (!this.net.Closed && this.net.SinceLastReceived() < ReconnectAfter) {
+			return;
+		}
+		Debug.Log("Lost connection to the server, reconnecting.");
+		this.net.CloseConnection();
+		this.net = new NetworkMessenger(this.message_queue, this.serverAddr, ServerPort);
+		this.Connect(new byte[40]);
+	}
+
 	public void CreateAccount(string name, string password)
 	{
 		CreateAcct outmsg = new CreateAcct();
@@ -127,9 +198,13 @@ public class ClientState : MonoBehaviour
 		this.net.sendNetPacket(MsgType.CreateAcct, outmsg);
 	}
 
-	public void JoinGame()
+	// JoinGame joins a public game, or the private game with the given code.
+	// With makePrivate a new private game is started and its code comes back in GameConnected.
+	public void JoinGame(string code = "", bool makePrivate = false)
 	{
 		JoinGame gomsg = new JoinGame();
+		gomsg.Code = code;
+		gomsg.Private = (byte)(makePrivate ? 1 : 0);
 		this.net.sendNetPacket(MsgType.JoinGame, gomsg);
 	}
 
@@ -141,6 +216,50 @@ public class ClientState : MonoBehaviour
 		this.net.sendNetPacket(MsgType.Login, login_msg);
 	}
 
+	// RequestTopPlayers asks for the best players by a stat (0 peak length, 1 kills, 2 food eaten,
+	// 3 time alive, 4 games played), either all time or just today. The answer comes back in TopPlayers.
+	public void RequestTopPlayers(byte stat, bool daily)
+	{
+		TopPlayersReq req = new TopPlayersReq();
+		req.Stat = stat;
+		req.Daily = (byte)(daily ? 1 : 0);
+		this.net.sendNetPacket(MsgType.TopPlayersReq, req);
+	}
+
+	// WatchGame spectates a game without a snake, the busiest public game or the private game with
+	// the given code. The server says which snake the camera follows in Spectating.
+	public void WatchGame(string code = "")
+	{
+		JoinGame gomsg = new JoinGame();
+		gomsg.Code = code;
+		gomsg.Spectate = 1;
+		this.net.sendNetPacket(MsgType.JoinGame, gomsg);
+	}
+
+	// SpectateNext moves the camera on to the next snake while spectating.
+	public void SpectateNext()
+	{
+		Spectate msg = new Spectate();
+		msg.SnakeID = 0;
+		this.net.sendNetPacket(MsgType.Spectate, msg);
+	}
+
+	// SendChat says something to everyone in this game, or to every game when global is set.
+	public void SendChat(string text, bool global)
+	{
+		ChatSend chat = new ChatSend();
+		chat.Channel = (byte)(global ? 1 : 0);
+		chat.Text = text ?? "";
+		this.net.sendNetPacket(MsgType.ChatSend, chat);
+	}
+
+	// GuestLogin plays without an account, the server picks a name and sends it back in LoginResp.
+	public void GuestLogin()
+	{
+		this.guest = true;
+		this.net.sendNetPacket(MsgType.GuestLogin, new GuestLogin());
+	}
+
     public void SetDirection(short turn) {
         // Debug.Log("Sending facing at tick " + (this.game.Tick-1) + ", " + turn);
         TurnSnake dir_msg = new TurnSnake();
@@ -203,22 +322,92 @@ public class ClientState : MonoBehaviour
 				}
 				// 5. clean up!
 				break;
+			case MsgType.ConnectChallenge:
+				this.Connect(((ConnectChallenge)parsedMsg).Cookie);
+				break;
+			case MsgType.Connected:
+				Connected conn = (Connected)parsedMsg;
+				if (!this.checkServerKey(conn.PublicKey)) {
+					Debug.LogError("The server's key doesn't match the one we expect, not logging in.");
+					this.badServerKey = true;
+					this.net.CloseConnection();
+					break;
+				}
+				this.resumed = conn.Resumed == 1;
+				// Our half of the key exchange goes in the clear, everything after it is sealed.
+				// Logging in waits for the server to acknowledge the key.
+				byte[] clientPublic;
+				SessionCipher sc = SessionCipher.Exchange(conn.PublicKey, out clientPublic);
+				SessionKey sk = new SessionKey();
+				sk.Key = clientPublic;
+				this.net.sendNetPacket(MsgType.SessionKey, sk);
+				this.net.StartEncryption(sc);
+				this.sessionCipher = sc;
+				break;
+			case MsgType.SessionKeyAck:
+				if (this.resumed) {
+					// Still logged in, if we were in a game the server sends GameConnected again.
+					Debug.Log("Resumed session.");
+					break;
+				}
+				// New session, either the first connect or the old one expired while we were away.
+				this.sessionToken = new byte[0];
+				if (this.guest || this.playerName == null || this.playerName.Length == 0) {
+					this.GuestLogin();
+				} else {
+					this.CreateAccount(this.playerName, this.playerName);
+				}
+				break;
+			case MsgType.Warning:
+				Debug.LogWarning("Server warning: " + ((Warning)parsedMsg).Reason);
+				break;
 			case MsgType.Heartbeat:
 				Heartbeat hb = ((Heartbeat)parsedMsg);
+				if (hb.ClientTime != 0) {
+					// Reply to a clock sync request, those aren't echoed back.
+					break;
+				}
 				this.latencyms = hb.Latency;
-				this.net.sendNetPacket(MsgType.Heartbeat, parsedMsg);
+				this.connectionQuality = hb;
+				// Let the server know how many of its packets made it to us.
+				hb.Received = this.net.PacketsReceived;
+				hb.Lost = this.net.PacketsLost;
+				this.net.sendNetPacket(MsgType.Heartbeat, hb);
+				break;
+			case MsgType.MTUProbe:
+				// The probe made it through, let the server know it can send datagrams this big.
+				MTUProbeAck ack = new MTUProbeAck();
+				ack.Size = ((MTUProbe)parsedMsg).Size;
+				this.net.sendNetPacket(MsgType.MTUProbeAck, ack);
 				break;
             case MsgType.LoginResp:
                 LoginResp lr = ((LoginResp)parsedMsg);
                 if (lr.Success == 0)
                 {
-                    Debug.Log("Failed to login!");
+                    // Reason is 1 for a bad name or password, 2 when throttled and 3 for a server error.
+                    if (lr.Reason == 2) {
+                        Debug.Log("Too many failed logins, try again in " + lr.RetryAfter + " seconds.");
+                    } else {
+                        Debug.Log("Failed to login! Reason: " + lr.Reason + ", playing as a guest.");
+                        this.GuestLogin();
+                    }
+                    break;
                 }
-			    // TODO
+                this.accountID = lr.AccountID;
+                this.playerName = lr.Name;
+                this.sessionToken = lr.Token;
+                this.JoinGame();
 				break;
 			case MsgType.CreateAcctResp:
 				CreateAcctResp car = ((CreateAcctResp)parsedMsg);
+				if (car.AccountID == 0) {
+					// Probably made on an earlier run, try logging in to it instead.
+					Debug.Log("Couldn't create account: " + car.Reason);
+					this.Login(this.playerName, this.playerName);
+					break;
+				}
 				this.accountID = car.AccountID;
+				this.sessionToken = car.Token;
                 this.JoinGame();
 				break;
             case MsgType.TurnSnake:
@@ -277,7 +466,47 @@ public class ClientState : MonoBehaviour
                 this.game.LastTickUpdated = gc.TickID;
                 this.mySnake = gc.SnakeID;
                 Debug.Log("Connected to game, start tick " + this.game.StartTick + ", current tick: " + this.game.Tick + " Start Time: " + this.game.StartTime.ToString());
+                if (gc.Code.Length > 0) {
+                    Debug.Log("Private game, friends can join with code " + gc.Code);
+                }
 				break;
+            case MsgType.Minimap:
+                this.minimap = ((Minimap)parsedMsg);
+                break;
+            case MsgType.Leaderboard:
+                this.leaderboard = ((Leaderboard)parsedMsg);
+                break;
+            case MsgType.Spectating:
+                this.watching = ((Spectating)parsedMsg).SnakeID;
+                break;
+            case MsgType.AreaFood:
+                // Food that came into view around the snake we are watching.
+                foreach (Entity food in ((AreaFood)parsedMsg).Food) {
+                    this.game.entities[food.ID] = food;
+                }
+                break;
+            case MsgType.Chat:
+                Chat chat = ((Chat)parsedMsg);
+                Debug.Log((chat.Channel == 1 ? "[all] " : "") + chat.From + ": " + chat.Text);
+                break;
+            case MsgType.ChatMuted:
+                ChatMuted muted = ((ChatMuted)parsedMsg);
+                if (muted.Seconds == 0) {
+                    Debug.Log(muted.Reason); // Unmuted.
+                } else {
+                    Debug.Log(muted.Reason + " Muted for " + muted.Seconds + "s.");
+                }
+                break;
+            case MsgType.TopPlayers:
+                TopPlayers top = ((TopPlayers)parsedMsg);
+                for (int i = 0; i < top.Players.Length; i++) {
+                    PlayerStats ps = top.Players[i];
+                    Debug.Log((i + 1) + ". " + ps.Name + ": " + ps.PeakLength + " peak length, " + ps.Kills + " kills, " + ps.FoodEaten + " food, " + ps.TimeAlive + "s alive");
+                }
+                break;
+            case MsgType.JoinGameFailed:
+                Debug.Log("Failed to join game: " + ((JoinGameFailed)parsedMsg).Reason);
+                break;
             case MsgType.GameMasterFrame:
                 GameMasterFrame gmf = ((GameMasterFrame)parsedMsg);
                 Debug.Log("Got master frame @ " + gmf.Tick);
@@ -394,6 +623,22 @@ public class ClientState : MonoBehaviour
         }
         this.updateCamera();
         this.latencyText.text = "Latency: " + this.latencyms;
+        if (this.connectionQuality != null)
+        {
+            // Loss comes in tenths of a percent.
+            this.latencyText.text += " Jitter: " + this.connectionQuality.Jitter +
+                " Loss: " + (this.connectionQuality.LossOut / 10.0f) + "%";
+        }
+        if (this.leaderboard != null)
+        {
+            for (int i = 0; i < this.leaderboard.Entries.Length; i++) {
+                LeaderboardEntry le = this.leaderboard.Entries[i];
+                this.latencyText.text += "\n" + (i + 1) + ". " + le.Name + " " + le.Size;
+            }
+            if (this.leaderboard.Rank > 0) {
+                this.latencyText.text += "\nYou: " + this.leaderboard.Rank + " of " + this.leaderboard.Players;
+            }
+        }
         this.game.LastTickUpdated = this.game.Tick;
         return true;
     }
@@ -413,11 +658,14 @@ public class ClientState : MonoBehaviour
 
     private void updateCamera()
     {
-        if (!this.game.entities.ContainsKey(this.mySnake)) {
-            Debug.Log("Unable to find my snake in entity list!?!");
+        uint following = this.mySnake != 0 ? this.mySnake : this.watching;
+        if (!this.game.entities.ContainsKey(following)) {
+            if (this.mySnake != 0) {
+                Debug.Log("Unable to find my snake in entity list!?!");
+            }
             return;
         }
-        Entity mysnake = this.game.entities[this.mySnake];
+        Entity mysnake = this.game.entities[following];
         this.mainCam.transform.position = new Vector3(mysnake.X, mysnake.Y, -100);
         this.mainCam.orthographicSize = mysnake.Size * 10;
     }
@@ -10,5 +10,9 @@ namespace Assets.Scripts
         public const float TurningSpeed = -.06f;
         public const float TicksPerSecond = 50;
         public const float TickLength = 1000 / TicksPerSecond;
+
+        // ServerPublicKey is the hex key the server prints when it starts, we won't log in to a server
+        // with a different one. Left empty, the key each address sent first is remembered instead.
+        public const string ServerPublicKey = "";
     }
 }
@@ -1,9 +1,11 @@
 ﻿using UnityEngine;
 using System;
 using System.IO;
+using System.IO.Compression;
 using System.Net;
 using System.Net.Sockets;
 using System.Collections.Generic;
+using System.Threading;
 
 internal class NetworkMessenger
 {
@@ -13,13 +15,27 @@ internal class NetworkMessenger
 
 	// Caching network state
 	private byte[] buff = new byte[8192];
-	private byte[] stored_bytes = new byte[8192];
-	private int numStored = 0;
 
 	private uint multi_groupid = 0;
 
+	// Sequence numbers let both ends work out how many packets went missing.
+	private ushort sequence = 0;
+	private bool received_any = false;
+	private ushort last_received_seq = 0;
+	public uint PacketsReceived = 0;
+	public uint PacketsLost = 0;
+
 	private Queue<NetPacket> message_queue = new Queue<NetPacket>();
 
+	// Liveness, written by the receive callback and read from the game loop.
+	private long last_received_ticks = DateTime.UtcNow.Ticks;
+	private volatile bool closed = false;
+
+	// Set once we have sent our session key, from then on everything we send is sealed.
+	// Once the first sealed datagram from the server opens, plaintext from it is dropped.
+	private volatile SessionCipher cipher;
+	private bool opened_sealed = false;
+
 	public NetworkMessenger(Queue<NetPacket> queue,string addr, int port)
 	{
 		Debug.Log("Starting network now!");
@@ -40,8 +56,38 @@ internal class NetworkMessenger
 		}
 	}
 
+	// Closed is set once the socket has failed or been closed, nothing more will be received.
+	public bool Closed
+	{
+		get { return this.closed; }
+	}
+
+	// SinceLastReceived is how long it has been since the server last sent us anything.
+	public TimeSpan SinceLastReceived()
+	{
+		return new TimeSpan(DateTime.UtcNow.Ticks - Interlocked.Read(ref this.last_received_ticks));
+	}
+
+	// StartEncryption seals everything sent from now on, call it after sending SessionKey.
+	public void StartEncryption(SessionCipher sc)
+	{
+		this.cipher = sc;
+	}
+
+	private void send(byte[] datagram)
+	{
+		SessionCipher sc = this.cipher;
+		if (sc != null) {
+			datagram = sc.Seal(datagram);
+		}
+		this.sending_socket.Send(datagram);
+	}
+
 	public void sendNetPacket(MsgType t, INet outmsg)
 	{
+		if (this.closed) {
+			return;
+		}
 		NetPacket msg = new NetPacket();
 		MemoryStream stream = new MemoryStream();
 		BinaryWriter buffer = new BinaryWriter(stream);
@@ -73,7 +119,8 @@ internal class NetworkMessenger
 
 				msg.content = pstream.ToArray();
 				msg.content_length = (ushort)pstream.Length;
-				this.sending_socket.Send(msg.MessageBytes());
+				msg.sequence = ++this.sequence;
+				this.send(msg.MessageBytes());
                 bstart = bend;
 			}
 		}
@@ -82,7 +129,8 @@ internal class NetworkMessenger
 			msg.content = stream.ToArray();
 			msg.content_length = (ushort)msg.content.Length;
 			msg.message_type = (byte)t;
-			this.sending_socket.Send(msg.MessageBytes());
+			msg.sequence = ++this.sequence;
+			this.send(msg.MessageBytes());
 		}
 	}
 
@@ -110,47 +158,84 @@ internal class NetworkMessenger
 
 		if (bytesRead > 0)
 		{
-			if (this.stored_bytes.Length < this.numStored + bytesRead)
+			Interlocked.Exchange(ref this.last_received_ticks, DateTime.UtcNow.Ticks);
+			byte[] datagram = new byte[bytesRead];
+			Array.Copy(this.buff, 0, datagram, 0, bytesRead);
+			datagram = this.open(datagram);
+			if (datagram != null)
 			{
-				byte[] newbuf = new byte[this.stored_bytes.Length * 2];
-				Array.Copy(this.stored_bytes, 0, newbuf, 0, this.numStored);
-				this.stored_bytes = newbuf;
+				ProcessBytes(datagram);
 			}
-			Array.Copy(this.buff, 0, this.stored_bytes, this.numStored, bytesRead);
-			this.numStored += bytesRead;
-			ProcessBytes();
 			sending_socket.BeginReceive(this.buff, 0, buff.Length, SocketFlags.None, new AsyncCallback(ReceiveCallback), null);
 		}
 		else
 			CloseConnection();
 	}
 
-	private void ProcessBytes()
+	// open returns the datagram to process, opening it if it was sealed. Returns null to drop it,
+	// when it doesn't open or is plaintext sent after the server started sealing.
+	private byte[] open(byte[] datagram)
+	{
+		SessionCipher sc = this.cipher;
+		if (sc == null) {
+			return datagram;
+		}
+		if (!SessionCipher.IsSealed(datagram)) {
+			// The server may not have our key yet, so plaintext is fine until it starts sealing.
+			return this.opened_sealed ? null : datagram;
+		}
+		byte[] plain = sc.Open(datagram);
+		if (plain != null) {
+			this.opened_sealed = true;
+		}
+		return plain;
+	}
+
+	private void ProcessBytes(byte[] datagram)
 	{
-		byte[] input_bytes = new byte[this.numStored];
-		Array.Copy(this.stored_bytes, 0, input_bytes, 0, this.numStored);
-		NetPacket nMsg = NetPacket.fromBytes(input_bytes);
-		if (nMsg != null)
+		// The server packs several packets into one datagram and never splits one across
+		// datagrams, so queue every complete one and drop anything cut short.
+		int offset = 0;
+		while (datagram.Length - offset >= NetPacket.DEFAULT_FRAME_LEN)
 		{
-			// Check for full content available. If so, time to add this to the processing queue.
-			if (nMsg.full_content != null)
+			byte[] input_bytes = new byte[datagram.Length - offset];
+			Array.Copy(datagram, offset, input_bytes, 0, input_bytes.Length);
+			NetPacket nMsg = NetPacket.fromBytes(input_bytes);
+			if (nMsg == null || nMsg.full_content == null)
 			{
-				this.numStored -= nMsg.full_content.Length;
-				if (nMsg==null) {
-					Debug.Log("Enqueing a null message!?");
-				} 
-				this.message_queue.Enqueue(nMsg);
-				// If we have enough bytes to start a new message we call ProcessBytes again.
-				if (input_bytes.Length - nMsg.full_content.Length > NetPacket.DEFAULT_FRAME_LEN)
-				{
-					ProcessBytes();
-				}
+				return;
 			}
+			offset += nMsg.full_content.Length;
+			this.trackSequence(nMsg.sequence);
+			this.message_queue.Enqueue(nMsg);
+		}
+	}
+
+	// A jump forward counts the skipped packets as lost, a late packet takes one back off.
+	private void trackSequence(ushort seq)
+	{
+		this.PacketsReceived++;
+		if (!this.received_any)
+		{
+			this.received_any = true;
+			this.last_received_seq = seq;
+			return;
+		}
+		short diff = (short)(seq - this.last_received_seq);
+		if (diff > 0)
+		{
+			this.PacketsLost += (uint)(diff - 1);
+			this.last_received_seq = seq;
+		}
+		else if (this.PacketsLost > 0)
+		{
+			this.PacketsLost--;
 		}
 	}
 
 	public void CloseConnection()
 	{
+		this.closed = true;
 		if (sending_socket.Connected)
 		{
 			// sending_socket.Send (new byte[] { 255, 0, 0, 0, 0, 0, 0 }); // TODO: create a disconnect message.
@@ -162,8 +247,11 @@ internal class NetworkMessenger
 public class NetPacket
 {
 	public const int DEFAULT_FRAME_LEN = 6;
+	// Set in the high bit of the message type when the content is deflated.
+	public const ushort COMPRESSED_FLAG = 0x8000;
 
 	public ushort message_type;
+	public bool compressed;
 	public int from_player;
 	public ushort content_length;
 	public ushort sequence;
@@ -189,9 +277,28 @@ public class NetPacket
 	{
 		byte[] content = new byte[this.content_length];
 		Array.Copy(this.full_content, DEFAULT_FRAME_LEN, content, 0, this.content_length);
+		if (this.compressed)
+		{
+			content = Inflate(content);
+		}
 		return content;
 	}
 
+	private static byte[] Inflate(byte[] content)
+	{
+		MemoryStream output = new MemoryStream();
+		using (DeflateStream inflater = new DeflateStream(new MemoryStream(content), CompressionMode.Decompress))
+		{
+			byte[] buf = new byte[4096];
+			int n;
+			while ((n = inflater.Read(buf, 0, buf.Length)) > 0)
+			{
+				output.Write(buf, 0, n);
+			}
+		}
+		return output.ToArray();
+	}
+
 	public static NetPacket fromBytes(byte[] bytes)
 	{
 		NetPacket newMsg = null;
@@ -199,6 +306,11 @@ public class NetPacket
 		{
 			newMsg = new NetPacket();
 			newMsg.message_type = BitConverter.ToUInt16(bytes, 0);
+			if ((newMsg.message_type & COMPRESSED_FLAG) != 0)
+			{
+				newMsg.message_type &= unchecked((ushort)~COMPRESSED_FLAG);
+				newMsg.compressed = true;
+			}
 			newMsg.sequence = BitConverter.ToUInt16(bytes, 2);
 			newMsg.content_length = BitConverter.ToUInt16(bytes, 4);
 
@@ -0,0 +1,486 @@
+using System;
+using System.IO;
+using System.Security.Cryptography;
+
+// SessionCipher seals and opens the datagrams of an encrypted session with AES-GCM, the client
+// half of SessionCipher in slinkserv/messages/crypto.go. Every datagram is wrapped in an Encrypted
+// packet whose Seq, together with the direction it is traveling, makes up the nonce.
+// Seal and Open can be called from different threads but neither from more than one at a time.
+public class SessionCipher
+{
+	// Nonce prefixes so the two directions of a session never share a nonce.
+	private const uint ToServer = 0;
+	private const uint ToClient = 1;
+
+	private byte[] key;
+	private GcmCipher gcm;
+	private ulong sendSeq = 0;
+
+	private ulong recvMax = 0;  // Highest Seq opened so far.
+	private ulong recvSeen = 0; // Bitmap of the 64 Seqs below recvMax that have been opened.
+
+	public SessionCipher(byte[] key)
+	{
+		this.key = key;
+		this.gcm = new GcmCipher(key);
+	}
+
+	// Exchange runs our half of the key exchange against the X25519 public key the server sent in
+	// Connected. Returns the cipher for the session and the public key to send in SessionKey.
+	public static SessionCipher Exchange(byte[] serverPublic, out byte[] clientPublic)
+	{
+		byte[] priv = new byte[32];
+		new RNGCryptoServiceProvider().GetBytes(priv);
+		clientPublic = X25519.ScalarMultBase(priv);
+		byte[] shared = X25519.ScalarMult(priv, serverPublic);
+
+		// Same as the server, the key is the shared secret bound to both public keys.
+		byte[] input = new byte[shared.Length + clientPublic.Length + serverPublic.Length];
+		Buffer.BlockCopy(shared, 0, input, 0, shared.Length);
+		Buffer.BlockCopy(clientPublic, 0, input, shared.Length, clientPublic.Length);
+		Buffer.BlockCopy(serverPublic, 0, input, shared.Length + clientPublic.Length, serverPublic.Length);
+		return new SessionCipher(new SHA256Managed().ComputeHash(input));
+	}
+
+	// ResumeProof goes in Connect to show the server we held this session's key, since the
+	// session token is sent in the clear. It covers the cookie so it only works from our address.
+	public byte[] ResumeProof(byte[] cookie)
+	{
+		byte[] label = System.Text.Encoding.ASCII.GetBytes("slink resume");
+		byte[] input = new byte[label.Length + cookie.Length];
+		Buffer.BlockCopy(label, 0, input, 0, label.Length);
+		Buffer.BlockCopy(cookie, 0, input, label.Length, cookie.Length);
+		return new HMACSHA256(this.key).ComputeHash(input);
+	}
+
+	private static byte[] nonce(uint dir, ulong seq)
+	{
+		byte[] nonce = new byte[12];
+		Buffer.BlockCopy(BitConverter.GetBytes(dir), 0, nonce, 0, 4);
+		Buffer.BlockCopy(BitConverter.GetBytes(seq), 0, nonce, 4, 8);
+		return nonce;
+	}
+
+	// Seal encrypts a datagram and returns the packed Encrypted packet to send in its place.
+	public byte[] Seal(byte[] datagram)
+	{
+		this.sendSeq++;
+		Encrypted wrapper = new Encrypted();
+		wrapper.Seq = this.sendSeq;
+		wrapper.Data = this.gcm.Seal(nonce(ToServer, this.sendSeq), datagram);
+
+		MemoryStream stream = new MemoryStream();
+		wrapper.Serialize(new BinaryWriter(stream));
+		NetPacket packet = new NetPacket();
+		packet.message_type = (ushort)MsgType.Encrypted;
+		packet.content = stream.ToArray();
+		packet.content_length = (ushort)packet.content.Length;
+		return packet.MessageBytes();
+	}
+
+	// IsSealed reports whether a datagram is an Encrypted packet, without checking anything else.
+	public static bool IsSealed(byte[] datagram)
+	{
+		return datagram.Length >= NetPacket.DEFAULT_FRAME_LEN && BitConverter.ToUInt16(datagram, 0) == (ushort)MsgType.Encrypted;
+	}
+
+	// Open decrypts a datagram sealed by the server.
+	// Returns null if it isn't an Encrypted packet, fails authentication or is a replay.
+	public byte[] Open(byte[] datagram)
+	{
+		NetPacket packet = NetPacket.fromBytes(datagram);
+		if (packet == null || packet.full_content == null || packet.message_type != (ushort)MsgType.Encrypted)
+		{
+			return null;
+		}
+		Encrypted wrapper = new Encrypted();
+		try
+		{
+			wrapper.Deserialize(new BinaryReader(new MemoryStream(packet.Content())));
+		}
+		catch (Exception)
+		{
+			return null;
+		}
+		if (wrapper.Seq == 0 || this.replayed(wrapper.Seq))
+		{
+			return null;
+		}
+		byte[] plain = this.gcm.Open(nonce(ToClient, wrapper.Seq), wrapper.Data);
+		if (plain == null)
+		{
+			return null;
+		}
+		this.markSeen(wrapper.Seq);
+		return plain;
+	}
+
+	private bool replayed(ulong seq)
+	{
+		if (seq > this.recvMax)
+		{
+			return false;
+		}
+		ulong diff = this.recvMax - seq;
+		if (diff >= 64)
+		{
+			return true; // Too old to tell, treat it as a replay.
+		}
+		return (this.recvSeen & (1UL << (int)diff)) != 0;
+	}
+
+	private void markSeen(ulong seq)
+	{
+		if (seq > this.recvMax)
+		{
+			ulong shift = seq - this.recvMax;
+			if (shift >= 64)
+			{
+				this.recvSeen = 0;
+			}
+			else
+			{
+				this.recvSeen <<= (int)shift;
+			}
+			this.recvMax = seq;
+		}
+		this.recvSeen |= 1UL << (int)(this.recvMax - seq);
+	}
+}
+
+// GcmCipher is AES-GCM with 12 byte nonces and 16 byte tags, the same as Go's cipher.NewGCM.
+// Only the AES block cipher comes from the runtime, the counter mode and GHASH are done here.
+internal class GcmCipher
+{
+	private const int TagSize = 16;
+
+	private ICryptoTransform block;
+	private ulong hHi, hLo; // GHASH key, the encrypted zero block.
+
+	public GcmCipher(byte[] key)
+	{
+		RijndaelManaged aes = new RijndaelManaged();
+		aes.Mode = CipherMode.ECB;
+		aes.Padding = PaddingMode.None;
+		aes.KeySize = key.Length * 8;
+		aes.BlockSize = 128;
+		aes.Key = key;
+		this.block = aes.CreateEncryptor();
+		byte[] h = this.encrypt(new byte[16]);
+		this.hHi = readBig(h, 0);
+		this.hLo = readBig(h, 8);
+	}
+
+	private byte[] encrypt(byte[] input)
+	{
+		byte[] output = new byte[16];
+		this.block.TransformBlock(input, 0, 16, output, 0);
+		return output;
+	}
+
+	// Seal returns the encrypted data followed by its tag.
+	public byte[] Seal(byte[] nonce, byte[] plain)
+	{
+		byte[] output = new byte[plain.Length + TagSize];
+		this.ctr(nonce, plain, output, plain.Length);
+		byte[] tag = this.tag(nonce, output, plain.Length);
+		Buffer.BlockCopy(tag, 0, output, plain.Length, TagSize);
+		return output;
+	}
+
+	// Open checks the tag and returns the decrypted data, or null if it doesn't match.
+	public byte[] Open(byte[] nonce, byte[] sealedData)
+	{
+		if (sealedData.Length < TagSize)
+		{
+			return null;
+		}
+		int n = sealedData.Length - TagSize;
+		byte[] expected = this.tag(nonce, sealedData, n);
+		int diff = 0;
+		for (int i = 0; i < TagSize; i++)
+		{
+			diff |= expected[i] ^ sealedData[n + i];
+		}
+		if (diff != 0)
+		{
+			return null;
+		}
+		byte[] plain = new byte[n];
+		this.ctr(nonce, sealedData, plain, n);
+		return plain;
+	}
+
+	// counter is the nonce followed by a 32 bit big endian block counter.
+	private static byte[] counter(byte[] nonce, uint count)
+	{
+		byte[] ctr = new byte[16];
+		Buffer.BlockCopy(nonce, 0, ctr, 0, 12);
+		ctr[12] = (byte)(count >> 24);
+		ctr[13] = (byte)(count >> 16);
+		ctr[14] = (byte)(count >> 8);
+		ctr[15] = (byte)count;
+		return ctr;
+	}
+
+	// ctr xors the first n bytes of input with the key stream, which starts at counter 2.
+	private void ctr(byte[] nonce, byte[] input, byte[] output, int n)
+	{
+		uint count = 2;
+		for (int off = 0; off < n; off += 16)
+		{
+			byte[] stream = this.encrypt(counter(nonce, count++));
+			for (int i = 0; i < 16 && off + i < n; i++)
+			{
+				output[off + i] = (byte)(input[off + i] ^ stream[i]);
+			}
+		}
+	}
+
+	// tag is GHASH over the first n bytes of ciphertext and their length, masked with counter 1.
+	private byte[] tag(byte[] nonce, byte[] ciphertext, int n)
+	{
+		ulong hi = 0, lo = 0;
+		byte[] chunk = new byte[16];
+		for (int off = 0; off < n; off += 16)
+		{
+			Array.Clear(chunk, 0, 16);
+			Buffer.BlockCopy(ciphertext, off, chunk, 0, Math.Min(16, n - off));
+			hi ^= readBig(chunk, 0);
+			lo ^= readBig(chunk, 8);
+			this.mulH(ref hi, ref lo);
+		}
+		// There is never any additional data, so its length is always 0.
+		lo ^= (ulong)n * 8;
+		this.mulH(ref hi, ref lo);
+
+		byte[] mask = this.encrypt(counter(nonce, 1));
+		byte[] tag = new byte[TagSize];
+		writeBig(tag, 0, hi);
+		writeBig(tag, 8, lo);
+		for (int i = 0; i < TagSize; i++)
+		{
+			tag[i] ^= mask[i];
+		}
+		return tag;
+	}
+
+	// mulH multiplies x by H in GCM's GF(2^128), one bit at a time.
+	private void mulH(ref ulong xHi, ref ulong xLo)
+	{
+		ulong zHi = 0, zLo = 0;
+		ulong vHi = this.hHi, vLo = this.hLo;
+		for (int i = 0; i < 128; i++)
+		{
+			ulong bit = i < 64 ? (xHi >> (63 - i)) & 1 : (xLo >> (127 - i)) & 1;
+			if (bit != 0)
+			{
+				zHi ^= vHi;
+				zLo ^= vLo;
+			}
+			bool carry = (vLo & 1) != 0;
+			vLo = (vLo >> 1) | (vHi << 63);
+			vHi >>= 1;
+			if (carry)
+			{
+				vHi ^= 0xe100000000000000UL;
+			}
+		}
+		xHi = zHi;
+		xLo = zLo;
+	}
+
+	private static ulong readBig(byte[] b, int off)
+	{
+		ulong v = 0;
+		for (int i = 0; i < 8; i++)
+		{
+			v = (v << 8) | b[off + i];
+		}
+		return v;
+	}
+
+	private static void writeBig(byte[] b, int off, ulong v)
+	{
+		for (int i = 7; i >= 0; i--)
+		{
+			b[off + i] = (byte)v;
+			v >>= 8;
+		}
+	}
+}
+
+// X25519 is Curve25519 Diffie-Hellman, ported from TweetNaCl. Field elements are 16 limbs of 16 bits.
+internal static class X25519
+{
+	private static readonly long[] a24 = new long[] { 0xDB41, 1, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0 };
+
+	public static byte[] ScalarMultBase(byte[] scalar)
+	{
+		byte[] basePoint = new byte[32];
+		basePoint[0] = 9;
+		return ScalarMult(scalar, basePoint);
+	}
+
+	public static byte[] ScalarMult(byte[] scalar, byte[] point)
+	{
+		byte[] z = new byte[32];
+		Buffer.BlockCopy(scalar, 0, z, 0, 32);
+		z[31] = (byte)((scalar[31] & 127) | 64);
+		z[0] &= 248;
+
+		long[] x = new long[16];
+		unpack(x, point);
+		long[] a = new long[16], b = new long[16], c = new long[16], d = new long[16], e = new long[16], f = new long[16];
+		Array.Copy(x, b, 16);
+		a[0] = 1;
+		d[0] = 1;
+		for (int i = 254; i >= 0; i--)
+		{
+			long r = (z[i >> 3] >> (i & 7)) & 1;
+			select(a, b, r);
+			select(c, d, r);
+			add(e, a, c);
+			sub(a, a, c);
+			add(c, b, d);
+			sub(b, b, d);
+			mul(d, e, e);
+			mul(f, a, a);
+			mul(a, c, a);
+			mul(c, b, e);
+			add(e, a, c);
+			sub(a, a, c);
+			mul(b, a, a);
+			sub(c, d, f);
+			mul(a, c, a24);
+			add(a, a, d);
+			mul(c, c, a);
+			mul(a, d, f);
+			mul(d, b, x);
+			mul(b, e, e);
+			select(a, b, r);
+			select(c, d, r);
+		}
+		invert(c, c);
+		mul(a, a, c);
+		byte[] output = new byte[32];
+		pack(output, a);
+		return output;
+	}
+
+	private static void carry(long[] o)
+	{
+		for (int i = 0; i < 16; i++)
+		{
+			o[i] += 1L << 16;
+			long c = o[i] >> 16;
+			if (i < 15)
+			{
+				o[i + 1] += c - 1;
+			}
+			else
+			{
+				o[0] += 38 * (c - 1);
+			}
+			o[i] -= c << 16;
+		}
+	}
+
+	// select swaps p and q when b is 1, without branching on it.
+	private static void select(long[] p, long[] q, long b)
+	{
+		long c = ~(b - 1);
+		for (int i = 0; i < 16; i++)
+		{
+			long t = c & (p[i] ^ q[i]);
+			p[i] ^= t;
+			q[i] ^= t;
+		}
+	}
+
+	private static void pack(byte[] o, long[] n)
+	{
+		long[] m = new long[16], t = new long[16];
+		Array.Copy(n, t, 16);
+		carry(t);
+		carry(t);
+		carry(t);
+		for (int j = 0; j < 2; j++)
+		{
+			m[0] = t[0] - 0xffed;
+			for (int i = 1; i < 15; i++)
+			{
+				m[i] = t[i] - 0xffff - ((m[i - 1] >> 16) & 1);
+				m[i - 1] &= 0xffff;
+			}
+			m[15] = t[15] - 0x7fff - ((m[14] >> 16) & 1);
+			long b = (m[15] >> 16) & 1;
+			m[14] &= 0xffff;
+			select(t, m, 1 - b);
+		}
+		for (int i = 0; i < 16; i++)
+		{
+			o[2 * i] = (byte)t[i];
+			o[2 * i + 1] = (byte)(t[i] >> 8);
+		}
+	}
+
+	private static void unpack(long[] o, byte[] n)
+	{
+		for (int i = 0; i < 16; i++)
+		{
+			o[i] = n[2 * i] + ((long)n[2 * i + 1] << 8);
+		}
+		o[15] &= 0x7fff;
+	}
+
+	private static void add(long[] o, long[] a, long[] b)
+	{
+		for (int i = 0; i < 16; i++)
+		{
+			o[i] = a[i] + b[i];
+		}
+	}
+
+	private static void sub(long[] o, long[] a, long[] b)
+	{
+		for (int i = 0; i < 16; i++)
+		{
+			o[i] = a[i] - b[i];
+		}
+	}
+
+	private static void mul(long[] o, long[] a, long[] b)
+	{
+		long[] t = new long[31];
+		for (int i = 0; i < 16; i++)
+		{
+			for (int j = 0; j < 16; j++)
+			{
+				t[i + j] += a[i] * b[j];
+			}
+		}
+		for (int i = 0; i < 15; i++)
+		{
+			t[i] += 38 * t[i + 16];
+		}
+		Array.Copy(t, o, 16);
+		carry(o);
+		carry(o);
+	}
+
+	private static void invert(long[] o, long[] i)
+	{
+		long[] c = new long[16];
+		Array.Copy(i, c, 16);
+		for (int a = 253; a >= 0; a--)
+		{
+			mul(c, c, c);
+			if (a != 2 && a != 4)
+			{
+				mul(c, c, i);
+			}
+		}
+		Array.Copy(c, o, 16);
+	}
+}
@@ -7,7 +7,7 @@ interface INet {
 	void Deserialize(BinaryReader buffer);
 }
 
-enum MsgType : ushort {Unknown=0,Ack=1,Multipart=2,Heartbeat=3,Connected=4,Disconnected=5,CreateAcct=6,CreateAcctResp=7,Login=8,LoginResp=9,JoinGame=10,GameConnected=11,GameMasterFrame=12,Entity=13,Snake=14,TurnSnake=15,RemoveEntity=16,UpdateEntity=17,SnakeDied=18,Vect2=19,A=20}
+enum MsgType : ushort {Unknown=0,Ack=1,Multipart=2,Heartbeat=3,Connected=4,Disconnected=5,CreateAcct=6,CreateAcctResp=7,Login=8,LoginResp=9,JoinGame=10,GameConnected=11,GameMasterFrame=12,Entity=13,Snake=14,TurnSnake=15,RemoveEntity=16,UpdateEntity=17,SnakeDied=18,Vect2=19,Connect=20,ConnectChallenge=21,SessionKey=22,SessionKeyAck=23,Encrypted=24,Warning=25,MTUProbe=26,MTUProbeAck=27,JoinGameFailed=28,GuestLogin=29,PlayerStats=30,TopPlayersReq=31,TopPlayers=32,LeaderboardEntry=33,Leaderboard=34,MinimapSnake=35,Minimap=36,ChatSend=37,Chat=38,ChatMuted=39,Spectate=40,Spectating=41,AreaFood=42,A=43}
 
 static class Messages {
 // ParseNetMessage accepts input of raw bytes from a NetMessage. Parses and returns a Net message.
@@ -70,6 +70,75 @@ public static INet Parse(ushort msgType, byte[] content) {
 		case MsgType.Vect2:
 			msg = new Vect2();
 			break;
+		case MsgType.Connect:
+			msg = new Connect();
+			break;
+		case MsgType.ConnectChallenge:
+			msg = new ConnectChallenge();
+			break;
+		case MsgType.SessionKey:
+			msg = new SessionKey();
+			break;
+		case MsgType.SessionKeyAck:
+			msg = new SessionKeyAck();
+			break;
+		case MsgType.Encrypted:
+			msg = new Encrypted();
+			break;
+		case MsgType.Warning:
+			msg = new Warning();
+			break;
+		case MsgType.MTUProbe:
+			msg = new MTUProbe();
+			break;
+		case MsgType.MTUProbeAck:
+			msg = new MTUProbeAck();
+			break;
+		case MsgType.JoinGameFailed:
+			msg = new JoinGameFailed();
+			break;
+		case MsgType.GuestLogin:
+			msg = new GuestLogin();
+			break;
+		case MsgType.PlayerStats:
+			msg = new PlayerStats();
+			break;
+		case MsgType.TopPlayersReq:
+			msg = new TopPlayersReq();
+			break;
+		case MsgType.TopPlayers:
+			msg = new TopPlayers();
+			break;
+		case MsgType.LeaderboardEntry:
+			msg = new LeaderboardEntry();
+			break;
+		case MsgType.Leaderboard:
+			msg = new Leaderboard();
+			break;
+		case MsgType.MinimapSnake:
+			msg = new MinimapSnake();
+			break;
+		case MsgType.Minimap:
+			msg = new Minimap();
+			break;
+		case MsgType.ChatSend:
+			msg = new ChatSend();
+			break;
+		case MsgType.Chat:
+			msg = new Chat();
+			break;
+		case MsgType.ChatMuted:
+			msg = new ChatMuted();
+			break;
+		case MsgType.Spectate:
+			msg = new Spectate();
+			break;
+		case MsgType.Spectating:
+			msg = new Spectating();
+			break;
+		case MsgType.AreaFood:
+			msg = new AreaFood();
+			break;
 		case MsgType.A:
 			msg = new A();
 			break;
@@ -111,24 +180,79 @@ public class Multipart : INet {
 public class Heartbeat : INet {
 	public long Time;
 	public long Latency;
+	public long RTTMin;
+	public long RTTMax;
+	public long Jitter;
+	public ushort LossIn;
+	public ushort LossOut;
+	public uint BytesInPerSec;
+	public uint BytesOutPerSec;
+	public uint FragmentsIn;
+	public uint FragmentsOut;
+	public uint Received;
+	public uint Lost;
+	public long ClientTime;
+	public uint Tick;
+	public long TickTime;
 
 	public void Serialize(BinaryWriter buffer) {
 		buffer.Write(this.Time);
 		buffer.Write(this.Latency);
+		buffer.Write(this.RTTMin);
+		buffer.Write(this.RTTMax);
+		buffer.Write(this.Jitter);
+		buffer.Write(this.LossIn);
+		buffer.Write(this.LossOut);
+		buffer.Write(this.BytesInPerSec);
+		buffer.Write(this.BytesOutPerSec);
+		buffer.Write(this.FragmentsIn);
+		buffer.Write(this.FragmentsOut);
+		buffer.Write(this.Received);
+		buffer.Write(this.Lost);
+		buffer.Write(this.ClientTime);
+		buffer.Write(this.Tick);
+		buffer.Write(this.TickTime);
 	}
 
 	public void Deserialize(BinaryReader buffer) {
 		this.Time = buffer.ReadInt64();
 		this.Latency = buffer.ReadInt64();
+		this.RTTMin = buffer.ReadInt64();
+		this.RTTMax = buffer.ReadInt64();
+		this.Jitter = buffer.ReadInt64();
+		this.LossIn = buffer.ReadUInt16();
+		this.LossOut = buffer.ReadUInt16();
+		this.BytesInPerSec = buffer.ReadUInt32();
+		this.BytesOutPerSec = buffer.ReadUInt32();
+		this.FragmentsIn = buffer.ReadUInt32();
+		this.FragmentsOut = buffer.ReadUInt32();
+		this.Received = buffer.ReadUInt32();
+		this.Lost = buffer.ReadUInt32();
+		this.ClientTime = buffer.ReadInt64();
+		this.Tick = buffer.ReadUInt32();
+		this.TickTime = buffer.ReadInt64();
 	}
 }
 
 public class Connected : INet {
+	public byte[] PublicKey;
+	public byte Resumed;
 
 	public void Serialize(BinaryWriter buffer) {
+		buffer.Write((Int32)this.PublicKey.Length);
+		for (int v2 = 0; v2 < this.PublicKey.Length; v2++) {
+			buffer.Write(this.PublicKey[v2]);
+		}
+		buffer.Write(this.Resumed);
 	}
 
 	public void Deserialize(BinaryReader buffer) {
+		int l0_1 = buffer.ReadInt32();
+		this.PublicKey = new byte[l0_1];
+		for (int v2 = 0; v2 < l0_1; v2++) {
+			this.PublicKey[v2] = buffer.ReadByte();
+		}
+		this.Resumed = buffer.ReadByte();
 	}
 }
 
@@ -165,11 +289,19 @@ public class CreateAcct : INet {
 public class CreateAcctResp : INet {
 	public uint AccountID;
 	public string Name;
+	public byte[] Token;
+	public string Reason;
 
 	public void Serialize(BinaryWriter buffer) {
 		buffer.Write(this.AccountID);
 		buffer.Write((Int32)this.Name.Length);
 		buffer.Write(System.Text.Encoding.UTF8.GetBytes(this.Name));
+		buffer.Write((Int32)this.Token.Length);
+		for (int v2 = 0; v2 < this.Token.Length; v2++) {
+			buffer.Write(this.Token[v2]);
+		}
+		buffer.Write((Int32)this.Reason.Length);
+		buffer.Write(System.Text.Encoding.UTF8.GetBytes(this.Reason));
 	}
 
 	public void Deserialize(BinaryReader buffer) {
@@ -177,6 +309,14 @@ public class CreateAcctResp : INet {
 		int l1_1 = buffer.ReadInt32();
 		byte[] temp1_1 = buffer.ReadBytes(l1_1);
 		this.Name = System.Text.Encoding.UTF8.GetString(temp1_1);
+		int l2_1 = buffer.ReadInt32();
+		this.Token = new byte[l2_1];
+		for (int v2 = 0; v2 < l2_1; v2++) {
+			this.Token[v2] = buffer.ReadByte();
+		}
+		int l3_1 = buffer.ReadInt32();
+		byte[] temp3_1 = buffer.ReadBytes(l3_1);
+		this.Reason = System.Text.Encoding.UTF8.GetString(temp3_1);
 	}
 }
 
@@ -205,12 +345,21 @@ public class LoginResp : INet {
 	public byte Success;
 	public string Name;
 	public uint AccountID;
+	public byte[] Token;
+	public byte Reason;
+	public uint RetryAfter;
 
 	public void Serialize(BinaryWriter buffer) {
 		buffer.Write(this.Success);
 		buffer.Write((Int32)this.Name.Length);
 		buffer.Write(System.Text.Encoding.UTF8.GetBytes(this.Name));
 		buffer.Write(this.AccountID);
+		buffer.Write((Int32)this.Token.Length);
+		for (int v2 = 0; v2 < this.Token.Length; v2++) {
+			buffer.Write(this.Token[v2]);
+		}
+		buffer.Write(this.Reason);
+		buffer.Write(this.RetryAfter);
 	}
 
 	public void Deserialize(BinaryReader buffer) {
@@ -219,15 +368,37 @@ public class LoginResp : INet {
 		byte[] temp1_1 = buffer.ReadBytes(l1_1);
 		this.Name = System.Text.Encoding.UTF8.GetString(temp1_1);
 		this.AccountID = buffer.ReadUInt32();
+		int l3_1 = buffer.ReadInt32();
+		this.Token = new byte[l3_1];
+		for (int v2 = 0; v2 < l3_1; v2++) {
+			this.Token[v2] = buffer.ReadByte();
+		}
+		this.Reason = buffer.ReadByte();
+		this.RetryAfter = buffer.ReadUInt32();
 	}
 }
 
 public class JoinGame : INet {
+	public byte Private;
+	public string Code;
+	public uint GameID;
+	public byte Spectate;
 
 	public void Serialize(BinaryWriter buffer) {
+		buffer.Write(this.Private);
+		buffer.Write((Int32)this.Code.Length);
+		buffer.Write(System.Text.Encoding.UTF8.GetBytes(this.Code));
+		buffer.Write(this.GameID);
+		buffer.Write(this.Spectate);
 	}
 
 	public void Deserialize(BinaryReader buffer) {
+		this.Private = buffer.ReadByte();
+		int l1_1 = buffer.ReadInt32();
+		byte[] temp1_1 = buffer.ReadBytes(l1_1);
+		this.Code = System.Text.Encoding.UTF8.GetString(temp1_1);
+		this.GameID = buffer.ReadUInt32();
+		this.Spectate = buffer.ReadByte();
 	}
 }
 
@@ -237,6 +408,7 @@ public class GameConnected : INet {
 	public uint TickID;
 	public Entity[] Entities;
 	public Snake[] Snakes;
+	public string Code;
 
 	public void Serialize(BinaryWriter buffer) {
 		buffer.Write(this.ID);
@@ -250,6 +422,8 @@ public class GameConnected : INet {
 		for (int v2 = 0; v2 < this.Snakes.Length; v2++) {
 			this.Snakes[v2].Serialize(buffer);
 		}
+		buffer.Write((Int32)this.Code.Length);
+		buffer.Write(System.Text.Encoding.UTF8.GetBytes(this.Code));
 	}
 
 	public void Deserialize(BinaryReader buffer) {
@@ -268,6 +442,9 @@ public class GameConnected : INet {
 			this.Snakes[v2] = new Snake();
 			this.Snakes[v2].Deserialize(buffer);
 		}
+		int l5_1 = buffer.ReadInt32();
+		byte[] temp5_1 = buffer.ReadBytes(l5_1);
+		this.Code = System.Text.Encoding.UTF8.GetString(temp5_1);
 	}
 }
 
@@ -441,6 +618,472 @@ public class Vect2 : INet {
 	}
 }
 
+public class Connect : INet {
+	public byte[] Cookie;
+	public byte[] Token;
+	public byte[] Proof;
+
+	public void Serialize(BinaryWriter buffer) {
+		buffer.Write((Int32)this.Cookie.Length);
+		for (int v2 = 0; v2 < this.Cookie.Length; v2++) {
+			buffer.Write(this.Cookie[v2]);
+		}
+		buffer.Write((Int32)this.Token.Length);
+		for (int v2 = 0; v2 < this.Token.Length; v2++) {
+			buffer.Write(this.Token[v2]);
+		}
+		buffer.Write((Int32)this.Proof.Length);
+		for (int v2 = 0; v2 < this.Proof.Length; v2++) {
+			buffer.Write(this.Proof[v2]);
+		}
+	}
+
+	public void Deserialize(BinaryReader buffer) {
+		int l0_1 = buffer.ReadInt32();
+		this.Cookie = new byte[l0_1];
+		for (int v2 = 0; v2 < l0_1; v2++) {
+			this.Cookie[v2] = buffer.ReadByte();
+		}
+		int l1_1 = buffer.ReadInt32();
+		this.Token = new byte[l1_1];
+		for (int v2 = 0; v2 < l1_1; v2++) {
+			this.Token[v2] = buffer.ReadByte();
+		}
+		int l2_1 = buffer.ReadInt32();
+		this.Proof = new byte[l2_1];
+		for (int v2 = 0; v2 < l2_1; v2++) {
+			this.Proof[v2] = buffer.ReadByte();
+		}
+	}
+}
+
+public class ConnectChallenge : INet {
+	public byte[] Cookie;
+
+	public void Serialize(BinaryWriter buffer) {
+		buffer.Write((Int32)this.Cookie.Length);
+		for (int v2 = 0; v2 < this.Cookie.Length; v2++) {
+			buffer.Write(this.Cookie[v2]);
+		}
+	}
+
+	public void Deserialize(BinaryReader buffer) {
+		int l0_1 = buffer.ReadInt32();
+		this.Cookie = new byte[l0_1];
+		for (int v2 = 0; v2 < l0_1; v2++) {
+			this.Cookie[v2] = buffer.ReadByte();
+		}
+	}
+}
+
+public class SessionKey : INet {
+	public byte[] Key;
+
+	public void Serialize(BinaryWriter buffer) {
+		buffer.Write((Int32)this.Key.Length);
+		for (int v2 = 0; v2 < this.Key.Length; v2++) {
+			buffer.Write(this.Key[v2]);
+		}
+	}
+
+	public void Deserialize(BinaryReader buffer) {
+		int l0_1 = buffer.ReadInt32();
+		this.Key = new byte[l0_1];
+		for (int v2 = 0; v2 < l0_1; v2++) {
+			this.Key[v2] = buffer.ReadByte();
+		}
+	}
+}
+
+public class SessionKeyAck : INet {
+
+	public void Serialize(BinaryWriter buffer) {
+	}
+
+	public void Deserialize(BinaryReader buffer) {
+	}
+}
+
+public class Encrypted : INet {
+	public ulong Seq;
+	public byte[] Data;
+
+	public void Serialize(BinaryWriter buffer) {
+		buffer.Write(this.Seq);
+		buffer.Write((Int32)this.Data.Length);
+		for (int v2 = 0; v2 < this.Data.Length; v2++) {
+			buffer.Write(this.Data[v2]);
+		}
+	}
+
+	public void Deserialize(BinaryReader buffer) {
+		this.Seq = buffer.ReadUInt64();
+		int l1_1 = buffer.ReadInt32();
+		this.Data = new byte[l1_1];
+		for (int v2 = 0; v2 < l1_1; v2++) {
+			this.Data[v2] = buffer.ReadByte();
+		}
+	}
+}
+
+public class Warning : INet {
+	public string Reason;
+
+	public void Serialize(BinaryWriter buffer) {
+		buffer.Write((Int32)this.Reason.Length);
+		buffer.Write(System.Text.Encoding.UTF8.GetBytes(this.Reason));
+	}
+
+	public void Deserialize(BinaryReader buffer) {
+		int l0_1 = buffer.ReadInt32();
+		byte[] temp0_1 = buffer.ReadBytes(l0_1);
+		this.Reason = System.Text.Encoding.UTF8.GetString(temp0_1);
+	}
+}
+
+public class MTUProbe : INet {
+	public ushort Size;
+	public byte[] Padding;
+
+	public void Serialize(BinaryWriter buffer) {
+		buffer.Write(this.Size);
+		buffer.Write((Int32)this.Padding.Length);
+		for (int v2 = 0; v2 < this.Padding.Length; v2++) {
+			buffer.Write(this.Padding[v2]);
+		}
+	}
+
+	public void Deserialize(BinaryReader buffer) {
+		this.Size = buffer.ReadUInt16();
+		int l1_1 = buffer.ReadInt32();
+		this.Padding = new byte[l1_1];
+		for (int v2 = 0; v2 < l1_1; v2++) {
+			this.Padding[v2] = buffer.ReadByte();
+		}
+	}
+}
+
+public class MTUProbeAck : INet {
+	public ushort Size;
+
+	public void Serialize(BinaryWriter buffer) {
+		buffer.Write(this.Size);
+	}
+
+	public void Deserialize(BinaryReader buffer) {
+		this.Size = buffer.ReadUInt16();
+	}
+}
+
+public class JoinGameFailed : INet {
+	public string Reason;
+
+	public void Serialize(BinaryWriter buffer) {
+		buffer.Write((Int32)this.Reason.Length);
+		buffer.Write(System.Text.Encoding.UTF8.GetBytes(this.Reason));
+	}
+
+	public void Deserialize(BinaryReader buffer) {
+		int l0_1 = buffer.ReadInt32();
+		byte[] temp0_1 = buffer.ReadBytes(l0_1);
+		this.Reason = System.Text.Encoding.UTF8.GetString(temp0_1);
+	}
+}
+
+public class GuestLogin : INet {
+
+	public void Serialize(BinaryWriter buffer) {
+	}
+
+	public void Deserialize(BinaryReader buffer) {
+	}
+}
+
+public class PlayerStats : INet {
+	public string Name;
+	public uint GamesPlayed;
+	public uint Kills;
+	public uint Deaths;
+	public uint PeakLength;
+	public uint FoodEaten;
+	public uint TimeAlive;
+
+	public void Serialize(BinaryWriter buffer) {
+		buffer.Write((Int32)this.Name.Length);
+		buffer.Write(System.Text.Encoding.UTF8.GetBytes(this.Name));
+		buffer.Write(this.GamesPlayed);
+		buffer.Write(this.Kills);
+		buffer.Write(this.Deaths);
+		buffer.Write(this.PeakLength);
+		buffer.Write(this.FoodEaten);
+		buffer.Write(this.TimeAlive);
+	}
+
+	public void Deserialize(BinaryReader buffer) {
+		int l0_1 = buffer.ReadInt32();
+		byte[] temp0_1 = buffer.ReadBytes(l0_1);
+		this.Name = System.Text.Encoding.UTF8.GetString(temp0_1);
+		this.GamesPlayed = buffer.ReadUInt32();
+		this.Kills = buffer.ReadUInt32();
+		this.Deaths = buffer.ReadUInt32();
+		this.PeakLength = buffer.ReadUInt32();
+		this.FoodEaten = buffer.ReadUInt32();
+		this.TimeAlive = buffer.ReadUInt32();
+	}
+}
+
+public class TopPlayersReq : INet {
+	public byte Stat;
+	public byte Daily;
+
+	public void Serialize(BinaryWriter buffer) {
+		buffer.Write(this.Stat);
+		buffer.Write(this.Daily);
+	}
+
+	public void Deserialize(BinaryReader buffer) {
+		this.Stat = buffer.ReadByte();
+		this.Daily = buffer.ReadByte();
+	}
+}
+
+public class TopPlayers : INet {
+	public byte Stat;
+	public byte Daily;
+	public PlayerStats[] Players;
+
+	public void Serialize(BinaryWriter buffer) {
+		buffer.Write(this.Stat);
+		buffer.Write(this.Daily);
+		buffer.Write((Int32)this.Players.Length);
+		for (int v2 = 0; v2 < this.Players.Length; v2++) {
+			this.Players[v2].Serialize(buffer);
+		}
+	}
+
+	public void Deserialize(BinaryReader buffer) {
+		this.Stat = buffer.ReadByte();
+		this.Daily = buffer.ReadByte();
+		int l2_1 = buffer.ReadInt32();
+		this.Players = new PlayerStats[l2_1];
+		for (int v2 = 0; v2 < l2_1; v2++) {
+			this.Players[v2] = new PlayerStats();
+			this.Players[v2].Deserialize(buffer);
+		}
+	}
+}
+
+public class LeaderboardEntry : INet {
+	public uint SnakeID;
+	public string Name;
+	public int Size;
+
+	public void Serialize(BinaryWriter buffer) {
+		buffer.Write(this.SnakeID);
+		buffer.Write((Int32)this.Name.Length);
+		buffer.Write(System.Text.Encoding.UTF8.GetBytes(this.Name));
+		buffer.Write(this.Size);
+	}
+
+	public void Deserialize(BinaryReader buffer) {
+		this.SnakeID = buffer.ReadUInt32();
+		int l1_1 = buffer.ReadInt32();
+		byte[] temp1_1 = buffer.ReadBytes(l1_1);
+		this.Name = System.Text.Encoding.UTF8.GetString(temp1_1);
+		this.Size = buffer.ReadInt32();
+	}
+}
+
+public class Leaderboard : INet {
+	public LeaderboardEntry[] Entries;
+	public uint Rank;
+	public uint Players;
+
+	public void Serialize(BinaryWriter buffer) {
+		buffer.Write((Int32)this.Entries.Length);
+		for (int v2 = 0; v2 < this.Entries.Length; v2++) {
+			this.Entries[v2].Serialize(buffer);
+		}
+		buffer.Write(this.Rank);
+		buffer.Write(this.Players);
+	}
+
+	public void Deserialize(BinaryReader buffer) {
+		int l0_1 = buffer.ReadInt32();
+		this.Entries = new LeaderboardEntry[l0_1];
+		for (int v2 = 0; v2 < l0_1; v2++) {
+			this.Entries[v2] = new LeaderboardEntry();
+			this.Entries[v2].Deserialize(buffer);
+		}
+		this.Rank = buffer.ReadUInt32();
+		this.Players = buffer.ReadUInt32();
+	}
+}
+
+public class MinimapSnake : INet {
+	public uint ID;
+	public int X;
+	public int Y;
+	public int Size;
+
+	public void Serialize(BinaryWriter buffer) {
+		buffer.Write(this.ID);
+		buffer.Write(this.X);
+		buffer.Write(this.Y);
+		buffer.Write(this.Size);
+	}
+
+	public void Deserialize(BinaryReader buffer) {
+		this.ID = buffer.ReadUInt32();
+		this.X = buffer.ReadInt32();
+		this.Y = buffer.ReadInt32();
+		this.Size = buffer.ReadInt32();
+	}
+}
+
+public class Minimap : INet {
+	public ushort Cells;
+	public int MapSize;
+	public byte[] Food;
+	public MinimapSnake[] Snakes;
+
+	public void Serialize(BinaryWriter buffer) {
+		buffer.Write(this.Cells);
+		buffer.Write(this.MapSize);
+		buffer.Write((Int32)this.Food.Length);
+		for (int v2 = 0; v2 < this.Food.Length; v2++) {
+			buffer.Write(this.Food[v2]);
+		}
+		buffer.Write((Int32)this.Snakes.Length);
+		for (int v2 = 0; v2 < this.Snakes.Length; v2++) {
+			this.Snakes[v2].Serialize(buffer);
+		}
+	}
+
+	public void Deserialize(BinaryReader buffer) {
+		this.Cells = buffer.ReadUInt16();
+		this.MapSize = buffer.ReadInt32();
+		int l2_1 = buffer.ReadInt32();
+		this.Food = new byte[l2_1];
+		for (int v2 = 0; v2 < l2_1; v2++) {
+			this.Food[v2] = buffer.ReadByte();
+		}
+		int l3_1 = buffer.ReadInt32();
+		this.Snakes = new MinimapSnake[l3_1];
+		for (int v2 = 0; v2 < l3_1; v2++) {
+			this.Snakes[v2] = new MinimapSnake();
+			this.Snakes[v2].Deserialize(buffer);
+		}
+	}
+}
+
+public class ChatSend : INet {
+	public byte Channel;
+	public string Text;
+
+	public void Serialize(BinaryWriter buffer) {
+		buffer.Write(this.Channel);
+		buffer.Write((Int32)this.Text.Length);
+		buffer.Write(System.Text.Encoding.UTF8.GetBytes(this.Text));
+	}
+
+	public void Deserialize(BinaryReader buffer) {
+		this.Channel = buffer.ReadByte();
+		int l1_1 = buffer.ReadInt32();
+		byte[] temp1_1 = buffer.ReadBytes(l1_1);
+		this.Text = System.Text.Encoding.UTF8.GetString(temp1_1);
+	}
+}
+
+public class Chat : INet {
+	public byte Channel;
+	public string From;
+	public uint SnakeID;
+	public string Text;
+
+	public void Serialize(BinaryWriter buffer) {
+		buffer.Write(this.Channel);
+		buffer.Write((Int32)this.From.Length);
+		buffer.Write(System.Text.Encoding.UTF8.GetBytes(this.From));
+		buffer.Write(this.SnakeID);
+		buffer.Write((Int32)this.Text.Length);
+		buffer.Write(System.Text.Encoding.UTF8.GetBytes(this.Text));
+	}
+
+	public void Deserialize(BinaryReader buffer) {
+		this.Channel = buffer.ReadByte();
+		int l1_1 = buffer.ReadInt32();
+		byte[] temp1_1 = buffer.ReadBytes(l1_1);
+		this.From = System.Text.Encoding.UTF8.GetString(temp1_1);
+		this.SnakeID = buffer.ReadUInt32();
+		int l3_1 = buffer.ReadInt32();
+		byte[] temp3_1 = buffer.ReadBytes(l3_1);
+		this.Text = System.Text.Encoding.UTF8.GetString(temp3_1);
+	}
+}
+
+public class ChatMuted : INet {
+	public uint Seconds;
+	public string Reason;
+
+	public void Serialize(BinaryWriter buffer) {
+		buffer.Write(this.Seconds);
+		buffer.Write((Int32)this.Reason.Length);
+		buffer.Write(System.Text.Encoding.UTF8.GetBytes(this.Reason));
+	}
+
+	public void Deserialize(BinaryReader buffer) {
+		this.Seconds = buffer.ReadUInt32();
+		int l1_1 = buffer.ReadInt32();
+		byte[] temp1_1 = buffer.ReadBytes(l1_1);
+		this.Reason = System.Text.Encoding.UTF8.GetString(temp1_1);
+	}
+}
+
+public class Spectate : INet {
+	public uint SnakeID;
+
+	public void Serialize(BinaryWriter buffer) {
+		buffer.Write(this.SnakeID);
+	}
+
+	public void Deserialize(BinaryReader buffer) {
+		this.SnakeID = buffer.ReadUInt32();
+	}
+}
+
+public class Spectating : INet {
+	public uint SnakeID;
+
+	public void Serialize(BinaryWriter buffer) {
+		buffer.Write(this.SnakeID);
+	}
+
+	public void Deserialize(BinaryReader buffer) {
+		this.SnakeID = buffer.ReadUInt32();
+	}
+}
+
+public class AreaFood : INet {
+	public Entity[] Food;
+
+	public void Serialize(BinaryWriter buffer) {
+		buffer.Write((Int32)this.Food.Length);
+		for (int v2 = 0; v2 < this.Food.Length; v2++) {
+			this.Food[v2].Serialize(buffer);
+		}
+	}
+
+	public void Deserialize(BinaryReader buffer) {
+		int l0_1 = buffer.ReadInt32();
+		this.Food = new Entity[l0_1];
+		for (int v2 = 0; v2 < l0_1; v2++) {
+			this.Food[v2] = new Entity();
+			this.Food[v2].Deserialize(buffer);
+		}
+	}
+}
+
 public class A : INet {
 	public string Name;
 	public long BirthDay;
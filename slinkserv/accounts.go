@@ -0,0 +1,261 @@
+package slinkserv
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"os"
+	"sync"
+)
+
+// Errors returned by an AccountStore.
+var (
+	ErrAccountExists = errors.New("slinkserv: account name is taken")
+	ErrNoAccount     = errors.New("slinkserv: no such account")
+)
+
+// AccountStore keeps the accounts players log in with.
+// Implementations must be safe to use from multiple goroutines.
+type AccountStore interface {
+	// Create adds a new account with the next free ID. Returns ErrAccountExists if the name is taken.
+	Create(name, passwordHash string) (*Account, error)
+	// ByName looks up an account, returning ErrNoAccount if there isn't one.
+	ByName(name string) (*Account, error)
+	// Update saves changes made to an account returned by the store.
+	Update(acct *Account) error
+	// Each calls fn with every account. The store is locked while it runs so fn mustn't use it.
+	Each(fn func(*Account))
+	// Close releases anything the store holds open.
+	Close() error
+}
+
+// MemoryStore keeps accounts in memory only, they are gone when the server stops.
+type MemoryStore struct {
+	mu     sync.Mutex
+	byName map[string]*Account
+	lastID uint32
+}
+
+// NewMemoryStore creates an empty in-memory account store.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{byName: map[string]*Account{}}
+}
+
+// Create implements AccountStore.
+func (ms *MemoryStore) Create(name, passwordHash string) (*Account, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	return ms.add(name, passwordHash)
+}
+
+func (ms *MemoryStore) add(name, passwordHash string) (*Account, error) {
+	if _, ok := ms.byName[name]; ok {
+		return nil, ErrAccountExists
+	}
+	ms.lastID++
+	acct := &Account{ID: ms.lastID, Name: name, PasswordHash: passwordHash}
+	ms.byName[name] = acct
+	return acct, nil
+}
+
+// ByName implements AccountStore.
+func (ms *MemoryStore) ByName(name string) (*Account, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	if acct, ok := ms.byName[name]; ok {
+		return acct, nil
+	}
+	return nil, ErrNoAccount
+}
+
+// Update implements AccountStore, the account is already up to date in memory.
+func (ms *MemoryStore) Update(acct *Account) error {
+	return nil
+}
+
+// Each implements AccountStore.
+func (ms *MemoryStore) Each(fn func(*Account)) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	for _, acct := range ms.byName {
+		fn(acct)
+	}
+}
+
+// Close implements AccountStore, there is nothing to release.
+func (ms *MemoryStore) Close() error {
+	return nil
+}
+
+// FileStore keeps accounts in memory and appends every change to a log file as a line of JSON,
+// so they survive a restart. Opening the store replays the log, later lines for an account
+// replace earlier ones. A line cut off by a crash part way through a write is dropped.
+// Whenever the log grows to several times the number of accounts, when it is opened or as it
+// is written to, it is rewritten with one line each.
+type FileStore struct {
+	mem     *MemoryStore
+	path    string
+	file    *os.File
+	records int // Lines in the log.
+}
+
+// OpenFileStore loads the accounts logged in path, creating the file if it doesn't exist.
+func OpenFileStore(path string) (*FileStore, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+	fs := &FileStore{mem: NewMemoryStore(), path: path, file: f}
+	good, records, err := fs.replay(f)
+	fs.records = records
+	if err == nil && fs.needsCompact() {
+		err = fs.compact()
+	} else if err == nil {
+		// Cut off any partial line so new records start cleanly.
+		err = f.Truncate(good)
+		if err == nil {
+			_, err = f.Seek(good, io.SeekStart)
+		}
+	}
+	if err != nil {
+		fs.file.Close()
+		return nil, err
+	}
+	return fs, nil
+}
+
+// compactSlack stops small logs from being rewritten over just a few updates.
+const compactSlack = 100
+
+func (fs *FileStore) needsCompact() bool {
+	return fs.records > 2*len(fs.mem.byName)+compactSlack
+}
+
+// replay loads every complete record in r, returning the offset just past the last one
+// and how many records there were.
+func (fs *FileStore) replay(r io.Reader) (int64, int, error) {
+	br := bufio.NewReader(r)
+	var good int64
+	records := 0
+	for {
+		line, err := br.ReadBytes('\n')
+		if err == io.EOF {
+			return good, records, nil
+		} else if err != nil {
+			return good, records, err
+		}
+		acct := &Account{}
+		if err := json.Unmarshal(line, acct); err != nil {
+			return good, records, err
+		}
+		good += int64(len(line))
+		records++
+		fs.mem.byName[acct.Name] = acct
+		if acct.ID > fs.mem.lastID {
+			fs.mem.lastID = acct.ID
+		}
+	}
+}
+
+// Create implements AccountStore. The account is only kept if it was written to the log.
+func (fs *FileStore) Create(name, passwordHash string) (*Account, error) {
+	fs.mem.mu.Lock()
+	defer fs.mem.mu.Unlock()
+	acct, err := fs.mem.add(name, passwordHash)
+	if err != nil {
+		return nil, err
+	}
+	if err := fs.write(acct); err != nil {
+		delete(fs.mem.byName, name)
+		fs.mem.lastID--
+		return nil, err
+	}
+	return acct, nil
+}
+
+// compact replaces the log with one holding just the latest record for each account.
+// The new log is written beside the old one and renamed over it, so a crash leaves one or the other.
+// If it fails the old log is kept and written to as before.
+func (fs *FileStore) compact() error {
+	tmpPath := fs.path + ".tmp"
+	tmp, err := os.OpenFile(tmpPath, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	err = fs.writeAll(tmp)
+	if err == nil {
+		err = os.Rename(tmpPath, fs.path)
+	}
+	if err != nil {
+		tmp.Close()
+		os.Remove(tmpPath)
+		return err
+	}
+	fs.file.Close()
+	fs.file = tmp
+	fs.records = len(fs.mem.byName)
+	return nil
+}
+
+// writeAll writes the latest record for every account to f and syncs it.
+func (fs *FileStore) writeAll(f *os.File) error {
+	bw := bufio.NewWriter(f)
+	enc := json.NewEncoder(bw)
+	for _, acct := range fs.mem.byName {
+		if err := enc.Encode(acct); err != nil {
+			return err
+		}
+	}
+	if err := bw.Flush(); err != nil {
+		return err
+	}
+	return f.Sync()
+}
+
+// write appends acct to the log, compacting it if it has grown too big. Must be called with the lock held.
+func (fs *FileStore) write(acct *Account) error {
+	line, err := json.Marshal(acct)
+	if err != nil {
+		return err
+	}
+	if _, err := fs.file.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	if err := fs.file.Sync(); err != nil {
+		return err
+	}
+	fs.records++
+	if fs.needsCompact() {
+		// The record is already safe in the old log, so a failure here only means trying again later.
+		if err := fs.compact(); err != nil {
+			log.Printf("Failed to compact account log: %s", err)
+		}
+	}
+	return nil
+}
+
+// ByName implements AccountStore.
+func (fs *FileStore) ByName(name string) (*Account, error) {
+	return fs.mem.ByName(name)
+}
+
+// Update implements AccountStore, appending the account's new state to the log.
+func (fs *FileStore) Update(acct *Account) error {
+	fs.mem.mu.Lock()
+	defer fs.mem.mu.Unlock()
+	return fs.write(acct)
+}
+
+// Each implements AccountStore.
+func (fs *FileStore) Each(fn func(*Account)) {
+	fs.mem.Each(fn)
+}
+
+// Close implements AccountStore, closing the log file.
+func (fs *FileStore) Close() error {
+	fs.mem.mu.Lock()
+	defer fs.mem.mu.Unlock()
+	return fs.file.Close()
+}
@@ -0,0 +1,173 @@
+package slinkserv
+
+import (
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// defaultPasswordIterations is the PBKDF2 work factor for new password hashes.
+const defaultPasswordIterations = 600000
+
+const (
+	saltLen     = 16
+	passwordKey = 32
+	hashScheme  = "pbkdf2-sha256"
+)
+
+var errBadHash = errors.New("slinkserv: malformed password hash")
+
+// hashPassword derives a salted hash of password, stored as "pbkdf2-sha256$iterations$salt$key".
+// The iterations are kept with the hash so the work factor can be raised without breaking old accounts.
+func hashPassword(password string, iterations int) (string, error) {
+	if iterations <= 0 {
+		iterations = defaultPasswordIterations
+	}
+	salt := make([]byte, saltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	key, err := pbkdf2.Key(sha256.New, password, salt, iterations, passwordKey)
+	if err != nil {
+		return "", err
+	}
+	enc := base64.RawStdEncoding
+	return fmt.Sprintf("%s$%d$%s$%s", hashScheme, iterations, enc.EncodeToString(salt), enc.EncodeToString(key)), nil
+}
+
+// dummyHash is a well formed hash no password matches, used to spend the same time on unknown accounts.
+func dummyHash(iterations int) string {
+	if iterations <= 0 {
+		iterations = defaultPasswordIterations
+	}
+	enc := base64.RawStdEncoding
+	return fmt.Sprintf("%s$%d$%s$%s", hashScheme, iterations, enc.EncodeToString(make([]byte, saltLen)), enc.EncodeToString(make([]byte, passwordKey)))
+}
+
+// checkPassword reports whether password matches a hash from hashPassword, comparing in constant time.
+func checkPassword(hash, password string) (bool, error) {
+	parts := strings.Split(hash, "$")
+	if len(parts) != 4 || parts[0] != hashScheme {
+		return false, errBadHash
+	}
+	iterations, err := strconv.Atoi(parts[1])
+	if err != nil || iterations <= 0 {
+		return false, errBadHash
+	}
+	enc := base64.RawStdEncoding
+	salt, err := enc.DecodeString(parts[2])
+	if err != nil {
+		return false, errBadHash
+	}
+	want, err := enc.DecodeString(parts[3])
+	if err != nil || len(want) == 0 {
+		return false, errBadHash
+	}
+	key, err := pbkdf2.Key(sha256.New, password, salt, iterations, len(want))
+	if err != nil {
+		return false, err
+	}
+	return subtle.ConstantTimeCompare(key, want) == 1, nil
+}
+
+// LoginLimits configures how failed logins are throttled. Once an account or address has
+// failed more times than it is allowed it is locked out for Lockout, doubling with every
+// further failure up to MaxLockout. Failures are forgotten after MaxLockout without one.
+type LoginLimits struct {
+	AccountFailures int // Failed logins allowed for one account name, 0 disables the limit.
+	AddressFailures int // Failed logins allowed from one IP, higher since players can share an address.
+	Lockout         time.Duration
+	MaxLockout      time.Duration
+}
+
+// DefaultLoginLimits slow down password guessing without getting in the way of typos.
+func DefaultLoginLimits() LoginLimits {
+	return LoginLimits{
+		AccountFailures: 5,
+		AddressFailures: 20,
+		Lockout:         time.Second,
+		MaxLockout:      5 * time.Minute,
+	}
+}
+
+type loginFailures struct {
+	count int
+	last  time.Time // Most recent failure.
+	until time.Time // Locked out until then.
+}
+
+// loginThrottle tracks failed logins by account name and by address. Only used by the manager.
+type loginThrottle struct {
+	limits    LoginLimits
+	accounts  map[string]*loginFailures
+	addresses map[string]*loginFailures
+}
+
+func newLoginThrottle(limits LoginLimits) *loginThrottle {
+	return &loginThrottle{
+		limits:    limits,
+		accounts:  map[string]*loginFailures{},
+		addresses: map[string]*loginFailures{},
+	}
+}
+
+// wait returns how long until name can be tried again from addr, 0 if it can be tried now.
+func (lt *loginThrottle) wait(name, addr string, now time.Time) time.Duration {
+	var wait time.Duration
+	for _, f := range []*loginFailures{lt.accounts[name], lt.addresses[addr]} {
+		if f != nil && f.until.Sub(now) > wait {
+			wait = f.until.Sub(now)
+		}
+	}
+	return wait
+}
+
+// failed records a failed login for name from addr.
+func (lt *loginThrottle) failed(name, addr string, now time.Time) {
+	lt.add(lt.accounts, name, lt.limits.AccountFailures, now)
+	lt.add(lt.addresses, addr, lt.limits.AddressFailures, now)
+}
+
+func (lt *loginThrottle) add(failures map[string]*loginFailures, key string, allowed int, now time.Time) {
+	if allowed <= 0 {
+		return
+	}
+	f := failures[key]
+	if f == nil || now.Sub(f.last) > lt.limits.MaxLockout {
+		f = &loginFailures{}
+		failures[key] = f
+	}
+	f.count++
+	f.last = now
+	if over := f.count - allowed; over >= 0 {
+		lockout := lt.limits.MaxLockout
+		if d := lt.limits.Lockout << uint(over); over < 32 && d > 0 && d < lockout {
+			lockout = d
+		}
+		f.until = now.Add(lockout)
+	}
+}
+
+// succeeded clears the failures for an account once its password is given.
+// The address keeps its failures so logging into one account can't reset guessing at others.
+func (lt *loginThrottle) succeeded(name string) {
+	delete(lt.accounts, name)
+}
+
+// expire forgets failures that are too old to matter.
+func (lt *loginThrottle) expire(now time.Time) {
+	for _, failures := range []map[string]*loginFailures{lt.accounts, lt.addresses} {
+		for key, f := range failures {
+			if now.Sub(f.last) > lt.limits.MaxLockout && !now.Before(f.until) {
+				delete(failures, key)
+			}
+		}
+	}
+}
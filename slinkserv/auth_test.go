@@ -0,0 +1,124 @@
+package slinkserv
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lologarithm/slink/slinkserv/messages"
+)
+
+func TestPasswordHash(t *testing.T) {
+	hash, err := hashPassword("hunter2", 1000)
+	if err != nil {
+		t.Fatalf("Failed to hash: %s", err)
+	}
+	if strings.Contains(hash, "hunter2") {
+		t.Fatalf("Hash contains the password: %s", hash)
+	}
+	if ok, err := checkPassword(hash, "hunter2"); !ok || err != nil {
+		t.Fatalf("Password didn't match its hash: %v", err)
+	}
+	if ok, _ := checkPassword(hash, "hunter3"); ok {
+		t.Fatalf("Wrong password matched.")
+	}
+	if again, _ := hashPassword("hunter2", 1000); again == hash {
+		t.Fatalf("Expected a new salt for every hash.")
+	}
+	if ok, _ := checkPassword(dummyHash(1000), ""); ok {
+		t.Fatalf("Dummy hash shouldn't match anything.")
+	}
+	if _, err := checkPassword("hunter2", "hunter2"); err != errBadHash {
+		t.Fatalf("Expected errBadHash for a plaintext hash, got %v", err)
+	}
+}
+
+func TestLoginThrottle(t *testing.T) {
+	lt := newLoginThrottle(LoginLimits{AccountFailures: 2, AddressFailures: 3, Lockout: time.Second, MaxLockout: 4 * time.Second})
+	now := time.Now().UTC()
+	lt.failed("alice", "1.1.1.1", now)
+	if wait := lt.wait("alice", "1.1.1.1", now); wait != 0 {
+		t.Fatalf("Locked out after one failure: %s", wait)
+	}
+	lt.failed("alice", "1.1.1.1", now)
+	if wait := lt.wait("alice", "2.2.2.2", now); wait != time.Second {
+		t.Fatalf("Expected the account to be locked for 1s, got %s", wait)
+	}
+	// The lockout doubles, up to the max.
+	lt.failed("alice", "2.2.2.2", now)
+	lt.failed("alice", "2.2.2.2", now)
+	lt.failed("alice", "2.2.2.2", now)
+	if wait := lt.wait("alice", "3.3.3.3", now); wait != 4*time.Second {
+		t.Fatalf("Expected the lockout to grow to 4s, got %s", wait)
+	}
+	// Guessing at other accounts from one address is caught too.
+	lt.failed("bob", "1.1.1.1", now)
+	if wait := lt.wait("carol", "1.1.1.1", now); wait != time.Second {
+		t.Fatalf("Expected the address to be locked for 1s, got %s", wait)
+	}
+	// A correct password clears the account, but not the address.
+	lt.succeeded("alice")
+	if lt.wait("alice", "3.3.3.3", now) != 0 || lt.wait("dave", "2.2.2.2", now) == 0 {
+		t.Fatalf("Expected only the account to be cleared.")
+	}
+	lt.expire(now.Add(5 * time.Second))
+	if len(lt.accounts)+len(lt.addresses) != 0 {
+		t.Fatalf("Expected old failures to be forgotten.")
+	}
+}
+
+func TestLogin(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.PasswordIterations = 1000
+	cfg.Logins.AccountFailures = 1
+	gm, clients := newTestManager(cfg, 2)
+	gm.accounts.Create("legacy", "")
+	legacy, _ := gm.accounts.ByName("legacy")
+	legacy.Password = "oldpass"
+
+	reply := func(id int) messages.Net {
+		(<-gm.hashFinished)()
+		msg, ok := clients[id].out.pop()
+		if !ok {
+			t.Fatalf("No reply for client %d", id)
+		}
+		return msg.msg.NetMsg
+	}
+	login := func(id int, name, password string) *messages.LoginResp {
+		gm.loginUser(GameMessage{client: clients[id], net: &messages.Login{Name: name, Password: password}})
+		return reply(id).(*messages.LoginResp)
+	}
+
+	gm.createAccount(GameMessage{client: clients[1], net: &messages.CreateAcct{Name: "alice", Password: "secret"}})
+	if resp := reply(1).(*messages.CreateAcctResp); resp.AccountID == 0 {
+		t.Fatalf("Failed to create account.")
+	}
+	if acct, _ := gm.accounts.ByName("alice"); acct.PasswordHash == "" || acct.Password != "" {
+		t.Fatalf("Expected only a hash of the password to be kept: %+v", acct)
+	}
+	if lr := login(2, "alice", "secret"); lr.Success != 1 || lr.Reason != messages.LoginOK || gm.Users[2].Account.Name != "alice" {
+		t.Fatalf("Expected to log in, got %+v", lr)
+	}
+	if lr := login(2, "nobody", "secret"); lr.Success != 0 || lr.Reason != messages.LoginBadCredentials {
+		t.Fatalf("Expected bad credentials for an unknown account, got %+v", lr)
+	}
+	if lr := login(2, "alice", "wrong"); lr.Reason != messages.LoginBadCredentials {
+		t.Fatalf("Expected bad credentials for a wrong password, got %+v", lr)
+	}
+	// Throttled logins are turned away without checking the password.
+	gm.loginUser(GameMessage{client: clients[2], net: &messages.Login{Name: "alice", Password: "secret"}})
+	if msg, _ := clients[2].out.pop(); msg.msg.NetMsg.(*messages.LoginResp).Reason != messages.LoginThrottled {
+		t.Fatalf("Expected the account to be throttled.")
+	}
+
+	// Plaintext passwords saved before hashing are upgraded on login.
+	if lr := login(1, "legacy", "oldpass"); lr.Success != 1 {
+		t.Fatalf("Expected to log in to a legacy account, got %+v", lr)
+	}
+	if legacy.Password != "" || legacy.PasswordHash == "" {
+		t.Fatalf("Expected the legacy password to be replaced with a hash: %+v", legacy)
+	}
+	if lr := login(1, "legacy", "oldpass"); lr.Success != 1 {
+		t.Fatalf("Expected to log in with the upgraded hash, got %+v", lr)
+	}
+}
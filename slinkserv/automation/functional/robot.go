@@ -1,6 +1,7 @@
 package main
 
 import (
+	"flag"
 	"log"
 	"os"
 	"os/signal"
@@ -10,15 +11,31 @@ import (
 )
 
 func main() {
+	flag.StringVar(&automation.ServerAddr, "server", automation.ServerAddr, "address of the server, or a netsim proxy in front of it")
+	private := flag.Bool("private", false, "start a private game and print its join code")
+	code := flag.String("code", "", "join the private game with this code")
+	game := flag.Uint("game", 0, "join the public game with this ID")
+	guest := flag.Bool("guest", false, "play as a guest instead of creating an account")
+	flag.Parse()
+
 	c := make(chan os.Signal, 1)
 	signal.Notify(c, os.Interrupt)
 
 	exit := make(chan int, 1)
 	mu := automation.NewMockUser()
+	mu.Join.Code = *code
+	mu.Join.GameID = uint32(*game)
+	if *private {
+		mu.Join.Private = 1
+	}
 	connected := automation.Connect(mu)
 
 	if connected {
-		automation.CreateAccount(mu, "testuser1", "testuser2")
+		if *guest {
+			automation.GuestLogin(mu)
+		} else {
+			automation.CreateAccount(mu, "testuser1", "testuser2")
+		}
 		go automation.ReadMessages(mu)
 		go automation.RunUser(mu, exit)
 	} else {
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"flag"
 	"log"
 	"os"
 	"os/signal"
@@ -14,6 +15,9 @@ import (
 var numClient = 500
 
 func main() {
+	flag.StringVar(&automation.ServerAddr, "server", automation.ServerAddr, "address of the server, or a netsim proxy in front of it")
+	flag.IntVar(&numClient, "clients", numClient, "number of mock users to run")
+	flag.Parse()
 	runtime.GOMAXPROCS(runtime.NumCPU())
 
 	c := make(chan os.Signal, 1)
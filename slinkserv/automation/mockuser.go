@@ -2,16 +2,22 @@ package automation
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"log"
 	"math/rand"
 	"net"
 	"os"
+	"sync"
 	"time"
 
+	"github.com/lologarithm/slink/slinkserv/clocksync"
 	"github.com/lologarithm/slink/slinkserv/messages"
 )
 
+// ServerAddr is where mock users connect, point it at a netsim proxy to play over a bad network.
+var ServerAddr = "localhost:24816"
+
 type MockUser struct {
 	alive           bool
 	conn            *net.UDPConn
@@ -21,14 +27,32 @@ type MockUser struct {
 	snakeID         uint32
 	startTick       uint32
 	startTime       time.Time
+	token           []byte                  // Session token from the server, used to resume after reconnecting.
+	cipher          *messages.SessionCipher // Set once the server acknowledges our session key.
+	seq             uint16                  // Seq of the last packet we sent.
+	received        messages.SeqTracker     // Seqs of packets from the server, reported back in heartbeats.
+	receivedMu      sync.Mutex
+	clock           *clocksync.Clock  // Estimates the server's tick so turns are stamped with it.
+	Join            messages.JoinGame // Sent once logged in, blank to be matched into a public game.
 }
 
+// tickLength is how often the server's games tick.
+const tickLength = 20 * time.Millisecond
+
+// Clock sync requests are sent quickly until the estimate has settled, then occasionally to follow drift.
+const (
+	syncFast     = 250 * time.Millisecond
+	syncSlow     = 5 * time.Second
+	syncSettleAt = 8
+)
+
 func NewMockUser() *MockUser {
 	return &MockUser{
 		alive:           true,
 		incoming:        make(chan messages.Packet, 100),
 		outgoing:        make(chan messages.Packet, 100),
 		partialMessages: map[uint32][]*messages.Multipart{},
+		clock:           clocksync.New(tickLength),
 	}
 }
 
@@ -37,37 +61,47 @@ func CreateAccount(mu *MockUser, user, pass string) {
 		Name:     user,
 		Password: pass,
 	})
-	_, err := mu.conn.Write(packet.Pack())
-	if err != nil {
-		fmt.Printf("Failed to write to connection.")
-		fmt.Println(err)
-	}
+	sendmsg(mu, packet)
+}
+
+// GuestLogin plays without an account, the server picks the name.
+func GuestLogin(mu *MockUser) {
+	sendmsg(mu, messages.NewPacket(messages.GuestLoginMsgType, &messages.GuestLogin{}))
 }
 
 func ReadMessages(mu *MockUser) {
-	widx := 0
-	buf := make([]byte, 1024)
+	datagram := make([]byte, 2048)
 	for mu.alive {
-		n, err := mu.conn.Read(buf[widx:])
+		n, err := mu.conn.Read(datagram)
 		if err != nil {
 			fmt.Printf("  %d Failed to read from conn: %s\n", mu.snakeID, err)
 			return
 		}
-		widx += n
-		for {
-			pack, ok := messages.NextPacket(buf[:widx])
+		data := datagram[:n]
+		if mu.cipher != nil {
+			plain, ok := mu.cipher.Open(data)
+			if !ok {
+				continue
+			}
+			data = plain
+		}
+		// Packets never span datagrams, so anything left that doesn't parse is thrown away with the datagram.
+		for len(data) > 0 {
+			pack, ok := messages.NextPacket(data)
 			if !ok {
 				break
 			}
-			copy(buf, buf[pack.Len():])
-			widx -= pack.Len()
+			data = data[pack.Len():]
+			mu.receivedMu.Lock()
+			mu.received.Track(pack.Frame.Seq)
+			mu.receivedMu.Unlock()
 			mu.incoming <- pack
 		}
 	}
 }
 
 func Connect(mu *MockUser) bool {
-	ra, err := net.ResolveUDPAddr("udp", "localhost:24816")
+	ra, err := net.ResolveUDPAddr("udp", ServerAddr)
 	if err != nil {
 		fmt.Println(err)
 		return false
@@ -78,9 +112,109 @@ func Connect(mu *MockUser) bool {
 		return false
 	}
 
+	return handshake(mu)
+}
+
+// Reconnect dials the server again from a new local address and resumes the user's session,
+// the same thing that happens when a player's network changes. ReadMessages has to be started
+// again afterwards since the old connection is closed.
+func Reconnect(mu *MockUser) bool {
+	old := mu.conn
+	if !Connect(mu) {
+		return false
+	}
+	old.Close()
 	return true
 }
 
+// cookieLen is the size of the cookie the server hands out, used to pad our first Connect.
+const cookieLen = 40
+
+// handshake trades a padded Connect for the server's cookie and echoes it back
+// until the server confirms the connection. If the server offers encryption we
+// send it a session key and wait for the sealed ack before returning.
+func handshake(mu *MockUser) bool {
+	// The old key proves the session token is ours when resuming.
+	old := mu.cipher
+	mu.cipher = nil
+	buf := make([]byte, 512)
+	cookie := make([]byte, cookieLen)
+	var pending *messages.SessionCipher
+	var sessionKey []byte
+	for attempt := 0; attempt < 5; attempt++ {
+		if pending == nil {
+			connect := &messages.Connect{Cookie: cookie, Token: mu.token}
+			if old != nil && len(mu.token) > 0 {
+				connect.Proof = old.ResumeProof(cookie)
+			}
+			sendmsg(mu, messages.NewPacket(messages.ConnectMsgType, connect))
+		} else {
+			sendmsg(mu, messages.NewPacket(messages.SessionKeyMsgType, &messages.SessionKey{Key: sessionKey}))
+		}
+		mu.conn.SetReadDeadline(time.Now().Add(time.Second))
+		n, err := mu.conn.Read(buf)
+		if err != nil {
+			continue
+		}
+		data := buf[:n]
+		if pending != nil {
+			if data, err = openDatagram(pending, data); err != nil {
+				continue
+			}
+		}
+		// The reply can share its datagram with other packets, so look through all of them.
+		for len(data) > 0 {
+			packet, ok := messages.NextPacket(data)
+			if !ok {
+				break
+			}
+			data = data[packet.Len():]
+			switch packet.Frame.MsgType {
+			case messages.ConnectChallengeMsgType:
+				cookie = packet.NetMsg.(*messages.ConnectChallenge).Cookie
+			case messages.ConnectedMsgType:
+				publicKey := packet.NetMsg.(*messages.Connected).PublicKey
+				if len(publicKey) == 0 {
+					mu.conn.SetReadDeadline(time.Time{})
+					return true
+				}
+				if pending != nil {
+					continue
+				}
+				var key []byte
+				if key, sessionKey, err = messages.NewSessionKey(publicKey); err != nil {
+					fmt.Printf("Failed to create session key: %s\n", err)
+					return false
+				}
+				if pending, err = messages.NewSessionCipher(key, false); err != nil {
+					fmt.Printf("Failed to create session cipher: %s\n", err)
+					return false
+				}
+				attempt = 0
+			case messages.SessionKeyAckMsgType:
+				mu.cipher = pending
+				mu.conn.SetReadDeadline(time.Time{})
+				return true
+			}
+		}
+	}
+	fmt.Printf("Failed to complete handshake with server.\n")
+	return false
+}
+
+// openDatagram opens a sealed datagram, anything that isn't sealed is passed through
+// since the server may still have plaintext in flight when it installs our key.
+func openDatagram(sc *messages.SessionCipher, data []byte) ([]byte, error) {
+	if packet, ok := messages.NextPacket(data); ok && packet.Frame.MsgType != messages.EncryptedMsgType {
+		return data, nil
+	}
+	plain, ok := sc.Open(data)
+	if !ok {
+		return nil, errors.New("unable to open datagram")
+	}
+	return plain, nil
+}
+
 func RunUser(mu *MockUser, exit chan int) {
 	go func() {
 		<-exit
@@ -88,10 +222,22 @@ func RunUser(mu *MockUser, exit chan int) {
 	}()
 
 	timeout := time.After(time.Millisecond * time.Duration(rand.Intn(500)+1000))
+	syncTimer := time.After(syncFast)
 	for mu.alive {
 		select {
+		case <-syncTimer:
+			sendmsg(mu, messages.NewPacket(messages.HeartbeatMsgType, mu.clock.Request(time.Now())))
+			if mu.clock.Samples() < syncSettleAt {
+				syncTimer = time.After(syncFast)
+			} else {
+				syncTimer = time.After(syncSlow)
+			}
 		case <-timeout:
-			tick := uint32((time.Now().UnixNano() - mu.startTime.UnixNano()) / int64(20*time.Millisecond))
+			tick := mu.clock.Tick(time.Now())
+			if tick == 0 {
+				// Not synced with the game yet, guess from when we joined.
+				tick = mu.startTick + uint32(time.Since(mu.startTime)/tickLength)
+			}
 			dir := int16(rand.Intn(2)) - 1
 			sendmsg(mu, messages.NewPacket(messages.TurnSnakeMsgType, &messages.TurnSnake{
 				TickID:    tick,
@@ -104,15 +250,31 @@ func RunUser(mu *MockUser, exit chan int) {
 	}
 
 	log.Printf("shutting down user.")
-	disconn := messages.NewPacket(messages.DisconnectedMsgType, &messages.Disconnected{})
-	disb := disconn.Pack()
-	mu.conn.Write(disb)
+	sendmsg(mu, messages.NewPacket(messages.DisconnectedMsgType, &messages.Disconnected{}))
 }
 
 func ProcessMessage(mu *MockUser, msg messages.Packet) {
 	switch msg.Frame.MsgType {
 	case messages.CreateAcctRespMsgType:
-		sendmsg(mu, messages.NewPacket(messages.JoinGameMsgType, &messages.JoinGame{}))
+		resp := msg.NetMsg.(*messages.CreateAcctResp)
+		if resp.AccountID == 0 {
+			log.Printf("Couldn't create account (%s), playing as a guest.", resp.Reason)
+			GuestLogin(mu)
+			break
+		}
+		mu.token = resp.Token
+		join := mu.Join
+		sendmsg(mu, messages.NewPacket(messages.JoinGameMsgType, &join))
+	case messages.LoginRespMsgType:
+		lr := msg.NetMsg.(*messages.LoginResp)
+		if lr.Success == 0 {
+			log.Printf("Login failed, reason %d, retry after %ds.", lr.Reason, lr.RetryAfter)
+			break
+		}
+		log.Printf("Logged in as %s.", lr.Name)
+		mu.token = lr.Token
+		join := mu.Join
+		sendmsg(mu, messages.NewPacket(messages.JoinGameMsgType, &join))
 	case messages.GameMasterFrameMsgType:
 		// tmsg := msg.NetMsg.(*messages.GameMasterFrame)
 		// fmt.Printf("\nServer Frame @ %d.\n---------------------------------\n", tmsg.Tick)
@@ -126,12 +288,24 @@ func ProcessMessage(mu *MockUser, msg messages.Packet) {
 		// }
 		// fmt.Printf("---------------------------------\n")
 	case messages.HeartbeatMsgType:
-		mu.conn.Write(msg.Pack())
+		hb := msg.NetMsg.(*messages.Heartbeat)
+		if mu.clock.Handle(hb, time.Now()) {
+			break
+		}
+		mu.receivedMu.Lock()
+		hb.Received, hb.Lost = mu.received.Received, mu.received.Lost
+		mu.receivedMu.Unlock()
+		sendmsg(mu, &msg)
 	case messages.GameConnectedMsgType:
 		gcmsg := msg.NetMsg.(*messages.GameConnected)
 		mu.snakeID = gcmsg.SnakeID
 		mu.startTick = gcmsg.TickID
 		mu.startTime = time.Now()
+		if gcmsg.Code != "" {
+			log.Printf("Joined private game %d, code %s", gcmsg.ID, gcmsg.Code)
+		}
+	case messages.JoinGameFailedMsgType:
+		log.Printf("Failed to join game: %s", msg.NetMsg.(*messages.JoinGameFailed).Reason)
 	case messages.SnakeDiedMsgType:
 		sdmsg := msg.NetMsg.(*messages.SnakeDied)
 		if sdmsg.ID == mu.snakeID {
@@ -139,12 +313,22 @@ func ProcessMessage(mu *MockUser, msg messages.Packet) {
 		}
 	case messages.MultipartMsgType:
 		handleMultipart(mu, msg)
+	case messages.MTUProbeMsgType:
+		sendmsg(mu, messages.NewPacket(messages.MTUProbeAckMsgType, &messages.MTUProbeAck{
+			Size: msg.NetMsg.(*messages.MTUProbe).Size,
+		}))
 	}
 
 }
 
 func sendmsg(mu *MockUser, msg *messages.Packet) {
-	_, err := mu.conn.Write(msg.Pack())
+	mu.seq++
+	msg.Frame.Seq = mu.seq
+	data := msg.Pack()
+	if mu.cipher != nil {
+		data = mu.cipher.Seal(data)
+	}
+	_, err := mu.conn.Write(data)
 	if err != nil {
 		fmt.Printf("Failed to write to connection.")
 		fmt.Println(err)
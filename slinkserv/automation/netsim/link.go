@@ -0,0 +1,121 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"math/rand"
+	"time"
+)
+
+// maxQueueDelay is how much traffic a bandwidth capped link buffers before it starts dropping,
+// like the queue in front of a slow router.
+const maxQueueDelay = 500 * time.Millisecond
+
+// Conditions describes one direction of a simulated network.
+type Conditions struct {
+	Latency      time.Duration // Base one way delay.
+	Jitter       time.Duration // Each datagram is delayed up to this much more or less than Latency.
+	Loss         float64       // Chance a datagram is dropped.
+	Duplicate    float64       // Chance a datagram is delivered twice.
+	Reorder      float64       // Chance a datagram is held back so the ones behind it overtake it.
+	ReorderDelay time.Duration // How long a reordered datagram is held back for.
+	Bandwidth    int           // Bytes per second, 0 for no cap.
+}
+
+// register adds flags for the conditions, prefixed with the direction they apply to.
+func (c *Conditions) register(fs *flag.FlagSet, dir string) {
+	fs.DurationVar(&c.Latency, dir+".latency", 0, "one way delay "+dir)
+	fs.DurationVar(&c.Jitter, dir+".jitter", 0, "random delay added or removed "+dir)
+	fs.Float64Var(&c.Loss, dir+".loss", 0, "chance (0-1) a datagram "+dir+" is dropped")
+	fs.Float64Var(&c.Duplicate, dir+".dup", 0, "chance (0-1) a datagram "+dir+" is delivered twice")
+	fs.Float64Var(&c.Reorder, dir+".reorder", 0, "chance (0-1) a datagram "+dir+" is delivered late, after ones sent behind it")
+	fs.DurationVar(&c.ReorderDelay, dir+".reorderdelay", 20*time.Millisecond, "how late reordered datagrams "+dir+" are")
+	fs.IntVar(&c.Bandwidth, dir+".bandwidth", 0, "bytes per second "+dir+", 0 for unlimited")
+}
+
+// linkStats counts what a link did to the datagrams sent through it.
+type linkStats struct {
+	Sent       int
+	Dropped    int // Lost to the loss setting.
+	Overflowed int // Dropped because the bandwidth queue was full.
+	Duplicated int
+	Reordered  int
+}
+
+func (ls *linkStats) add(other linkStats) {
+	ls.Sent += other.Sent
+	ls.Dropped += other.Dropped
+	ls.Overflowed += other.Overflowed
+	ls.Duplicated += other.Duplicated
+	ls.Reordered += other.Reordered
+}
+
+func (ls linkStats) String() string {
+	return fmt.Sprintf("%d sent, %d lost, %d overflowed, %d duplicated, %d reordered",
+		ls.Sent, ls.Dropped, ls.Overflowed, ls.Duplicated, ls.Reordered)
+}
+
+// link applies Conditions to one direction of one client's traffic.
+// It only decides when datagrams arrive, delivering them is up to the caller.
+type link struct {
+	cond  Conditions
+	rng   *rand.Rand
+	stats linkStats
+
+	busyUntil time.Time // When the link finishes putting queued bytes on the wire.
+	lastDue   time.Time // Arrival of the last datagram that wasn't reordered, later ones can't arrive before it.
+}
+
+func newLink(cond Conditions, rng *rand.Rand) *link {
+	return &link{cond: cond, rng: rng}
+}
+
+// schedule returns when a datagram of size bytes sent at now arrives, once per copy delivered.
+// Returns nothing if the datagram is lost.
+func (l *link) schedule(size int, now time.Time) []time.Time {
+	l.stats.Sent++
+	if l.cond.Loss > 0 && l.rng.Float64() < l.cond.Loss {
+		l.stats.Dropped++
+		return nil
+	}
+
+	depart := now
+	if l.cond.Bandwidth > 0 {
+		if l.busyUntil.After(depart) {
+			depart = l.busyUntil
+		}
+		if depart.Sub(now) >= maxQueueDelay {
+			l.stats.Overflowed++
+			return nil
+		}
+		depart = depart.Add(time.Duration(size) * time.Second / time.Duration(l.cond.Bandwidth))
+		l.busyUntil = depart
+	}
+
+	delay := l.cond.Latency
+	if l.cond.Jitter > 0 {
+		delay += time.Duration(l.rng.Int63n(int64(2*l.cond.Jitter)+1)) - l.cond.Jitter
+	}
+	if delay < 0 {
+		delay = 0
+	}
+	due := depart.Add(delay)
+
+	if l.cond.Reorder > 0 && l.rng.Float64() < l.cond.Reorder {
+		// Held back without moving lastDue so what is sent next can arrive first.
+		l.stats.Reordered++
+		due = due.Add(l.cond.ReorderDelay)
+	} else {
+		// Jitter alone doesn't reorder, a datagram waits for the one in front of it.
+		if due.Before(l.lastDue) {
+			due = l.lastDue
+		}
+		l.lastDue = due
+	}
+
+	if l.cond.Duplicate > 0 && l.rng.Float64() < l.cond.Duplicate {
+		l.stats.Duplicated++
+		return []time.Time{due, due}
+	}
+	return []time.Time{due}
+}
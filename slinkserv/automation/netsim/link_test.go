@@ -0,0 +1,72 @@
+package main
+
+import (
+	"math/rand"
+	"testing"
+	"time"
+)
+
+func TestLinkKeepsOrder(t *testing.T) {
+	l := newLink(Conditions{Latency: 50 * time.Millisecond, Jitter: 30 * time.Millisecond}, rand.New(rand.NewSource(1)))
+	now := time.Now()
+	var last time.Time
+	for i := 0; i < 1000; i++ {
+		sent := now.Add(time.Duration(i) * time.Millisecond)
+		arrivals := l.schedule(100, sent)
+		if len(arrivals) != 1 {
+			t.Fatalf("Expected one arrival without loss or duplication, got %d", len(arrivals))
+		}
+		if arrivals[0].Before(last) {
+			t.Fatalf("Datagram %d arrived before the one sent ahead of it.", i)
+		}
+		if delay := arrivals[0].Sub(sent); delay < 20*time.Millisecond {
+			t.Fatalf("Datagram %d arrived after %s, less than latency minus jitter.", i, delay)
+		}
+		last = arrivals[0]
+	}
+}
+
+func TestLinkReorder(t *testing.T) {
+	l := newLink(Conditions{Latency: 10 * time.Millisecond, Reorder: 1, ReorderDelay: 20 * time.Millisecond}, rand.New(rand.NewSource(1)))
+	now := time.Now()
+	first := l.schedule(100, now)
+	l.cond.Reorder = 0
+	second := l.schedule(100, now.Add(time.Millisecond))
+	if !second[0].Before(first[0]) {
+		t.Fatalf("The second datagram should overtake the reordered first one.")
+	}
+	if l.stats.Reordered != 1 {
+		t.Fatalf("Expected one reorder counted, got %d", l.stats.Reordered)
+	}
+}
+
+func TestLinkLossAndDuplicates(t *testing.T) {
+	l := newLink(Conditions{Loss: 0.25, Duplicate: 0.1}, rand.New(rand.NewSource(1)))
+	now := time.Now()
+	arrived := 0
+	for i := 0; i < 10000; i++ {
+		arrived += len(l.schedule(100, now))
+	}
+	if l.stats.Dropped < 2000 || l.stats.Dropped > 3000 {
+		t.Fatalf("Expected about a quarter lost, got %d of 10000", l.stats.Dropped)
+	}
+	if arrived != 10000-l.stats.Dropped+l.stats.Duplicated {
+		t.Fatalf("Arrivals (%d) don't add up with %d lost and %d duplicated.", arrived, l.stats.Dropped, l.stats.Duplicated)
+	}
+}
+
+func TestLinkBandwidth(t *testing.T) {
+	l := newLink(Conditions{Bandwidth: 10000}, rand.New(rand.NewSource(1)))
+	now := time.Now()
+	// 1000 bytes at 10KB/s takes 100ms on the wire, so a burst is spread out 100ms apart.
+	for i := 1; i <= 5; i++ {
+		arrivals := l.schedule(1000, now)
+		if want := now.Add(time.Duration(i) * 100 * time.Millisecond); !arrivals[0].Equal(want) {
+			t.Fatalf("Datagram %d arrived at +%s, expected +%s", i, arrivals[0].Sub(now), want.Sub(now))
+		}
+	}
+	// The queue is now 500ms deep so the next one overflows.
+	if arrivals := l.schedule(1000, now); len(arrivals) != 0 || l.stats.Overflowed != 1 {
+		t.Fatalf("Expected the link's queue to overflow.")
+	}
+}
@@ -0,0 +1,80 @@
+// netsim is a UDP proxy that sits between clients and the server and makes the network
+// between them worse. Latency, jitter, loss, duplication, reordering and bandwidth are set
+// separately for traffic going up to the server and down to the clients.
+//
+// To play through 100ms each way with some loss:
+//
+//	netsim -up.latency 100ms -down.latency 100ms -up.loss 0.02 -down.loss 0.02
+//
+// and point the client at the proxy's listen address instead of the server.
+package main
+
+import (
+	"flag"
+	"log"
+	"math/rand"
+	"net"
+	"os"
+	"os/signal"
+	"time"
+)
+
+func main() {
+	var up, down Conditions
+	fs := flag.NewFlagSet("netsim", flag.ExitOnError)
+	listen := fs.String("listen", ":24817", "address clients connect to")
+	server := fs.String("server", "localhost:24816", "address of the slink server")
+	seed := fs.Int64("seed", 0, "random seed, 0 to use the time")
+	idle := fs.Duration("idle", 30*time.Second, "how long a client can be quiet before its session is dropped")
+	report := fs.Duration("report", 10*time.Second, "how often to log link stats, 0 to only log on exit")
+	up.register(fs, "up")
+	down.register(fs, "down")
+	fs.Parse(os.Args[1:])
+
+	if *seed == 0 {
+		*seed = time.Now().UnixNano()
+	}
+	laddr, err := net.ResolveUDPAddr("udp", *listen)
+	if err != nil {
+		log.Fatalf("Bad listen address: %s", err)
+	}
+	saddr, err := net.ResolveUDPAddr("udp", *server)
+	if err != nil {
+		log.Fatalf("Bad server address: %s", err)
+	}
+	conn, err := net.ListenUDP("udp", laddr)
+	if err != nil {
+		log.Fatalf("Failed to listen: %s", err)
+	}
+
+	p := newProxy(conn, saddr, up, down, rand.New(rand.NewSource(*seed)))
+	log.Printf("Proxying %s -> %s (seed %d)", conn.LocalAddr(), saddr, *seed)
+	log.Printf("  up:   %+v", up)
+	log.Printf("  down: %+v", down)
+	go p.run()
+	go p.deliver()
+
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	var tick <-chan time.Time
+	if *report > 0 {
+		ticker := time.NewTicker(*report)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+	expire := time.NewTicker(*idle / 2)
+	defer expire.Stop()
+	for {
+		select {
+		case <-tick:
+			p.report()
+		case <-expire.C:
+			p.expire(*idle)
+		case <-interrupt:
+			p.close()
+			p.report()
+			log.Printf("Goodbye!")
+			return
+		}
+	}
+}
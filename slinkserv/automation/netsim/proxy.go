@@ -0,0 +1,244 @@
+package main
+
+import (
+	"container/heap"
+	"log"
+	"math/rand"
+	"net"
+	"sync"
+	"time"
+)
+
+// session is one client's path through the proxy.
+type session struct {
+	client   *net.UDPAddr
+	conn     *net.UDPConn // Dialed to the server, one per client so the server can tell them apart.
+	up, down *link
+	lastSeen time.Time
+}
+
+// delivery is a datagram waiting for its simulated arrival time.
+type delivery struct {
+	due   time.Time
+	order uint64 // Breaks ties so datagrams due together go out in the order they were scheduled.
+	data  []byte
+	conn  *net.UDPConn
+	addr  *net.UDPAddr // nil if conn is already connected to the destination.
+}
+
+type deliveryHeap []delivery
+
+func (h deliveryHeap) Len() int { return len(h) }
+func (h deliveryHeap) Less(i, j int) bool {
+	if h[i].due.Equal(h[j].due) {
+		return h[i].order < h[j].order
+	}
+	return h[i].due.Before(h[j].due)
+}
+func (h deliveryHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *deliveryHeap) Push(x interface{}) { *h = append(*h, x.(delivery)) }
+func (h *deliveryHeap) Pop() interface{} {
+	old := *h
+	d := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return d
+}
+
+// proxy forwards datagrams between clients and the server through simulated links.
+type proxy struct {
+	conn     *net.UDPConn // Clients talk to this.
+	server   *net.UDPAddr
+	up, down Conditions
+
+	mu       sync.Mutex
+	rng      *rand.Rand
+	sessions map[string]*session
+	pending  deliveryHeap
+	order    uint64
+	closed   bool
+	upDone   linkStats // Stats from sessions that have expired.
+	downDone linkStats
+
+	wake chan struct{}
+}
+
+func newProxy(conn *net.UDPConn, server *net.UDPAddr, up, down Conditions, rng *rand.Rand) *proxy {
+	return &proxy{
+		conn:     conn,
+		server:   server,
+		up:       up,
+		down:     down,
+		rng:      rng,
+		sessions: map[string]*session{},
+		wake:     make(chan struct{}, 1),
+	}
+}
+
+// run reads datagrams from clients and sends them up to the server.
+func (p *proxy) run() {
+	buf := make([]byte, 65536)
+	for {
+		n, addr, err := p.conn.ReadFromUDP(buf)
+		if err != nil {
+			p.mu.Lock()
+			closed := p.closed
+			p.mu.Unlock()
+			if closed {
+				return
+			}
+			log.Printf("Failed to read from client: %s", err)
+			continue
+		}
+		s := p.session(addr)
+		if s == nil {
+			continue
+		}
+		p.schedule(s.up, buf[:n], s.conn, nil)
+	}
+}
+
+// session returns the client's session, dialing the server for it if it is new.
+func (p *proxy) session(addr *net.UDPAddr) *session {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return nil
+	}
+	s := p.sessions[addr.String()]
+	if s == nil {
+		conn, err := net.DialUDP("udp", nil, p.server)
+		if err != nil {
+			log.Printf("Failed to dial server for %s: %s", addr, err)
+			return nil
+		}
+		s = &session{
+			client: addr,
+			conn:   conn,
+			up:     newLink(p.up, p.rng),
+			down:   newLink(p.down, p.rng),
+		}
+		p.sessions[addr.String()] = s
+		log.Printf("New client %s, proxied from %s", addr, conn.LocalAddr())
+		go p.readServer(s)
+	}
+	s.lastSeen = time.Now()
+	return s
+}
+
+// readServer sends datagrams from the server down to the session's client.
+func (p *proxy) readServer(s *session) {
+	buf := make([]byte, 65536)
+	for {
+		n, err := s.conn.Read(buf)
+		if err != nil {
+			return // Closed when the session expires.
+		}
+		p.schedule(s.down, buf[:n], p.conn, s.client)
+	}
+}
+
+// schedule runs a datagram through a link and queues a copy of it for each time it arrives.
+func (p *proxy) schedule(l *link, data []byte, conn *net.UDPConn, addr *net.UDPAddr) {
+	p.mu.Lock()
+	arrivals := l.schedule(len(data), time.Now())
+	earliest := false
+	for _, due := range arrivals {
+		p.order++
+		d := delivery{due: due, order: p.order, data: append([]byte(nil), data...), conn: conn, addr: addr}
+		heap.Push(&p.pending, d)
+		earliest = earliest || p.pending[0].order == d.order
+	}
+	p.mu.Unlock()
+	if earliest {
+		select {
+		case p.wake <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// deliver sends queued datagrams once they are due.
+func (p *proxy) deliver() {
+	for {
+		p.mu.Lock()
+		if p.closed {
+			p.mu.Unlock()
+			return
+		}
+		now := time.Now()
+		var ready []delivery
+		for len(p.pending) > 0 && !p.pending[0].due.After(now) {
+			ready = append(ready, heap.Pop(&p.pending).(delivery))
+		}
+		wait := time.Hour
+		if len(p.pending) > 0 {
+			wait = p.pending[0].due.Sub(now)
+		}
+		p.mu.Unlock()
+
+		for _, d := range ready {
+			var err error
+			if d.addr == nil {
+				_, err = d.conn.Write(d.data)
+			} else {
+				_, err = d.conn.WriteToUDP(d.data, d.addr)
+			}
+			if err != nil {
+				log.Printf("Failed to deliver datagram: %s", err)
+			}
+		}
+		if len(ready) > 0 {
+			continue
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-p.wake:
+		}
+		timer.Stop()
+	}
+}
+
+// expire drops sessions that haven't heard from their client in idle.
+func (p *proxy) expire(idle time.Duration) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for key, s := range p.sessions {
+		if time.Since(s.lastSeen) < idle {
+			continue
+		}
+		s.conn.Close()
+		delete(p.sessions, key)
+		p.upDone.add(s.up.stats)
+		p.downDone.add(s.down.stats)
+		log.Printf("Client %s idle, dropped its session.", s.client)
+	}
+}
+
+// report logs what the links have done so far.
+func (p *proxy) report() {
+	p.mu.Lock()
+	up, down := p.upDone, p.downDone
+	for _, s := range p.sessions {
+		up.add(s.up.stats)
+		down.add(s.down.stats)
+	}
+	clients := len(p.sessions)
+	p.mu.Unlock()
+	log.Printf("%d clients. up: %s", clients, up)
+	log.Printf("%d clients. down: %s", clients, down)
+}
+
+func (p *proxy) close() {
+	p.mu.Lock()
+	p.closed = true
+	for _, s := range p.sessions {
+		s.conn.Close()
+	}
+	p.mu.Unlock()
+	p.conn.Close()
+	select {
+	case p.wake <- struct{}{}:
+	default:
+	}
+}
@@ -0,0 +1,188 @@
+// Package capture reads and writes recordings of the datagrams a server sends and receives.
+//
+// A capture file starts with a short header followed by one record per datagram:
+//
+//	time      int64  UnixNano
+//	client    uint32 ID of the client, 0 before the handshake finishes
+//	direction byte
+//	addrlen   byte
+//	addr      addrlen bytes, the client's address as a string
+//	datalen   uint16
+//	data      datalen bytes
+//
+// Encrypted sessions are recorded in plaintext, after opening inbound datagrams and
+// before sealing outbound ones, so a capture can always be decoded with messages.NextPacket.
+package capture
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+var header = []byte("SLCAP\x01")
+
+// ErrNotCapture is returned when a file doesn't start with a capture header.
+var ErrNotCapture = errors.New("capture: not a slink capture file")
+
+// Direction is which way a datagram was going.
+type Direction byte
+
+const (
+	Inbound  Direction = iota // Client to server.
+	Outbound                  // Server to client.
+)
+
+func (d Direction) String() string {
+	if d == Inbound {
+		return "in"
+	}
+	return "out"
+}
+
+// Record is a single datagram.
+type Record struct {
+	Time     time.Time
+	ClientID uint32
+	Dir      Direction
+	Addr     string
+	Data     []byte
+}
+
+const recordHeaderLen = 8 + 4 + 1 + 1
+
+// Writer appends records to a capture. It is safe to use from multiple goroutines.
+type Writer struct {
+	mu     sync.Mutex
+	w      *bufio.Writer
+	closer io.Closer
+	failed bool
+}
+
+// Create creates a capture file at path, replacing anything already there.
+func Create(path string) (*Writer, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	cw, err := NewWriter(f)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	cw.closer = f
+	return cw, nil
+}
+
+// NewWriter starts a capture on w.
+func NewWriter(w io.Writer) (*Writer, error) {
+	cw := &Writer{w: bufio.NewWriter(w)}
+	if _, err := cw.w.Write(header); err != nil {
+		return nil, err
+	}
+	return cw, nil
+}
+
+// Write appends a record. Once a write fails the capture is stopped and later records
+// are thrown away, only the first failure is returned.
+func (cw *Writer) Write(rec Record) error {
+	addr := rec.Addr
+	if len(addr) > 255 {
+		addr = addr[:255]
+	}
+	data := rec.Data
+	if len(data) > 65535 {
+		data = data[:65535]
+	}
+	var buf [recordHeaderLen]byte
+	binary.LittleEndian.PutUint64(buf[0:], uint64(rec.Time.UnixNano()))
+	binary.LittleEndian.PutUint32(buf[8:], rec.ClientID)
+	buf[12] = byte(rec.Dir)
+	buf[13] = byte(len(addr))
+
+	cw.mu.Lock()
+	defer cw.mu.Unlock()
+	if cw.failed {
+		return nil
+	}
+	cw.w.Write(buf[:])
+	cw.w.WriteString(addr)
+	var length [2]byte
+	binary.LittleEndian.PutUint16(length[:], uint16(len(data)))
+	cw.w.Write(length[:])
+	if _, err := cw.w.Write(data); err != nil {
+		cw.failed = true
+		return err
+	}
+	return nil
+}
+
+// Close flushes the capture and closes the file if it was opened with Create.
+func (cw *Writer) Close() error {
+	cw.mu.Lock()
+	defer cw.mu.Unlock()
+	err := cw.w.Flush()
+	if cw.closer != nil {
+		if cerr := cw.closer.Close(); err == nil {
+			err = cerr
+		}
+	}
+	cw.failed = true
+	return err
+}
+
+// Reader reads records back out of a capture.
+type Reader struct {
+	r *bufio.Reader
+}
+
+// NewReader checks the capture header and returns a Reader for the records after it.
+func NewReader(r io.Reader) (*Reader, error) {
+	cr := &Reader{r: bufio.NewReader(r)}
+	head := make([]byte, len(header))
+	if _, err := io.ReadFull(cr.r, head); err != nil || string(head) != string(header) {
+		return nil, ErrNotCapture
+	}
+	return cr, nil
+}
+
+// Next returns the next record. Returns io.EOF at the end of the capture and
+// io.ErrUnexpectedEOF if it ends part way through a record, like when the server was killed.
+func (cr *Reader) Next() (Record, error) {
+	var buf [recordHeaderLen]byte
+	if _, err := io.ReadFull(cr.r, buf[:]); err != nil {
+		return Record{}, err
+	}
+	rec := Record{
+		Time:     time.Unix(0, int64(binary.LittleEndian.Uint64(buf[0:]))),
+		ClientID: binary.LittleEndian.Uint32(buf[8:]),
+		Dir:      Direction(buf[12]),
+	}
+	addr := make([]byte, buf[13])
+	if err := readFull(cr.r, addr); err != nil {
+		return Record{}, err
+	}
+	rec.Addr = string(addr)
+	var length [2]byte
+	if err := readFull(cr.r, length[:]); err != nil {
+		return Record{}, err
+	}
+	rec.Data = make([]byte, binary.LittleEndian.Uint16(length[:]))
+	if err := readFull(cr.r, rec.Data); err != nil {
+		return Record{}, err
+	}
+	return rec, nil
+}
+
+// readFull reads the rest of a record, where running out of input is always unexpected.
+func readFull(r io.Reader, buf []byte) error {
+	_, err := io.ReadFull(r, buf)
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
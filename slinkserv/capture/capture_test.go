@@ -0,0 +1,61 @@
+package capture
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"time"
+)
+
+func TestCaptureRoundTrip(t *testing.T) {
+	buf := &bytes.Buffer{}
+	cw, err := NewWriter(buf)
+	if err != nil {
+		t.Fatalf("Failed to start capture: %s", err)
+	}
+	now := time.Now()
+	recs := []Record{
+		{Time: now, ClientID: 0, Dir: Inbound, Addr: "127.0.0.1:5000", Data: []byte{1, 2, 3}},
+		{Time: now.Add(time.Millisecond), ClientID: 7, Dir: Outbound, Addr: "[::1]:6000", Data: bytes.Repeat([]byte{9}, 1400)},
+		{Time: now.Add(2 * time.Millisecond), ClientID: 7, Dir: Inbound},
+	}
+	for _, rec := range recs {
+		if err := cw.Write(rec); err != nil {
+			t.Fatalf("Failed to write record: %s", err)
+		}
+	}
+	if err := cw.Close(); err != nil {
+		t.Fatalf("Failed to close capture: %s", err)
+	}
+
+	cr, err := NewReader(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatalf("Failed to open capture: %s", err)
+	}
+	for i, want := range recs {
+		got, err := cr.Next()
+		if err != nil {
+			t.Fatalf("Record %d: %s", i, err)
+		}
+		if !got.Time.Equal(want.Time) || got.ClientID != want.ClientID || got.Dir != want.Dir ||
+			got.Addr != want.Addr || !bytes.Equal(got.Data, want.Data) {
+			t.Fatalf("Record %d didn't survive: %+v", i, got)
+		}
+	}
+	if _, err := cr.Next(); err != io.EOF {
+		t.Fatalf("Expected EOF after the last record, got %v", err)
+	}
+
+	// A capture cut off part way through a record.
+	cr, _ = NewReader(bytes.NewReader(buf.Bytes()[:buf.Len()-10]))
+	for err == nil {
+		_, err = cr.Next()
+	}
+	if err != io.ErrUnexpectedEOF {
+		t.Fatalf("Expected unexpected EOF from a truncated capture, got %v", err)
+	}
+
+	if _, err := NewReader(bytes.NewReader([]byte("not a capture"))); err != ErrNotCapture {
+		t.Fatalf("Expected ErrNotCapture, got %v", err)
+	}
+}
@@ -0,0 +1,264 @@
+// slinkcap prints the packets in a capture recorded by the server's CapturePath setting.
+//
+// Every packet in every datagram is decoded with messages.NextPacket, multipart messages
+// are put back together, and the result can be filtered down by type, client and direction:
+//
+//	slinkcap -type TurnSnake,GameMasterFrame -client 3 -v server.cap
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/lologarithm/slink/slinkserv/capture"
+	"github.com/lologarithm/slink/slinkserv/messages"
+)
+
+func main() {
+	fs := flag.NewFlagSet("slinkcap", flag.ExitOnError)
+	types := fs.String("type", "", "comma separated message types to show, by name or number")
+	clients := fs.String("client", "", "comma separated client IDs to show")
+	dir := fs.String("dir", "", "only show packets going this way, in or out")
+	verbose := fs.Bool("v", false, "print the contents of each message")
+	summary := fs.Bool("summary", false, "only print how many of each message type matched")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: slinkcap [flags] capture-file\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(os.Args[1:])
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	f := filter{}
+	var err error
+	if f.types, err = parseTypes(*types); err != nil {
+		log.Fatal(err)
+	}
+	if f.clients, err = parseClients(*clients); err != nil {
+		log.Fatal(err)
+	}
+	switch *dir {
+	case "":
+	case "in":
+		f.dir = dirIn
+	case "out":
+		f.dir = dirOut
+	default:
+		log.Fatalf("Direction must be in or out, not %q", *dir)
+	}
+
+	file, err := os.Open(fs.Arg(0))
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer file.Close()
+	cr, err := capture.NewReader(file)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	p := &printer{out: os.Stdout, filter: f, verbose: *verbose, summary: *summary}
+	if err := p.dump(cr); err != nil {
+		log.Printf("Capture ended early: %s", err)
+	}
+	if *summary {
+		p.printSummary()
+	}
+}
+
+// Direction filter values, 0 shows both.
+const (
+	dirIn = iota + 1
+	dirOut
+)
+
+type filter struct {
+	types   map[messages.MessageType]bool // nil shows every type.
+	clients map[uint32]bool               // nil shows every client.
+	dir     int
+}
+
+func (f filter) match(rec capture.Record, mtype messages.MessageType) bool {
+	if f.types != nil && !f.types[mtype] {
+		return false
+	}
+	if f.clients != nil && !f.clients[rec.ClientID] {
+		return false
+	}
+	switch f.dir {
+	case dirIn:
+		return rec.Dir == capture.Inbound
+	case dirOut:
+		return rec.Dir == capture.Outbound
+	}
+	return true
+}
+
+// parseTypes turns a list like "Heartbeat,15" into a set of message types.
+func parseTypes(list string) (map[messages.MessageType]bool, error) {
+	if list == "" {
+		return nil, nil
+	}
+	types := map[messages.MessageType]bool{}
+	for _, name := range strings.Split(list, ",") {
+		name = strings.TrimSuffix(strings.TrimSpace(name), "MsgType")
+		if n, err := strconv.Atoi(name); err == nil {
+			types[messages.MessageType(n)] = true
+			continue
+		}
+		found := false
+		for t := messages.UnknownMsgType; t <= messages.AMsgType; t++ {
+			if strings.EqualFold(t.String(), name) {
+				types[t] = true
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("unknown message type %q", name)
+		}
+	}
+	return types, nil
+}
+
+func parseClients(list string) (map[uint32]bool, error) {
+	if list == "" {
+		return nil, nil
+	}
+	clients := map[uint32]bool{}
+	for _, id := range strings.Split(list, ",") {
+		n, err := strconv.ParseUint(strings.TrimSpace(id), 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("bad client ID %q", id)
+		}
+		clients[uint32(n)] = true
+	}
+	return clients, nil
+}
+
+// groupKey identifies a multipart message, group IDs are only unique per client and direction.
+type groupKey struct {
+	client uint32
+	dir    capture.Direction
+	group  uint32
+}
+
+type printer struct {
+	out     io.Writer
+	filter  filter
+	verbose bool
+	summary bool
+
+	partial map[groupKey][]*messages.Multipart
+	counts  map[messages.MessageType]int
+}
+
+// dump prints every matching packet in the capture. Returns nil at the end of the capture.
+func (p *printer) dump(cr *capture.Reader) error {
+	p.partial = map[groupKey][]*messages.Multipart{}
+	p.counts = map[messages.MessageType]int{}
+	for {
+		rec, err := cr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		data := rec.Data
+		for len(data) > 0 {
+			packet, ok := messages.NextPacket(data)
+			if !ok || packet.Len() > len(data) {
+				p.undecodable(rec, data)
+				break
+			}
+			data = data[packet.Len():]
+			p.packet(rec, packet, 0)
+		}
+	}
+}
+
+func (p *printer) packet(rec capture.Record, packet messages.Packet, parts int) {
+	if p.filter.match(rec, packet.Frame.MsgType) {
+		p.counts[packet.Frame.MsgType]++
+		if !p.summary {
+			p.print(rec, packet, parts)
+		}
+	}
+	if packet.Frame.MsgType == messages.MultipartMsgType {
+		p.multipart(rec, packet.NetMsg.(*messages.Multipart))
+	}
+}
+
+// multipart collects fragments and decodes the message they carry once they are all in.
+func (p *printer) multipart(rec capture.Record, part *messages.Multipart) {
+	key := groupKey{client: rec.ClientID, dir: rec.Dir, group: part.GroupID}
+	group := p.partial[key]
+	if group == nil || len(group) != int(part.NumParts) {
+		group = make([]*messages.Multipart, part.NumParts)
+		p.partial[key] = group
+	}
+	if int(part.ID) >= len(group) {
+		return
+	}
+	group[part.ID] = part
+	for _, fragment := range group {
+		if fragment == nil {
+			return
+		}
+	}
+	delete(p.partial, key)
+	buf := &bytes.Buffer{}
+	for _, fragment := range group {
+		buf.Write(fragment.Content)
+	}
+	if packet, ok := messages.NextPacket(buf.Bytes()); ok {
+		p.packet(rec, packet, len(group))
+	} else {
+		p.undecodable(rec, buf.Bytes())
+	}
+}
+
+func (p *printer) print(rec capture.Record, packet messages.Packet, parts int) {
+	fmt.Fprintf(p.out, "%s %-3s client %d %s %s seq %d, %d bytes",
+		rec.Time.UTC().Format("15:04:05.000000"), rec.Dir, rec.ClientID, rec.Addr,
+		packet.Frame.MsgType, packet.Frame.Seq, packet.Len())
+	if packet.Frame.Compressed {
+		fmt.Fprintf(p.out, ", compressed")
+	}
+	if parts > 0 {
+		fmt.Fprintf(p.out, ", reassembled from %d parts", parts)
+	}
+	fmt.Fprintln(p.out)
+	if p.verbose && packet.NetMsg != nil {
+		fmt.Fprintf(p.out, "    %+v\n", packet.NetMsg)
+	}
+}
+
+func (p *printer) undecodable(rec capture.Record, data []byte) {
+	if p.filter.types != nil || !p.filter.match(rec, messages.UnknownMsgType) {
+		return
+	}
+	fmt.Fprintf(p.out, "%s %-3s client %d %s undecodable, %d bytes\n",
+		rec.Time.UTC().Format("15:04:05.000000"), rec.Dir, rec.ClientID, rec.Addr, len(data))
+}
+
+func (p *printer) printSummary() {
+	types := make([]messages.MessageType, 0, len(p.counts))
+	for t := range p.counts {
+		types = append(types, t)
+	}
+	sort.Slice(types, func(i, j int) bool { return p.counts[types[i]] > p.counts[types[j]] })
+	for _, t := range types {
+		fmt.Fprintf(p.out, "%8d %s\n", p.counts[t], t)
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lologarithm/slink/slinkserv/capture"
+	"github.com/lologarithm/slink/slinkserv/messages"
+)
+
+func TestDump(t *testing.T) {
+	buf := &bytes.Buffer{}
+	cw, _ := capture.NewWriter(buf)
+	now := time.Now()
+
+	// A turn and a heartbeat sharing a datagram from client 1.
+	data := messages.NewPacket(messages.TurnSnakeMsgType, &messages.TurnSnake{TickID: 5}).Pack()
+	data = append(data, messages.NewPacket(messages.HeartbeatMsgType, &messages.Heartbeat{Time: 1}).Pack()...)
+	cw.Write(capture.Record{Time: now, ClientID: 1, Dir: capture.Inbound, Addr: "a", Data: data})
+
+	// A connected message to client 2 split into two datagrams.
+	whole := messages.NewPacket(messages.ConnectedMsgType, &messages.Connected{PublicKey: make([]byte, 32)}).Pack()
+	for i, content := range [][]byte{whole[:10], whole[10:]} {
+		part := messages.NewPacket(messages.MultipartMsgType, &messages.Multipart{
+			ID: uint16(i), GroupID: 1, NumParts: 2, Content: content,
+		})
+		cw.Write(capture.Record{Time: now, ClientID: 2, Dir: capture.Outbound, Addr: "b", Data: part.Pack()})
+	}
+	cw.Close()
+
+	types, err := parseTypes("turnsnake,Connected")
+	if err != nil {
+		t.Fatalf("Failed to parse types: %s", err)
+	}
+	if _, err := parseTypes("Nonsense"); err == nil {
+		t.Fatalf("Unknown types should be an error.")
+	}
+
+	out := &bytes.Buffer{}
+	p := &printer{out: out, filter: filter{types: types}}
+	cr, _ := capture.NewReader(bytes.NewReader(buf.Bytes()))
+	if err := p.dump(cr); err != nil {
+		t.Fatalf("Dump failed: %s", err)
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("Expected the turn and the reassembled connected message, got:\n%s", out)
+	}
+	if !strings.Contains(lines[0], "in  client 1 a TurnSnake") {
+		t.Fatalf("Unexpected first line: %s", lines[0])
+	}
+	if !strings.Contains(lines[1], "out client 2 b Connected") || !strings.Contains(lines[1], "reassembled from 2 parts") {
+		t.Fatalf("Unexpected second line: %s", lines[1])
+	}
+
+	clients, _ := parseClients("1")
+	p = &printer{out: out, filter: filter{clients: clients}, summary: true}
+	cr, _ = capture.NewReader(bytes.NewReader(buf.Bytes()))
+	p.dump(cr)
+	if len(p.counts) != 2 || p.counts[messages.TurnSnakeMsgType] != 1 || p.counts[messages.HeartbeatMsgType] != 1 {
+		t.Fatalf("Expected one turn and one heartbeat for client 1, got %v", p.counts)
+	}
+}
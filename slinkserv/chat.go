@@ -0,0 +1,255 @@
+package slinkserv
+
+import (
+	"log"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/lologarithm/slink/slinkserv/messages"
+)
+
+// maxChatLen is the most characters a chat message can have.
+const maxChatLen = 200
+
+// Players whose chat keeps getting filtered are muted. Every filtered message is a strike,
+// once a player has chatStrikes strikes they are muted for chatMute, doubling with every
+// strike after up to chatMaxMute. Strikes are forgotten after chatMaxMute without one.
+const (
+	chatStrikeLimit = 3
+	chatMute        = time.Minute
+	chatMaxMute     = time.Hour
+)
+
+type chatStrikes struct {
+	count int
+	last  time.Time // Most recent strike.
+}
+
+// cleanChat tidies up a chat message, returning why it can't be sent if there is a problem.
+func cleanChat(text string) (string, string) {
+	if !utf8.ValidString(text) {
+		return "", "Chat must be valid text."
+	}
+	text = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return -1
+		}
+		return r
+	}, text)
+	text = strings.TrimSpace(text)
+	if utf8.RuneCountInString(text) > maxChatLen {
+		return "", "Chat messages can't be longer than 200 characters."
+	}
+	return text, ""
+}
+
+// mask replaces any blocked words in text with asterisks. Returns true if anything was replaced.
+// Only whole words are matched, so a blocked word inside an innocent one is left alone.
+// Text is compared a rune at a time so lowercasing can't move where a match is.
+func (nf *nameFilter) mask(text string) (string, bool) {
+	masked := []rune(text)
+	lower := make([]rune, len(masked))
+	for i, r := range masked {
+		lower[i] = unicode.ToLower(r)
+	}
+	found := false
+	for _, blocked := range nf.blocked {
+		word := []rune(blocked)
+		for i := 0; i+len(word) <= len(lower); i++ {
+			end := i + len(word)
+			if !runesEqual(lower[i:end], word) || (i > 0 && isWordRune(lower[i-1])) || (end < len(lower) && isWordRune(lower[end])) {
+				continue
+			}
+			for k := i; k < end; k++ {
+				masked[k] = '*'
+			}
+			found = true
+			i = end - 1
+		}
+	}
+	return string(masked), found
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+func runesEqual(a, b []rune) bool {
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// handleChat sends a player's chat to the rest of the game, or on to the game manager for global chat.
+func (g *GameSession) handleChat(clientID uint32, cs *messages.ChatSend) {
+	user := g.user(clientID)
+	if user == nil {
+		return
+	}
+	if wait := time.Until(user.mutedUntil); wait > 0 {
+		user.Client.send(messages.ChatMutedMsgType, &messages.ChatMuted{
+			Seconds: uint32((wait + time.Second - 1) / time.Second),
+			Reason:  "You are muted.",
+		})
+		return
+	}
+	text, reason := cleanChat(cs.Text)
+	if reason != "" {
+		user.Client.send(messages.WarningMsgType, &messages.Warning{Reason: reason})
+		return
+	}
+	if text == "" {
+		return
+	}
+	if masked, found := g.names.mask(text); found {
+		text = masked
+		// Let the manager decide if this player has had enough strikes to be muted.
+		g.chatToManager(GameMessage{
+			net:    &messages.ChatMuted{Reason: "Watch your language."},
+			client: user.Client,
+			mtype:  messages.ChatMutedMsgType,
+		})
+	}
+	chat := &messages.Chat{Channel: cs.Channel, From: user.Name, SnakeID: user.SnakeID, Text: text}
+	if cs.Channel == messages.ChatGlobal {
+		g.chatToManager(GameMessage{net: chat, client: user.Client, mtype: messages.ChatMsgType})
+		return
+	}
+	chat.Channel = messages.ChatGame
+	g.sendToAll(NewOutgoingMsg(nil, messages.ChatMsgType, chat))
+}
+
+// chatToManager passes chat on to the manager without waiting. Players can send chat as fast as
+// they like, and a game blocked on the manager while the manager is blocked relaying chat to
+// the game would stall them both, so chat is dropped when the manager can't keep up.
+func (g *GameSession) chatToManager(msg GameMessage) {
+	select {
+	case g.IntoGameManager <- msg:
+	default:
+		g.dropped++
+	}
+}
+
+// chatStrike records a filtered chat message, muting the player once they have too many.
+func (gm *GameManager) chatStrike(msg GameMessage) {
+	user := gm.Users[msg.client.ID]
+	if user == nil || user.Account == nil {
+		return
+	}
+	now := time.Now()
+	name := user.Account.Name
+	s := gm.strikes[name]
+	if s == nil || now.Sub(s.last) > chatMaxMute {
+		s = &chatStrikes{}
+		gm.strikes[name] = s
+	}
+	s.count++
+	s.last = now
+	over := s.count - chatStrikeLimit
+	if over < 0 {
+		return
+	}
+	mute := chatMaxMute
+	if d := chatMute << uint(over); over < 32 && d > 0 && d < mute {
+		mute = d
+	}
+	gm.mute(user, now.Add(mute), msg.net.(*messages.ChatMuted).Reason)
+}
+
+// mute stops a player from chatting until the given time, in their current game and any they join.
+func (gm *GameManager) mute(user *User, until time.Time, reason string) {
+	log.Printf("GM: muting %s until %s: %s", user.Account.Name, until.Format(time.RFC3339), reason)
+	gm.mutes[user.Account.Name] = until
+	if g := gm.Games[user.GameID]; g != nil {
+		g.FromGameManager <- MutePlayer{Client: user.Client, Until: until}
+	}
+	user.Client.send(messages.ChatMutedMsgType, &messages.ChatMuted{
+		Seconds: uint32(time.Until(until) / time.Second),
+		Reason:  reason,
+	})
+}
+
+// Mute stops the player with the given account name from chatting for d, even if they aren't
+// online right now. It can be called from any goroutine, the mute happens on the manager's.
+func (gm *GameManager) Mute(name string, d time.Duration, reason string) {
+	gm.admin <- func() {
+		until := time.Now().Add(d)
+		if user := gm.userByName(name); user != nil {
+			gm.mute(user, until, reason)
+			return
+		}
+		log.Printf("GM: muting %s until %s: %s", name, until.Format(time.RFC3339), reason)
+		gm.mutes[name] = until
+	}
+}
+
+// Unmute lets the player with the given account name chat again and forgets their strikes.
+// It can be called from any goroutine, the mute is lifted on the manager's.
+func (gm *GameManager) Unmute(name string) {
+	gm.admin <- func() {
+		log.Printf("GM: unmuting %s", name)
+		delete(gm.mutes, name)
+		delete(gm.strikes, name)
+		user := gm.userByName(name)
+		if user == nil {
+			return
+		}
+		if g := gm.Games[user.GameID]; g != nil {
+			g.FromGameManager <- MutePlayer{Client: user.Client}
+		}
+		user.Client.send(messages.ChatMutedMsgType, &messages.ChatMuted{Reason: "You can chat again."})
+	}
+}
+
+// userByName returns the connected user logged in to the named account, nil if they aren't online.
+func (gm *GameManager) userByName(name string) *User {
+	for _, user := range gm.Users {
+		if user != nil && user.Account != nil && user.Account.Name == name {
+			return user
+		}
+	}
+	return nil
+}
+
+// mutedUntil returns when a player can chat again, the zero time if they aren't muted.
+func (gm *GameManager) mutedUntil(user *User) time.Time {
+	if user.Account == nil {
+		return time.Time{}
+	}
+	return gm.mutes[user.Account.Name]
+}
+
+// relayChat sends a global chat message from one game to every game.
+func (gm *GameManager) relayChat(msg GameMessage) {
+	user := gm.Users[msg.client.ID]
+	if user == nil || time.Now().Before(gm.mutedUntil(user)) {
+		return
+	}
+	// Like chat into the manager, games that can't keep up miss out rather than hold up the manager.
+	for _, g := range gm.Games {
+		select {
+		case g.FromGameManager <- GlobalChat{Chat: msg.net.(*messages.Chat)}:
+		default:
+			gm.dropped++
+		}
+	}
+}
+
+// expireMutes forgets mutes and strikes that no longer matter.
+func (gm *GameManager) expireMutes(now time.Time) {
+	for name, until := range gm.mutes {
+		if now.After(until) {
+			delete(gm.mutes, name)
+		}
+	}
+	for name, s := range gm.strikes {
+		if now.Sub(s.last) > chatMaxMute {
+			delete(gm.strikes, name)
+		}
+	}
+}
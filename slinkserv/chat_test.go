@@ -0,0 +1,164 @@
+package slinkserv
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lologarithm/slink/slinkserv/messages"
+)
+
+func TestCleanChat(t *testing.T) {
+	if text, reason := cleanChat("  hi\x00 there\n "); text != "hi there" || reason != "" {
+		t.Fatalf("Expected control characters and spaces stripped, got %q: %s", text, reason)
+	}
+	if _, reason := cleanChat(strings.Repeat("é", maxChatLen)); reason != "" {
+		t.Fatalf("Expected %d characters to be allowed, got: %s", maxChatLen, reason)
+	}
+	if _, reason := cleanChat(strings.Repeat("a", maxChatLen+1)); reason == "" {
+		t.Fatalf("Expected chat over %d characters to be refused.", maxChatLen)
+	}
+	if _, reason := cleanChat("\xff"); reason == "" {
+		t.Fatalf("Expected invalid utf8 to be refused.")
+	}
+	nf := &nameFilter{blocked: []string{"rude"}}
+	if text, found := nf.mask("so RUDE, rude"); !found || text != "so ****, ****" {
+		t.Fatalf("Expected every blocked word masked, got %q", text)
+	}
+	if text, found := nf.mask("polite"); found || text != "polite" {
+		t.Fatalf("Expected clean chat untouched, got %q", text)
+	}
+	if text, found := nf.mask("prudent, rudeness"); found || text != "prudent, rudeness" {
+		t.Fatalf("Expected only whole words masked, got %q", text)
+	}
+	// İ lowercases to more bytes than it takes up, which mustn't move the match.
+	if text, found := nf.mask("İ said RUDE"); !found || text != "İ said ****" {
+		t.Fatalf("Expected the match found past text that changes length when lowercased, got %q", text)
+	}
+}
+
+func TestChat(t *testing.T) {
+	toManager := make(chan GameMessage, 100)
+	g := NewGame(toManager)
+	g.names = &nameFilter{blocked: []string{"rude"}}
+	gm, clients := newTestManager(DefaultConfig(), 2)
+	for id, name := range []string{"", "alice", "bob"} {
+		if id > 0 {
+			g.addPlayer(AddPlayer{Entity: &Entity{Name: name}, Client: clients[id]})
+			clients[id].out.pop() // GameConnected
+		}
+	}
+	expectChat := func(id int, channel byte, text string) {
+		msg, ok := clients[id].out.pop()
+		if !ok {
+			t.Fatalf("Client %d didn't get chat.", id)
+		}
+		chat, ok := msg.msg.NetMsg.(*messages.Chat)
+		if !ok || chat.Channel != channel || chat.From != "alice" || chat.Text != text {
+			t.Fatalf("Client %d expected %q from alice, got %v", id, text, msg.msg.NetMsg)
+		}
+	}
+
+	g.handleChat(1, &messages.ChatSend{Text: "hello"})
+	expectChat(1, messages.ChatGame, "hello")
+	expectChat(2, messages.ChatGame, "hello")
+
+	// Filtered chat still goes out masked, and the manager is told about it.
+	g.handleChat(1, &messages.ChatSend{Text: "rude"})
+	expectChat(2, messages.ChatGame, "****")
+	clients[1].out.pop()
+	if strike := <-toManager; strike.mtype != messages.ChatMutedMsgType {
+		t.Fatalf("Expected a strike for filtered chat, got %d", strike.mtype)
+	}
+
+	// Global chat goes through the manager to every game.
+	gm.Games[g.ID] = g
+	g.handleChat(1, &messages.ChatSend{Channel: messages.ChatGlobal, Text: "everyone"})
+	gm.ProcessGameMsg(<-toManager)
+	if gc := (<-g.FromGameManager).(GlobalChat); gc.Chat.Text != "everyone" || gc.Chat.Channel != messages.ChatGlobal {
+		t.Fatalf("Expected global chat relayed to the game, got %v", gc.Chat)
+	}
+
+	// Enough strikes and the player is muted, here and in any game they join later.
+	gm.Users[1].GameID = g.ID
+	for i := 0; i < chatStrikeLimit; i++ {
+		gm.ProcessGameMsg(GameMessage{net: &messages.ChatMuted{Reason: "Watch your language."}, client: clients[1], mtype: messages.ChatMutedMsgType})
+	}
+	mute, ok := (<-g.FromGameManager).(MutePlayer)
+	if !ok || mute.Client != clients[1] || time.Until(mute.Until) <= 0 {
+		t.Fatalf("Expected alice muted in their game, got %v", mute)
+	}
+	if until := gm.mutedUntil(gm.Users[1]); !until.Equal(mute.Until) {
+		t.Fatalf("Expected the mute to be remembered for later games.")
+	}
+	if msg, _ := clients[1].out.pop(); msg.msg.Frame.MsgType != messages.ChatMutedMsgType {
+		t.Fatalf("Expected alice to be told they were muted.")
+	}
+	g.Clients[1].mutedUntil = mute.Until
+	g.handleChat(1, &messages.ChatSend{Text: "hello?"})
+	if _, ok := clients[2].out.pop(); ok {
+		t.Fatalf("Expected chat from a muted player to be dropped.")
+	}
+	gm.expireMutes(mute.Until.Add(time.Second))
+	if !gm.mutedUntil(gm.Users[1]).IsZero() {
+		t.Fatalf("Expected the mute to expire.")
+	}
+}
+
+func TestChatNeverBlocks(t *testing.T) {
+	toManager := make(chan GameMessage)
+	g := NewGame(toManager)
+	gm, clients := newTestManager(DefaultConfig(), 1)
+	g.addPlayer(AddPlayer{Entity: &Entity{Name: "alice"}, Client: clients[1]})
+	gm.Games[g.ID] = g
+
+	// Nobody is reading from the game or the manager, chat is dropped instead of waiting on them.
+	g.handleChat(1, &messages.ChatSend{Channel: messages.ChatGlobal, Text: "anyone?"})
+	if g.dropped != 1 {
+		t.Fatalf("Expected global chat dropped by the game, %d dropped.", g.dropped)
+	}
+	for i := 0; i < cap(g.FromGameManager); i++ {
+		g.FromGameManager <- GlobalChat{}
+	}
+	gm.ProcessGameMsg(GameMessage{net: &messages.Chat{Text: "anyone?"}, client: clients[1], mtype: messages.ChatMsgType})
+	if gm.dropped != 1 {
+		t.Fatalf("Expected global chat dropped by the manager, %d dropped.", gm.dropped)
+	}
+}
+
+func TestAdminMute(t *testing.T) {
+	g := NewGame(make(chan GameMessage, 100))
+	gm, clients := newTestManager(DefaultConfig(), 1)
+	gm.Games[g.ID] = g
+	gm.Users[1].GameID = g.ID
+
+	gm.Mute("player1", time.Minute, "Spamming.")
+	(<-gm.admin)()
+	mute, ok := (<-g.FromGameManager).(MutePlayer)
+	if !ok || mute.Client != clients[1] || time.Until(mute.Until) <= 0 {
+		t.Fatalf("Expected player1 muted in their game, got %v", mute)
+	}
+	if msg, _ := clients[1].out.pop(); msg.msg.NetMsg.(*messages.ChatMuted).Reason != "Spamming." {
+		t.Fatalf("Expected player1 to be told why they were muted.")
+	}
+
+	// Players who aren't online are muted for when they come back.
+	gm.Mute("player9", time.Minute, "Spamming.")
+	(<-gm.admin)()
+	if gm.mutes["player9"].IsZero() {
+		t.Fatalf("Expected an offline player to be muted.")
+	}
+
+	gm.strikes["player1"] = &chatStrikes{count: chatStrikeLimit, last: time.Now()}
+	gm.Unmute("player1")
+	(<-gm.admin)()
+	if unmute := (<-g.FromGameManager).(MutePlayer); !unmute.Until.IsZero() {
+		t.Fatalf("Expected player1 unmuted in their game.")
+	}
+	if !gm.mutedUntil(gm.Users[1]).IsZero() || gm.strikes["player1"] != nil {
+		t.Fatalf("Expected the mute and strikes to be forgotten.")
+	}
+	if msg, _ := clients[1].out.pop(); msg.msg.NetMsg.(*messages.ChatMuted).Seconds != 0 {
+		t.Fatalf("Expected player1 to be told they can chat again.")
+	}
+}
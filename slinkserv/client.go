@@ -3,6 +3,7 @@ package slinkserv
 import (
 	"bytes"
 	"log"
+	"math"
 	"net"
 	"sync/atomic"
 	"time"
@@ -15,17 +16,15 @@ import (
 // Theoretically this could support multiple accounts logged in together (local coop)
 type Client struct {
 	ID      uint32 // Unique ID for this session
-	buffer  []byte
-	wIdx    int
 	address *net.UDPAddr
 	lastMsg int64
 	pings   []int64
 	latency int64
 
 	// These channels are written to by another process
-	FromNetwork     *BytePipe // Bytes from client to server
-	ToNetwork       chan OutgoingMessage
+	FromNetwork     *DatagramQueue       // Datagrams from client to server
 	FromGameManager chan InternalMessage //
+	out             *outQueue            // Messages waiting to be sent to the client, use send to add to it.
 
 	// These channels can be written to in the client but not read from.
 	toGameManager chan<- GameMessage // Messages to the main game manager.
@@ -34,33 +33,91 @@ type Client struct {
 	Seq     uint16 // Used by the server to manage this client's output sequence. Don't read/write from other goroutines.
 	GroupID uint32 // Same as above, used by server
 	Alive   bool
+
+	limiter     *clientLimiter // Inbound rate limits, only used by ProcessBytes.
+	rateLimited bool           // Set when the client was disconnected for going over its limits.
+	quit        bool           // Set when the client said it was disconnecting, so there is no session to resume.
+	resumed     int32          // 1 once the client has picked its session back up from a new connection, use atomic.
+	timeout     time.Duration  // The client is closed down after sending nothing for this long.
+
+	keys   *serverKeys             // Used for the session key exchange, nil if the server doesn't offer encryption.
+	cipher *messages.SessionCipher // Set once the client sends its session key, load with sessionCipher.
+
+	packetSize int64      // Largest datagram to send the client, load with PacketSize.
+	mtu        *mtuProber // Finds the client's packet size, nil if probing is disabled.
+
+	stats connStats
+}
+
+// Address returns where packets for this client are sent. It changes if the client resumes
+// its session from somewhere else so always load it through here.
+func (client *Client) Address() *net.UDPAddr {
+	return (*net.UDPAddr)(atomic.LoadPointer((*unsafe.Pointer)(unsafe.Pointer(&client.address))))
+}
+
+func (client *Client) setAddress(addr *net.UDPAddr) {
+	atomic.StorePointer((*unsafe.Pointer)(unsafe.Pointer(&client.address)), unsafe.Pointer(addr))
+}
+
+// send queues a message for the client without blocking.
+// Returns false if the client's queue was too full to take it.
+func (client *Client) send(mtype messages.MessageType, msg messages.Net) bool {
+	return client.queue(NewOutgoingMsg(client, mtype, msg))
+}
+
+// queue adds an already built message to the client's outbound queue.
+func (client *Client) queue(msg OutgoingMessage) bool {
+	msg.dest = client
+	return client.out.push(msg)
 }
 
 type clientGame struct {
 	toGame chan<- GameMessage
 	id     uint32
+	clock  *gameClock
 }
 
 // ProcessBytes accepts raw bytes from a socket and turns them into NetMessage objects and then
 // later into GameMessages. These are passed into the GameManager. This function also
 // accepts outgoing messages from the GameManager to the client.
-func (client *Client) ProcessBytes(disconClient chan Client) {
+// It is started again with a new FromNetwork queue when a lost client resumes its session.
+func (client *Client) ProcessBytes(disconClient chan *Client) {
 	client.toGameManager <- GameMessage{
 		client: client,
 		net:    &messages.Connected{},
 		mtype:  messages.ConnectedMsgType,
 	}
+	// Let the client know the handshake is complete.
+	client.send(messages.ConnectedMsgType, client.connectedMsg())
 	client.Alive = true
-	client.lastMsg = time.Now().UTC().Unix()
+	client.quit = false
+	atomic.StoreInt64(&client.lastMsg, time.Now().UTC().UnixNano())
 	client.pings = make([]int64, 5)
+	client.restartProbing()
 	// Used to cache parts of a message.
-	// TODO: When should this be cleaned out?
-	partialMessages := map[uint32][]*messages.Multipart{}
+	partialMessages := newFragments()
+	in := client.FromNetwork
+	done := make(chan struct{})
 
 	go func() {
-		timer := time.After(time.Second * 2)
-		for client.Alive {
+		timeout := client.timeout
+		if timeout <= 0 {
+			timeout = 5 * time.Second
+		}
+		// Heartbeats go out every 2 seconds, or often enough to notice the timeout if it is shorter.
+		interval := 2 * time.Second
+		if interval > timeout/2 {
+			interval = timeout / 2
+		}
+		timer := time.After(interval)
+		probes := time.NewTicker(probeInterval)
+		defer probes.Stop()
+		for {
 			select {
+			case <-done:
+				return
+			case <-probes.C:
+				client.sendProbe()
 			case msg, ok := <-client.FromGameManager:
 				if !ok {
 					return
@@ -70,127 +127,223 @@ func (client *Client) ProcessBytes(disconClient chan Client) {
 					activeGame := &clientGame{
 						toGame: tmsg.ToGame,
 						id:     tmsg.ID,
+						clock:  tmsg.Clock,
 					}
 					atomic.StorePointer((*unsafe.Pointer)(unsafe.Pointer(&client.activeGame)), unsafe.Pointer(activeGame))
 					log.Printf("Client %d connected to game: %d", client.ID, tmsg.ID)
 				}
 			case <-timer:
-				client.ToNetwork <- NewOutgoingMsg(client, messages.HeartbeatMsgType, &messages.Heartbeat{
-					Time:    time.Now().UTC().UnixNano(),
-					Latency: atomic.LoadInt64(&client.latency),
-				})
-
-				// If after 5 seconds we haven't gotten any messages, shut er down!
-				lastMsg := time.Unix(atomic.LoadInt64(&client.lastMsg), 0)
-				if time.Now().UTC().Sub(lastMsg).Seconds() > 5 {
-					client.FromNetwork.Close()
+				client.send(messages.HeartbeatMsgType, client.heartbeat())
+
+				// If we haven't gotten any messages in a while, shut er down!
+				lastMsg := time.Unix(0, atomic.LoadInt64(&client.lastMsg))
+				if time.Now().UTC().Sub(lastMsg) > timeout {
+					in.Close()
 					log.Printf("Client %d: no message in past %.1f seconds. Closing down.", client.ID, time.Now().UTC().Sub(lastMsg).Seconds())
 					return
 				}
-				timer = time.After(time.Second * 2)
+				timer = time.After(interval)
 			}
-
 		}
 	}()
 
 	for client.Alive {
-		packet, ok := messages.NextPacket(client.buffer[:client.wIdx])
+		dg, err := in.Pop()
+		if err != nil {
+			// log.Printf("Client %d network buffer closed, shutting down client.", client.ID)
+			client.Alive = false
+			break // Break out of alive!
+		}
+		atomic.StoreInt64(&client.lastMsg, time.Now().UTC().UnixNano())
+		client.handleDatagram(dg.Data, partialMessages)
+		dg.Release()
+	}
+	close(done)
+	log.Printf("  Client %d shutdown complete", client.ID)
+	disconClient <- client
+}
 
-		if len(client.buffer) < packet.Len() {
-			newBuffer := make([]byte, packet.Len()*2)
-			copy(newBuffer, client.buffer)
-			client.buffer = newBuffer
+// handleDatagram handles every packet in a datagram from the client. Once a packet can't be
+// parsed the rest of the datagram can't be trusted either so it is dropped, the next one starts clean.
+func (client *Client) handleDatagram(data []byte, partialMessages *fragments) {
+	for len(data) > 0 && client.Alive {
+		packet, ok := messages.NextPacket(data)
+		if !ok {
+			return
+		}
+		data = data[packet.Len():]
+		client.stats.trackSeq(packet.Frame.Seq)
+		if packet.Frame.MsgType == messages.MultipartMsgType {
+			atomic.AddUint64(&client.stats.fragmentsIn, 1)
+			if packet, ok = partialMessages.add(packet.NetMsg.(*messages.Multipart), time.Now()); !ok {
+				continue
+			}
 		}
+		client.handlePacket(packet)
+	}
+}
 
-		if packet.Frame.MsgType == messages.DisconnectedMsgType {
-			client.Alive = false
-			break
-		} else if ok && packet.Frame.MsgType == messages.MultipartMsgType {
-			netmsg := packet.NetMsg.(*messages.Multipart)
-			// 1. Check if this group already exists
-			if _, ok := partialMessages[netmsg.GroupID]; !ok {
-				partialMessages[netmsg.GroupID] = make([]*messages.Multipart, netmsg.NumParts)
+// Limits on the multipart messages a client can have half sent, since the client picks the
+// group IDs and part counts and could otherwise have us hold on to as much as it likes.
+const (
+	maxFragmentGroups = 4               // Incomplete messages per client, the oldest is dropped for a new one.
+	fragmentTimeout   = 5 * time.Second // Incomplete messages are dropped after this long.
+)
+
+// maxFragmentParts is how many parts the largest message a client can send is split into.
+// Clients split their messages to fit in defaultPacketSize datagrams.
+var maxFragmentParts = func() int {
+	partLen := defaultPacketSize - (&messages.Multipart{}).Len() - messages.FrameLen
+	return (messages.FrameLen + math.MaxUint16 + partLen - 1) / partLen
+}()
+
+// fragments holds the parts of multipart messages from a client until every part is in.
+type fragments struct {
+	groups map[uint32]*fragmentGroup
+}
+
+type fragmentGroup struct {
+	parts   []*messages.Multipart
+	started time.Time
+}
+
+func newFragments() *fragments {
+	return &fragments{groups: map[uint32]*fragmentGroup{}}
+}
+
+// add adds a fragment to its group. Returns the packet the group carries once every part is in.
+func (f *fragments) add(netmsg *messages.Multipart, now time.Time) (messages.Packet, bool) {
+	if netmsg.NumParts == 0 || int(netmsg.NumParts) > maxFragmentParts || netmsg.ID >= netmsg.NumParts {
+		return messages.Packet{}, false
+	}
+	group, ok := f.groups[netmsg.GroupID]
+	if !ok || len(group.parts) != int(netmsg.NumParts) || now.Sub(group.started) > fragmentTimeout {
+		f.expire(now)
+		group = &fragmentGroup{parts: make([]*messages.Multipart, netmsg.NumParts), started: now}
+		f.groups[netmsg.GroupID] = group
+	}
+	group.parts[netmsg.ID] = netmsg
+	for _, p := range group.parts {
+		if p == nil {
+			return messages.Packet{}, false
+		}
+	}
+	delete(f.groups, netmsg.GroupID)
+	buf := &bytes.Buffer{}
+	for _, p := range group.parts {
+		buf.Write(p.Content)
+	}
+	return messages.NextPacket(buf.Bytes())
+}
+
+// expire drops groups that have taken too long, then the oldest ones until there is room for another.
+func (f *fragments) expire(now time.Time) {
+	for id, group := range f.groups {
+		if now.Sub(group.started) > fragmentTimeout {
+			delete(f.groups, id)
+		}
+	}
+	for len(f.groups) >= maxFragmentGroups {
+		var oldest uint32
+		var oldestAt time.Time
+		for id, group := range f.groups {
+			if oldestAt.IsZero() || group.started.Before(oldestAt) {
+				oldest, oldestAt = id, group.started
 			}
-			// 2. Insert into group
-			partialMessages[netmsg.GroupID][netmsg.ID] = netmsg
-			// 3. See if group is ready to process
-			isReady := true
-			for _, p := range partialMessages[netmsg.GroupID] {
-				if p == nil {
-					isReady = false
+		}
+		delete(f.groups, oldest)
+	}
+}
+
+// handlePacket acts on a single packet from the client, passing anything for the game on to it.
+// Packets over the client's rate limits are dropped.
+func (client *Client) handlePacket(packet messages.Packet) {
+	if packet.Frame.MsgType == messages.DisconnectedMsgType {
+		client.quit = true
+		client.Alive = false
+		return
+	}
+	if !client.allowPacket(packet.Frame.MsgType) {
+		return
+	}
+	switch packet.Frame.MsgType {
+	case messages.HeartbeatMsgType:
+		heartbeat := packet.NetMsg.(*messages.Heartbeat)
+		if heartbeat.Time == 0 {
+			// Clock sync request, answered right away rather than counted as a ping.
+			client.send(messages.HeartbeatMsgType, client.syncReply(heartbeat))
+			break
+		}
+		ping := ((time.Now().UTC().UnixNano() - heartbeat.Time) / int64(time.Millisecond)) + 1
+		avgPings := int64(0)
+
+		if client.pings[4] == 0 {
+			numpings := 0
+			for i, p := range client.pings {
+				if p == 0 {
+					client.pings[i] = ping
+					numpings = i + 1
 					break
 				}
 			}
-			if isReady {
-				buf := &bytes.Buffer{}
-				for _, p := range partialMessages[netmsg.GroupID] {
-					buf.Write(p.Content)
-				}
-				packet, ok = messages.NextPacket(buf.Bytes())
+			for i := 0; i < numpings; i++ {
+				avgPings += client.pings[i]
 			}
-		} else if !ok || packet.Len() > client.wIdx {
-			// This means we need more data still.
-			n := client.FromNetwork.Read(client.buffer[client.wIdx:])
-			if n == 0 {
-				// log.Printf("Client %d network buffer closed, shutting down client.", client.ID)
-				client.Alive = false
-				break // Break out of alive!
+			avgPings /= int64(numpings)
+		} else {
+			copy(client.pings[1:], client.pings[:4]) // Copy back all the pings so we only have 4.
+			client.pings[0] = ping
+			for i := 0; i < 5; i++ {
+				avgPings += client.pings[i]
 			}
-			atomic.StoreInt64(&client.lastMsg, time.Now().UTC().Unix())
-			client.wIdx += n
-			continue
+			avgPings /= 5
 		}
-		// Only try to parse if we have collected enough bytes.
-		if ok {
-			switch packet.Frame.MsgType {
-			case messages.HeartbeatMsgType:
-				heartbeat := packet.NetMsg.(*messages.Heartbeat)
-				ping := ((time.Now().UTC().UnixNano() - heartbeat.Time) / int64(time.Millisecond)) + 1
-				avgPings := int64(0)
-
-				if client.pings[4] == 0 {
-					numpings := 0
-					for i, p := range client.pings {
-						if p == 0 {
-							client.pings[i] = ping
-							numpings = i + 1
-							break
-						}
-					}
-					for i := 0; i < numpings; i++ {
-						avgPings += client.pings[i]
-					}
-					avgPings /= int64(numpings)
-				} else {
-					copy(client.pings[1:], client.pings[:4]) // Copy back all the pings so we only have 4.
-					client.pings[0] = ping
-					for i := 0; i < 5; i++ {
-						avgPings += client.pings[i]
-					}
-					avgPings /= 5
-				}
-				atomic.StoreInt64(&client.latency, avgPings)
-			case messages.CreateAcctMsgType, messages.LoginMsgType, messages.JoinGameMsgType:
-				client.toGameManager <- GameMessage{net: packet.NetMsg, client: client, mtype: packet.Frame.MsgType, clientID: client.ID}
-			default:
-				if client.activeGame == nil {
-					// log.Printf("Client sent message (%d:%v) before in a game!", packet.Frame.MsgType, packet.NetMsg)
-					break
-				}
-				client.activeGame.toGame <- GameMessage{net: packet.NetMsg, client: client, mtype: packet.Frame.MsgType, clientID: client.ID}
-			}
-
-			// Remove the used bytes from the buffer.
-			copy(client.buffer, client.buffer[packet.Len():])
-			client.wIdx -= packet.Len()
+		atomic.StoreInt64(&client.latency, avgPings)
+		client.stats.addRTT(ping)
+		client.stats.clientReport(heartbeat)
+	case messages.ConnectMsgType:
+		// Our Connected reply was lost and the client is retrying the handshake.
+		client.send(messages.ConnectedMsgType, client.connectedMsg())
+	case messages.MTUProbeAckMsgType:
+		client.probeAcked(packet.NetMsg.(*messages.MTUProbeAck))
+	case messages.SessionKeyMsgType:
+		client.startEncryption(packet.NetMsg.(*messages.SessionKey))
+	case messages.CreateAcctMsgType, messages.LoginMsgType, messages.GuestLoginMsgType, messages.JoinGameMsgType:
+		if client.encryptionMissing(packet.Frame.MsgType) {
+			break
+		}
+		client.toGameManager <- GameMessage{net: packet.NetMsg, client: client, mtype: packet.Frame.MsgType, clientID: client.ID}
+	case messages.TopPlayersReqMsgType:
+		client.toGameManager <- GameMessage{net: packet.NetMsg, client: client, mtype: packet.Frame.MsgType, clientID: client.ID}
+	default:
+		game := client.game()
+		if game == nil {
+			// log.Printf("Client sent message (%d:%v) before in a game!", packet.Frame.MsgType, packet.NetMsg)
+			break
 		}
+		game.toGame <- GameMessage{net: packet.NetMsg, client: client, mtype: packet.Frame.MsgType, clientID: client.ID}
 	}
-	client.toGameManager <- GameMessage{
-		client: client,
-		net:    &messages.Disconnected{},
-		mtype:  messages.DisconnectedMsgType,
+}
+
+// allowPacket applies the client's rate limits to an incoming packet.
+// Returns false if the packet should be dropped, and marks the client dead if it should be disconnected.
+func (client *Client) allowPacket(mtype messages.MessageType) bool {
+	if client.limiter == nil {
+		return true
 	}
-	disconClient <- *client
-	close(client.FromGameManager)
-	log.Printf("  Client %d shutdown complete", client.ID)
+	switch client.limiter.check(mtype, time.Now().UTC()) {
+	case limitAllow:
+		return true
+	case limitWarn:
+		log.Printf("Client %d is sending too many messages, dropping them.", client.ID)
+		client.send(messages.WarningMsgType, &messages.Warning{
+			Reason: "Too many messages, slow down or you will be disconnected.",
+		})
+	case limitDisconnect:
+		log.Printf("Client %d went over its rate limits, disconnecting.", client.ID)
+		client.send(messages.DisconnectedMsgType, &messages.Disconnected{})
+		client.rateLimited = true
+		client.Alive = false
+	}
+	return false
 }
@@ -0,0 +1,53 @@
+package slinkserv
+
+import (
+	"testing"
+	"time"
+
+	"github.com/lologarithm/slink/slinkserv/messages"
+)
+
+func TestFragments(t *testing.T) {
+	packed := messages.NewPacket(messages.ChatSendMsgType, &messages.ChatSend{Text: "hello there"}).Pack()
+	split := func(group uint32) []*messages.Multipart {
+		half := len(packed) / 2
+		return []*messages.Multipart{
+			{ID: 0, GroupID: group, NumParts: 2, Content: packed[:half]},
+			{ID: 1, GroupID: group, NumParts: 2, Content: packed[half:]},
+		}
+	}
+	f := newFragments()
+	now := time.Now()
+
+	parts := split(1)
+	if _, ok := f.add(parts[1], now); ok {
+		t.Fatalf("Message shouldn't be done with one part.")
+	}
+	packet, ok := f.add(parts[0], now)
+	if !ok || packet.NetMsg.(*messages.ChatSend).Text != "hello there" {
+		t.Fatalf("Expected the message back once every part is in, got %v", packet.NetMsg)
+	}
+	if len(f.groups) != 0 {
+		t.Fatalf("Finished group should be forgotten.")
+	}
+
+	// Part counts no message could need are ignored.
+	if _, ok := f.add(&messages.Multipart{GroupID: 2, NumParts: uint16(maxFragmentParts + 1)}, now); ok || len(f.groups) != 0 {
+		t.Fatalf("Expected a huge group to be ignored.")
+	}
+
+	// Only a few groups are kept, the oldest go first.
+	for i := 0; i < maxFragmentGroups*2; i++ {
+		f.add(split(uint32(10 + i))[0], now.Add(time.Duration(i)*time.Millisecond))
+	}
+	if len(f.groups) != maxFragmentGroups || f.groups[10] != nil {
+		t.Fatalf("Expected only the newest %d groups kept, got %d.", maxFragmentGroups, len(f.groups))
+	}
+
+	// A group that takes too long is started over.
+	parts = split(3)
+	f.add(parts[0], now)
+	if _, ok := f.add(parts[1], now.Add(fragmentTimeout*2)); ok {
+		t.Fatalf("Expected the stale part to be dropped.")
+	}
+}
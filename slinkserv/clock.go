@@ -0,0 +1,53 @@
+package slinkserv
+
+import (
+	"sync/atomic"
+	"time"
+	"unsafe"
+
+	"github.com/lologarithm/slink/slinkserv/messages"
+)
+
+// gameClock publishes the tick a game is on so clients can answer clock sync
+// requests without waiting on the game's goroutine.
+type gameClock struct {
+	stamp *tickStamp // Swapped atomically by the game, use now to read it.
+}
+
+// tickStamp is when a game reached a tick, in server UnixNano.
+type tickStamp struct {
+	tick uint32
+	at   int64
+}
+
+// set records that the game reached tick at the given time. Only called by the game.
+func (gc *gameClock) set(tick uint32, at time.Time) {
+	stamp := &tickStamp{tick: tick, at: at.UnixNano()}
+	atomic.StorePointer((*unsafe.Pointer)(unsafe.Pointer(&gc.stamp)), unsafe.Pointer(stamp))
+}
+
+// now returns the last tick the game reached and when. Both are 0 before the game's first tick.
+func (gc *gameClock) now() (uint32, int64) {
+	stamp := (*tickStamp)(atomic.LoadPointer((*unsafe.Pointer)(unsafe.Pointer(&gc.stamp))))
+	if stamp == nil {
+		return 0, 0
+	}
+	return stamp.tick, stamp.at
+}
+
+// game returns the game the client is playing in, nil if it hasn't joined one.
+func (client *Client) game() *clientGame {
+	return (*clientGame)(atomic.LoadPointer((*unsafe.Pointer)(unsafe.Pointer(&client.activeGame))))
+}
+
+// syncReply answers a clock sync request. A request is a Heartbeat with only ClientTime set,
+// the reply echoes it back with the server's time and the tick of the client's game so the
+// client can work out its offset from the server and which tick to stamp on its turns.
+func (client *Client) syncReply(req *messages.Heartbeat) *messages.Heartbeat {
+	reply := &messages.Heartbeat{ClientTime: req.ClientTime}
+	if game := client.game(); game != nil && game.clock != nil {
+		reply.Tick, reply.TickTime = game.clock.now()
+	}
+	reply.Time = time.Now().UTC().UnixNano()
+	return reply
+}
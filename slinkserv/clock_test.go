@@ -0,0 +1,28 @@
+package slinkserv
+
+import (
+	"testing"
+	"time"
+
+	"github.com/lologarithm/slink/slinkserv/messages"
+)
+
+func TestSyncReply(t *testing.T) {
+	client := &Client{}
+	req := &messages.Heartbeat{ClientTime: 12345}
+	if reply := client.syncReply(req); reply.ClientTime != 12345 || reply.Time == 0 || reply.TickTime != 0 {
+		t.Fatalf("Reply outside a game should only have times set: %#v", reply)
+	}
+
+	game := &clientGame{clock: &gameClock{}}
+	client.activeGame = game
+	reached := time.Now().UTC()
+	game.clock.set(42, reached)
+	reply := client.syncReply(req)
+	if reply.Tick != 42 || reply.TickTime != reached.UnixNano() {
+		t.Fatalf("Expected tick 42 at %d, got %d at %d", reached.UnixNano(), reply.Tick, reply.TickTime)
+	}
+	if reply.Time < reply.TickTime {
+		t.Fatalf("Reply time %d should not be before the tick was reached (%d).", reply.Time, reply.TickTime)
+	}
+}
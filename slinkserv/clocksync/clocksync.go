@@ -0,0 +1,176 @@
+// Package clocksync estimates the server's clock and game tick from an NTP style
+// exchange carried on Heartbeat messages.
+//
+// A client sends Request and hands every Heartbeat with ClientTime set to Handle.
+// The server answers a request with its own time and the last tick its game reached,
+// from which Tick works out what tick the server is on right now, which is what
+// TurnSnake.TickID should be stamped with.
+package clocksync
+
+import (
+	"sync"
+	"time"
+
+	"github.com/lologarithm/slink/slinkserv/messages"
+)
+
+// window is how many exchanges the estimate is taken over.
+const window = 8
+
+// sample is the result of a single exchange, all in client UnixNano.
+type sample struct {
+	at     int64 // Midpoint of the exchange.
+	offset int64 // Server time minus client time.
+	rtt    int64
+}
+
+// Clock tracks the offset and drift between the local clock and the server's. It is safe
+// to call from multiple goroutines, usually one handling replies and one stamping turns.
+type Clock struct {
+	tickLength int64
+
+	mu      sync.Mutex
+	samples [window]sample
+	n       int
+
+	// Current estimate: offset at base, changing by drift per nanosecond after it.
+	offset int64
+	drift  float64
+	base   int64
+	rtt    int64
+
+	// Last tick reported by the server and when it was reached, in server time.
+	tick     uint32
+	tickTime int64
+}
+
+// New creates a Clock for a game that ticks every tickLength.
+func New(tickLength time.Duration) *Clock {
+	return &Clock{tickLength: int64(tickLength)}
+}
+
+// Request builds a sync request to send to the server.
+func (c *Clock) Request(now time.Time) *messages.Heartbeat {
+	return &messages.Heartbeat{ClientTime: now.UnixNano()}
+}
+
+// Handle takes a heartbeat from the server received at now. Returns false if it isn't
+// a reply to a sync request, in which case it should be handled as a normal heartbeat.
+func (c *Clock) Handle(hb *messages.Heartbeat, now time.Time) bool {
+	if hb.ClientTime == 0 {
+		return false
+	}
+	recv := now.UnixNano()
+	rtt := recv - hb.ClientTime
+	if rtt < 0 {
+		return true // Not one of ours, or the local clock went backwards.
+	}
+	mid := hb.ClientTime + rtt/2
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.samples[c.n%window] = sample{at: mid, offset: hb.Time - mid, rtt: rtt}
+	c.n++
+	if hb.TickTime != 0 {
+		c.tick, c.tickTime = hb.Tick, hb.TickTime
+	}
+	c.estimate()
+	return true
+}
+
+// estimate recalculates the offset and drift. The offset is taken from the exchange with the
+// shortest round trip since it has the least room for asymmetric delay, the drift is the slope
+// of the offsets of all exchanges that weren't much slower than that one. Called with mu held.
+func (c *Clock) estimate() {
+	n := c.n
+	if n > window {
+		n = window
+	}
+	best := c.samples[0]
+	for _, s := range c.samples[1:n] {
+		if s.rtt < best.rtt {
+			best = s
+		}
+	}
+	c.offset, c.base, c.rtt = best.offset, best.at, best.rtt
+
+	// Least squares fit of offset against time, relative to the best sample to keep the numbers small.
+	limit := 2*best.rtt + int64(time.Millisecond)
+	var count, sx, sy, sxx, sxy float64
+	for _, s := range c.samples[:n] {
+		if s.rtt > limit {
+			continue
+		}
+		x, y := float64(s.at-best.at), float64(s.offset-best.offset)
+		count++
+		sx += x
+		sy += y
+		sxx += x * x
+		sxy += x * y
+	}
+	c.drift = 0
+	if den := count*sxx - sx*sx; count >= 3 && den > 0 {
+		c.drift = (count*sxy - sx*sy) / den
+	}
+}
+
+// Synced returns true once at least one exchange has completed.
+func (c *Clock) Synced() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.n > 0
+}
+
+// Samples returns how many exchanges have completed.
+func (c *Clock) Samples() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.n
+}
+
+// Offset returns how far the server's clock is ahead of the local one, as of the best exchange.
+func (c *Clock) Offset() time.Duration {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return time.Duration(c.offset)
+}
+
+// Drift returns how much the offset changes per second of local time, in nanoseconds.
+func (c *Clock) Drift() float64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.drift * float64(time.Second)
+}
+
+// RTT returns the round trip of the exchange the offset was taken from.
+func (c *Clock) RTT() time.Duration {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return time.Duration(c.rtt)
+}
+
+// ServerTime returns what the server's clock reads at local time now, in UnixNano.
+func (c *Clock) ServerTime(now time.Time) int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.serverTime(now.UnixNano())
+}
+
+func (c *Clock) serverTime(local int64) int64 {
+	return local + c.offset + int64(c.drift*float64(local-c.base))
+}
+
+// Tick returns the tick the server's game is on at local time now.
+// Returns 0 until the server has replied from inside a game.
+func (c *Clock) Tick(now time.Time) uint32 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.tickTime == 0 || c.tickLength <= 0 {
+		return 0
+	}
+	elapsed := c.serverTime(now.UnixNano()) - c.tickTime
+	if elapsed < 0 {
+		return c.tick
+	}
+	return c.tick + uint32(elapsed/c.tickLength)
+}
@@ -0,0 +1,68 @@
+package clocksync
+
+import (
+	"testing"
+	"time"
+
+	"github.com/lologarithm/slink/slinkserv/messages"
+)
+
+// exchange simulates a sync with a server whose clock is ahead by offset and drifting by
+// drift nanoseconds per second, taking up and down for each leg.
+func exchange(c *Clock, local time.Time, offset time.Duration, drift float64, up, down time.Duration, tick uint32) {
+	req := c.Request(local)
+	at := local.Add(up)
+	server := at.UnixNano() + int64(offset) + int64(drift*at.Sub(time.Unix(0, 0)).Seconds())
+	reply := &messages.Heartbeat{
+		Time:       server,
+		ClientTime: req.ClientTime,
+		Tick:       tick,
+		TickTime:   server - int64(5*time.Millisecond),
+	}
+	if !c.Handle(reply, at.Add(down)) {
+		panic("sync reply not handled")
+	}
+}
+
+func TestClockOffset(t *testing.T) {
+	c := New(20 * time.Millisecond)
+	if c.Handle(&messages.Heartbeat{Time: 1}, time.Now()) {
+		t.Fatalf("Plain heartbeats should not be taken as sync replies.")
+	}
+
+	offset := 3 * time.Second
+	start := time.Unix(1000, 0)
+	// One slow, lopsided exchange and then some quick ones, the quick ones should win.
+	exchange(c, start, offset, 0, 80*time.Millisecond, 10*time.Millisecond, 100)
+	for i := 1; i < 5; i++ {
+		exchange(c, start.Add(time.Duration(i)*time.Second), offset, 0, 5*time.Millisecond, 5*time.Millisecond, 100)
+	}
+	if diff := c.Offset() - offset; diff < -time.Millisecond || diff > time.Millisecond {
+		t.Fatalf("Expected offset of %s, got %s", offset, c.Offset())
+	}
+
+	// The server reached tick 100 5ms before the last reply, 60ms later it should be 3 ticks on.
+	now := start.Add(4*time.Second + 10*time.Millisecond + 55*time.Millisecond)
+	if tick := c.Tick(now); tick != 103 {
+		t.Fatalf("Expected tick 103, got %d", tick)
+	}
+}
+
+func TestClockDrift(t *testing.T) {
+	c := New(20 * time.Millisecond)
+	start := time.Unix(1000, 0)
+	drift := float64(time.Millisecond) // Server gains a millisecond a second.
+	for i := 0; i < window; i++ {
+		exchange(c, start.Add(time.Duration(i)*time.Second), time.Second, drift, 5*time.Millisecond, 5*time.Millisecond, 1)
+	}
+	if d := c.Drift(); d < drift*0.9 || d > drift*1.1 {
+		t.Fatalf("Expected drift of %.0fns/s, got %.0fns/s", drift, d)
+	}
+
+	// A minute after the last exchange the drift should have been accounted for.
+	later := start.Add(time.Duration(window-1)*time.Second + time.Minute)
+	expected := later.UnixNano() + int64(time.Second) + int64(drift*later.Sub(time.Unix(0, 0)).Seconds())
+	if diff := c.ServerTime(later) - expected; diff < -int64(2*time.Millisecond) || diff > int64(2*time.Millisecond) {
+		t.Fatalf("Server time off by %s after a minute.", time.Duration(diff))
+	}
+}
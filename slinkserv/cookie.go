@@ -0,0 +1,64 @@
+package slinkserv
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"net"
+	"time"
+)
+
+// cookieLifetime is how long a client has to echo back a connect cookie.
+const cookieLifetime = 10 * time.Second
+
+// cookieLen is the size of an issued cookie: 8 bytes of issue time followed by the MAC.
+const cookieLen = 8 + sha256.Size
+
+// cookieJar issues and checks stateless connect cookies.
+// A cookie is an HMAC over the issue time and the address it was sent to, so the server
+// doesn't have to remember anything about a connection attempt until the client proves
+// it can receive packets at the address it claims to be sending from.
+type cookieJar struct {
+	secret []byte
+}
+
+func newCookieJar() *cookieJar {
+	secret := make([]byte, sha256.Size)
+	if _, err := rand.Read(secret); err != nil {
+		panic("unable to generate cookie secret: " + err.Error())
+	}
+	return &cookieJar{secret: secret}
+}
+
+// issue creates a new cookie for the given address.
+func (cj *cookieJar) issue(addr *net.UDPAddr, now time.Time) []byte {
+	cookie := make([]byte, 8, cookieLen)
+	binary.LittleEndian.PutUint64(cookie, uint64(now.Unix()))
+	return cj.sign(cookie, addr)
+}
+
+// valid returns true if the cookie was issued by this jar to addr and hasn't expired.
+func (cj *cookieJar) valid(cookie []byte, addr *net.UDPAddr, now time.Time) bool {
+	if len(cookie) != cookieLen {
+		return false
+	}
+	issued := time.Unix(int64(binary.LittleEndian.Uint64(cookie)), 0)
+	age := now.Sub(issued)
+	if age < 0 || age > cookieLifetime {
+		return false
+	}
+	expected := cj.sign(append(make([]byte, 0, cookieLen), cookie[:8]...), addr)
+	return hmac.Equal(cookie, expected)
+}
+
+// sign appends the MAC of the timestamp prefix and address to the cookie.
+func (cj *cookieJar) sign(cookie []byte, addr *net.UDPAddr) []byte {
+	mac := hmac.New(sha256.New, cj.secret)
+	mac.Write(cookie[:8])
+	mac.Write(addr.IP.To16())
+	port := make([]byte, 2)
+	binary.LittleEndian.PutUint16(port, uint16(addr.Port))
+	mac.Write(port)
+	return mac.Sum(cookie)
+}
@@ -0,0 +1,37 @@
+package slinkserv
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+func TestCookieJar(t *testing.T) {
+	cj := newCookieJar()
+	addr := &net.UDPAddr{IP: net.ParseIP("10.0.0.1"), Port: 4000}
+	now := time.Now()
+	cookie := cj.issue(addr, now)
+
+	if !cj.valid(cookie, addr, now.Add(time.Second)) {
+		t.Fatalf("Cookie should be valid for the address it was issued to.")
+	}
+	if cj.valid(cookie, &net.UDPAddr{IP: net.ParseIP("10.0.0.2"), Port: 4000}, now) {
+		t.Fatalf("Cookie should not be valid for a different IP.")
+	}
+	if cj.valid(cookie, &net.UDPAddr{IP: net.ParseIP("10.0.0.1"), Port: 4001}, now) {
+		t.Fatalf("Cookie should not be valid for a different port.")
+	}
+	if cj.valid(cookie, addr, now.Add(cookieLifetime+time.Second)) {
+		t.Fatalf("Cookie should expire.")
+	}
+	if newCookieJar().valid(cookie, addr, now) {
+		t.Fatalf("Cookie should not be valid for a different secret.")
+	}
+	cookie[len(cookie)-1]++
+	if cj.valid(cookie, addr, now) {
+		t.Fatalf("Tampered cookie should not be valid.")
+	}
+	if cj.valid(make([]byte, cookieLen), addr, now) {
+		t.Fatalf("Blank cookie should not be valid.")
+	}
+}
@@ -0,0 +1,123 @@
+package slinkserv
+
+import (
+	"errors"
+	"io"
+	"sync"
+	"sync/atomic"
+)
+
+// maxDatagram is the largest datagram the server reads off the socket.
+const maxDatagram = 8192
+
+// defaultInQueue is how many datagrams a client can have waiting to be processed.
+const defaultInQueue = 128
+
+// ErrQueueFull is returned when a datagram is pushed to a queue that has no room for it.
+var ErrQueueFull = errors.New("slinkserv: datagram queue full")
+
+// Datagram is one datagram read from the network. Its buffer comes from a pool
+// so call Release once done with it, Data can't be used after that.
+type Datagram struct {
+	Data []byte
+	buf  []byte
+}
+
+var datagramPool = sync.Pool{
+	New: func() interface{} {
+		return &Datagram{buf: make([]byte, maxDatagram)}
+	},
+}
+
+// Release returns the datagram's buffer to the pool.
+func (d *Datagram) Release() {
+	d.Data = nil
+	datagramPool.Put(d)
+}
+
+// DatagramQueue carries datagrams from the server's read loop to a client's ProcessBytes,
+// keeping each one whole so packet boundaries never have to be found again.
+// Push never blocks, a client that falls behind has its newest datagrams dropped just like
+// a full socket buffer would. Pop blocks until there is a datagram or the queue is closed.
+type DatagramQueue struct {
+	mu     sync.Mutex
+	ready  *sync.Cond // Signalled when a datagram is pushed or the queue is closed.
+	items  []*Datagram
+	head   int
+	n      int
+	closed bool
+
+	dropped uint64 // Datagrams thrown away because the queue was full, use atomic.
+}
+
+// NewDatagramQueue creates a queue holding up to size datagrams, 0 uses the default.
+func NewDatagramQueue(size int) *DatagramQueue {
+	if size <= 0 {
+		size = defaultInQueue
+	}
+	dq := &DatagramQueue{items: make([]*Datagram, size)}
+	dq.ready = sync.NewCond(&dq.mu)
+	return dq
+}
+
+// Push copies data into a pooled buffer and queues it.
+// Returns ErrQueueFull if it was dropped and io.ErrClosedPipe if the queue is closed.
+func (dq *DatagramQueue) Push(data []byte) error {
+	dq.mu.Lock()
+	defer dq.mu.Unlock()
+	if dq.closed {
+		return io.ErrClosedPipe
+	}
+	if dq.n == len(dq.items) {
+		atomic.AddUint64(&dq.dropped, 1)
+		return ErrQueueFull
+	}
+	d := datagramPool.Get().(*Datagram)
+	if len(data) > len(d.buf) {
+		d.buf = make([]byte, len(data))
+	}
+	d.Data = d.buf[:copy(d.buf, data)]
+	dq.items[(dq.head+dq.n)%len(dq.items)] = d
+	dq.n++
+	dq.ready.Signal()
+	return nil
+}
+
+// Pop returns the oldest datagram, waiting for one if the queue is empty.
+// Once the queue is closed the datagrams still in it are returned and then io.EOF.
+func (dq *DatagramQueue) Pop() (*Datagram, error) {
+	dq.mu.Lock()
+	defer dq.mu.Unlock()
+	for dq.n == 0 {
+		if dq.closed {
+			return nil, io.EOF
+		}
+		dq.ready.Wait()
+	}
+	d := dq.items[dq.head]
+	dq.items[dq.head] = nil
+	dq.head = (dq.head + 1) % len(dq.items)
+	dq.n--
+	return d, nil
+}
+
+// Len returns how many datagrams are waiting.
+func (dq *DatagramQueue) Len() int {
+	dq.mu.Lock()
+	defer dq.mu.Unlock()
+	return dq.n
+}
+
+// Dropped returns how many datagrams have been dropped because the queue was full.
+func (dq *DatagramQueue) Dropped() uint64 {
+	return atomic.LoadUint64(&dq.dropped)
+}
+
+// Close stops the queue and wakes the reader. Closing twice does nothing.
+func (dq *DatagramQueue) Close() error {
+	dq.mu.Lock()
+	dq.closed = true
+	dq.mu.Unlock()
+	dq.ready.Broadcast()
+	return nil
+}
@@ -0,0 +1,87 @@
+package slinkserv
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/lologarithm/slink/slinkserv/messages"
+)
+
+func TestDatagramQueue(t *testing.T) {
+	dq := NewDatagramQueue(2)
+	in := []byte{1, 2, 3}
+	if err := dq.Push(in); err != nil {
+		t.Fatalf("Push failed: %s", err)
+	}
+	in[0] = 9 // The queue should have its own copy.
+	dq.Push([]byte{4})
+	if err := dq.Push([]byte{5}); err != ErrQueueFull || dq.Dropped() != 1 {
+		t.Fatalf("Expected the third datagram to be dropped, got %v", err)
+	}
+
+	for _, want := range [][]byte{{1, 2, 3}, {4}} {
+		dg, err := dq.Pop()
+		if err != nil || !bytes.Equal(dg.Data, want) {
+			t.Fatalf("Expected datagram %v, got %v: %v", want, dg.Data, err)
+		}
+		dg.Release()
+	}
+
+	// A blocked Pop is woken by Close, and anything queued before the close is still returned.
+	popped := make(chan error, 1)
+	go func() {
+		_, err := dq.Pop()
+		popped <- err
+	}()
+	time.Sleep(10 * time.Millisecond)
+	dq.Close()
+	select {
+	case err := <-popped:
+		if err != io.EOF {
+			t.Fatalf("Expected EOF after close, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("Close didn't wake the blocked Pop.")
+	}
+	if err := dq.Push([]byte{6}); err != io.ErrClosedPipe {
+		t.Fatalf("Expected ErrClosedPipe pushing to a closed queue, got %v", err)
+	}
+}
+
+func TestCorruptDatagram(t *testing.T) {
+	gamechan := make(chan GameMessage, 10)
+	client := &Client{
+		address:         &net.UDPAddr{},
+		FromNetwork:     NewDatagramQueue(0),
+		FromGameManager: make(chan InternalMessage, 10),
+		toGameManager:   gamechan,
+	}
+	client.out = newOutQueue(client, nil, DefaultOutQueueLimits())
+	go client.ProcessBytes(make(chan *Client, 1))
+	<-gamechan // Connected
+
+	login := messages.NewPacket(messages.LoginMsgType, &messages.Login{Name: "testuser", Password: "testpass"}).Pack()
+	// A login cut off part way through, followed by a whole one in the next datagram.
+	// The cut off bytes must not be glued onto the next datagram.
+	client.FromNetwork.Push(append(append([]byte{}, login...), login[:len(login)/2]...))
+	client.FromNetwork.Push(login)
+	for i := 0; i < 2; i++ {
+		select {
+		case msg := <-gamechan:
+			if msg.mtype != messages.LoginMsgType {
+				t.Fatalf("Expected login, got message type %d", msg.mtype)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("Only got %d of 2 logins.", i)
+		}
+	}
+	select {
+	case msg := <-gamechan:
+		t.Fatalf("Got an extra message of type %d from the partial packet.", msg.mtype)
+	case <-time.After(50 * time.Millisecond):
+	}
+	client.FromNetwork.Close()
+}
@@ -0,0 +1,108 @@
+package slinkserv
+
+import (
+	"crypto/ecdh"
+	"crypto/rand"
+	"encoding/hex"
+	"os"
+	"strings"
+	"sync/atomic"
+	"unsafe"
+
+	"github.com/lologarithm/slink/slinkserv/messages"
+)
+
+// serverKeys is the X25519 key pair clients run the session key exchange against.
+// Clients ship with the public key and refuse a server that sends a different one,
+// so the pair has to stay the same across restarts.
+type serverKeys struct {
+	private  *ecdh.PrivateKey
+	public   []byte // Sent to clients in Connected.
+	required bool   // Refuse to create accounts or log in over an unencrypted session.
+}
+
+func newServerKeys(required bool) *serverKeys {
+	priv, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		panic("unable to generate server key: " + err.Error())
+	}
+	return &serverKeys{private: priv, public: priv.PublicKey().Bytes(), required: required}
+}
+
+// loadServerKeys reads the hex encoded private key at path. If there isn't one yet a new
+// key is generated and saved there, its public half has to be given to clients.
+// An empty path generates a key that only lasts until the server stops.
+func loadServerKeys(path string, required bool) (*serverKeys, error) {
+	if path == "" {
+		return newServerKeys(required), nil
+	}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		keys := newServerKeys(required)
+		return keys, os.WriteFile(path, []byte(hex.EncodeToString(keys.private.Bytes())+"\n"), 0600)
+	} else if err != nil {
+		return nil, err
+	}
+	raw, err := hex.DecodeString(strings.TrimSpace(string(data)))
+	if err != nil {
+		return nil, err
+	}
+	priv, err := ecdh.X25519().NewPrivateKey(raw)
+	if err != nil {
+		return nil, err
+	}
+	return &serverKeys{private: priv, public: priv.PublicKey().Bytes(), required: required}, nil
+}
+
+// sessionCipher returns the cipher for the client's session, nil until the client has sent a session key.
+// The server opens incoming datagrams with it and the sender seals outgoing ones, so always load it through here.
+func (client *Client) sessionCipher() *messages.SessionCipher {
+	return (*messages.SessionCipher)(atomic.LoadPointer((*unsafe.Pointer)(unsafe.Pointer(&client.cipher))))
+}
+
+func (client *Client) setSessionCipher(sc *messages.SessionCipher) {
+	atomic.StorePointer((*unsafe.Pointer)(unsafe.Pointer(&client.cipher)), unsafe.Pointer(sc))
+}
+
+// connectedMsg is the Connected reply for this client, carrying the server's public key if it has one.
+// Resumed tells the client whether it got its old session back or has to log in again.
+func (client *Client) connectedMsg() *messages.Connected {
+	connected := &messages.Connected{Resumed: byte(atomic.LoadInt32(&client.resumed))}
+	if client.keys != nil {
+		connected.PublicKey = client.keys.public
+	}
+	return connected
+}
+
+// startEncryption finishes the key exchange with the public key the client sent and acknowledges it.
+// The ack, and anything still queued to send, is sealed with the new key. From then on plaintext from the client is dropped.
+func (client *Client) startEncryption(msg *messages.SessionKey) {
+	if client.keys == nil || client.sessionCipher() != nil {
+		return
+	}
+	key, err := messages.OpenSessionKey(client.keys.private, msg.Key)
+	if err != nil {
+		return
+	}
+	sc, err := messages.NewSessionCipher(key, true)
+	if err != nil {
+		return
+	}
+	client.setSessionCipher(sc)
+	client.send(messages.SessionKeyAckMsgType, &messages.SessionKeyAck{})
+}
+
+// encryptionMissing returns true if the server requires encryption for this message and the
+// client hasn't set it up yet. The client is warned and the message should be dropped.
+func (client *Client) encryptionMissing(mtype messages.MessageType) bool {
+	if client.keys == nil || !client.keys.required || client.sessionCipher() != nil {
+		return false
+	}
+	if mtype != messages.CreateAcctMsgType && mtype != messages.LoginMsgType {
+		return false
+	}
+	client.send(messages.WarningMsgType, &messages.Warning{
+		Reason: "This server requires an encrypted session to log in.",
+	})
+	return true
+}
@@ -20,15 +20,16 @@ const (
 
 // GameSession represents a single game
 type GameSession struct {
-	ID uint32
+	ID   uint32
+	Code string // Join code for private games, which are never matched with strangers. Empty for public games.
 
 	// map character ID to client
-	Clients map[uint32]*User
+	Clients    map[uint32]*User
+	Spectators map[uint32]*User // Clients watching without a snake, by client ID.
 
-	IntoGameManager chan<- GameMessage     // Game can only write to this channel, not read.
-	FromGameManager chan InternalMessage   // Messages from the game Manager.
-	FromNetwork     chan GameMessage       // FromNetwork is read only here, messages from players.
-	ToNetwork       chan<- OutgoingMessage // Messages to players!
+	IntoGameManager chan<- GameMessage   // Game can only write to this channel, not read.
+	FromGameManager chan InternalMessage // Messages from the game Manager.
+	FromNetwork     chan GameMessage     // FromNetwork is read only here, messages from players.
 
 	Exit   chan int
 	Status GameStatus
@@ -36,6 +37,11 @@ type GameSession struct {
 	// Private
 	World     *GameWorld // Current world state
 	StartTime time.Time
+	clock     gameClock             // Last tick reached, read by clients without going through the game.
+	lives     map[uint32]*snakeLife // Stats for the current life of each snake with an account, by snake ID.
+	stats     map[string]*Stats     // Stats waiting to be sent to the manager, by account name.
+	names     *nameFilter           // Blocked words are masked out of chat.
+	dropped   uint64                // Chat and strikes thrown away because the manager was busy.
 
 	// Historical state
 	prevWorlds     [historySize]*GameWorld // Last 1 second of game states. Each state is 10 ticks(50 ticks/sec)
@@ -57,6 +63,8 @@ func (g *GameSession) replayHistory(ticks uint32) {
 		}
 		// 2. call tick
 		collisions := g.World.Tick()
+		// Ticks are replayed after a late turn, only count stats the first time through.
+		fresh := g.World.CurrentTickID > g.World.RealTickID
 		if g.World.CurrentTickID > g.World.RealTickID {
 			g.World.RealTickID = g.World.CurrentTickID
 		}
@@ -89,9 +97,24 @@ func (g *GameSession) replayHistory(ticks uint32) {
 					seg.Size = col.Snake.Size
 				}
 				fmt.Printf("Snake %d ate a food, size is now: %d\n", col.Snake.ID, col.Snake.Size)
+				if life := g.lives[col.Snake.ID]; fresh && life != nil {
+					life.food++
+					if col.Snake.Size > life.peak {
+						life.peak = col.Snake.Size
+					}
+				}
 				g.sendEat(col.Snake, col.Entity)
 			case ETypeSegment:
 				// Snake ded
+				if g.World.Snakes[col.Snake.ID] == nil {
+					break // Already died hitting another segment this tick.
+				}
+				if fresh {
+					if life := g.lives[g.segmentOwner(col.Entity.ID)]; life != nil {
+						life.kills++
+					}
+					g.endLife(col.Snake.ID, true)
+				}
 				g.sendDied(col.Snake.ID)
 				g.removeSnake(col.Snake)
 				spawns := make([]*messages.UpdateEntity, len(col.Snake.Segments))
@@ -211,6 +234,14 @@ func (g *GameSession) Run() {
 			// If we didn't timeout, try a non-blocking select here.
 			select {
 			case msg := <-g.FromNetwork:
+				if chat, ok := msg.net.(*messages.ChatSend); ok {
+					g.handleChat(msg.clientID, chat)
+					break // Chat doesn't change the world so isn't kept with the commands.
+				}
+				if sp, ok := msg.net.(*messages.Spectate); ok {
+					g.handleSpectate(msg.clientID, sp)
+					break
+				}
 				msg.currentTick = g.World.RealTickID
 				if setmsg, ok := msg.net.(*messages.TurnSnake); ok {
 					if g.World.RealTickID-setmsg.TickID > 50 {
@@ -228,17 +259,7 @@ func (g *GameSession) Run() {
 						g.resetToHistory(setmsg.TickID - 1)
 					}
 
-					frame := messages.Frame{
-						// Seq Doesn't matter because its set by server when its sent.
-						MsgType:       messages.TurnSnakeMsgType,
-						ContentLength: uint16(setmsg.Len()),
-					}
-					g.sendToAll(OutgoingMessage{
-						msg: messages.Packet{
-							Frame:  frame,
-							NetMsg: setmsg,
-						},
-					})
+					g.sendToAll(NewOutgoingMsg(nil, messages.TurnSnakeMsgType, setmsg))
 					// log.Printf(" Applying turn took: %dus", time.Now().Sub(st).Nanoseconds()/int64(time.Microsecond))
 				}
 
@@ -248,9 +269,18 @@ func (g *GameSession) Run() {
 				case AddPlayer:
 					g.addPlayer(timsg)
 				case RemovePlayer:
+					if g.Spectators[timsg.Client.ID] != nil {
+						log.Printf("Removing spectator %d from game %d.", timsg.Client.ID, g.ID)
+						delete(g.Spectators, timsg.Client.ID)
+						break
+					}
 					log.Printf("Removing player %d from game %d.", timsg.Client.ID, g.ID)
 					user := g.Clients[timsg.Client.ID]
+					if user == nil {
+						break // Already removed.
+					}
 					delete(g.Clients, timsg.Client.ID)
+					g.endLife(user.SnakeID, false)
 					if g.World.RealTickID == g.World.CurrentTickID {
 						snake := g.World.Snakes[user.SnakeID]
 						if snake == nil {
@@ -266,6 +296,27 @@ func (g *GameSession) Run() {
 						currentTick: g.World.RealTickID - 1,
 					}
 					g.commandHistory = append(g.commandHistory, removecmd)
+				case SuspendPlayer:
+					// Snake keeps going while we wait to see if the player comes back.
+					if user := g.user(timsg.Client.ID); user != nil {
+						log.Printf("Suspending player %d in game %d.", timsg.Client.ID, g.ID)
+						user.Lost = true
+					}
+				case MutePlayer:
+					if user := g.user(timsg.Client.ID); user != nil {
+						user.mutedUntil = timsg.Until
+					}
+				case GlobalChat:
+					g.sendToAll(NewOutgoingMsg(nil, messages.ChatMsgType, timsg.Chat))
+				case ResumePlayer:
+					if user := g.user(timsg.Client.ID); user != nil {
+						log.Printf("Resuming player %d in game %d.", timsg.Client.ID, g.ID)
+						user.Lost = false
+						g.sendGameConnected(user.Client, user.SnakeID)
+						if user.Spectator {
+							g.follow(user, user.Watching)
+						}
+					}
 				}
 			case <-g.Exit:
 				fmt.Printf("EXITING: Game %d.\n", g.ID)
@@ -276,6 +327,7 @@ func (g *GameSession) Run() {
 			}
 		}
 
+		g.sendStats()
 		expectedTick := (time.Now().UnixNano() - g.StartTime.UnixNano()) / int64(g.World.TickLength*float64(time.Millisecond))
 		st := time.Now()
 		for g.World.CurrentTickID < uint32(expectedTick) {
@@ -307,14 +359,23 @@ func (g *GameSession) Run() {
 					if spawns[0] != nil { // Only send spawn messages if we are spawning.
 						g.sendSpawns(spawns)
 					}
+					g.sendLeaderboard()
 				}
 				// fmt.Printf("  RealTick: %d", g.World.RealTickID)
 				if g.World.RealTickID%250 == 0 { // every 5 seconds
 					g.SendMasterFrame()
 				}
+				if g.World.RealTickID%minimapTicks == 0 {
+					g.sendMinimap()
+				}
+				g.updateSpectators()
 			}
 		}
 
+		if tick, _ := g.clock.now(); tick != g.World.RealTickID {
+			g.clock.set(g.World.RealTickID, time.Now().UTC())
+		}
+
 		ttidx++
 		if ttidx == 50 {
 			ttidx = 0
@@ -370,6 +431,10 @@ func (g *GameSession) addEntity(ID uint32, etype uint16, loc physics.Vect2, size
 
 // addPlayer will create a snake, add it to the game, and return the successful connection message to the player.
 func (g *GameSession) addPlayer(ap AddPlayer) {
+	if ap.Spectate {
+		g.addSpectator(ap)
+		return
+	}
 	newid := (g.World.MaxID + 1)
 	snake := NewSnake(newid, ap.Entity.Name)
 	g.World.MaxID += 1 + uint32(len(snake.Segments))
@@ -380,22 +445,19 @@ func (g *GameSession) addPlayer(ap AddPlayer) {
 		log.Printf("Added player but game isn't live(%d) yet, not adding snake until tick (%d).", g.World.CurrentTickID, g.World.RealTickID)
 	}
 	g.Clients[ap.Client.ID] = &User{
-		Account: nil,
-		SnakeID: newid,
-		GameID:  g.ID,
-		Client:  ap.Client,
+		Account:    ap.Account,
+		SnakeID:    newid,
+		GameID:     g.ID,
+		Client:     ap.Client,
+		Name:       ap.Entity.Name,
+		mutedUntil: ap.MutedUntil,
 	}
-
-	cgr := &messages.GameConnected{
-		ID:       g.ID,
-		TickID:   g.World.RealTickID,
-		SnakeID:  newid,
-		Entities: g.World.EntitiesMsg(),
-		Snakes:   g.World.SnakesMsg(),
+	if ap.Account != nil && !ap.Account.Guest {
+		g.lives[newid] = &snakeLife{name: ap.Account.Name, born: time.Now(), peak: snake.Size}
+		g.addStats(&messages.PlayerStats{Name: ap.Account.Name, GamesPlayed: 1})
 	}
 
-	outgoing := NewOutgoingMsg(ap.Client, messages.GameConnectedMsgType, cgr)
-	ap.Client.ToNetwork <- outgoing
+	g.sendGameConnected(ap.Client, newid)
 
 	addcmd := GameMessage{
 		clientID:    newid,
@@ -406,6 +468,24 @@ func (g *GameSession) addPlayer(ap AddPlayer) {
 	g.commandHistory = append(g.commandHistory, addcmd)
 }
 
+// sendGameConnected sends the full game state to a client controlling snakeID.
+// Spectators also get the food in their area.
+func (g *GameSession) sendGameConnected(client *Client, snakeID uint32) {
+	cgr := &messages.GameConnected{
+		ID:       g.ID,
+		TickID:   g.World.RealTickID,
+		SnakeID:  snakeID,
+		Entities: g.World.EntitiesMsg(),
+		Snakes:   g.World.SnakesMsg(),
+		Code:     g.Code,
+	}
+	if user := g.Spectators[client.ID]; user != nil {
+		cgr.Entities = g.spectatorEntities(user)
+	}
+
+	client.send(messages.GameConnectedMsgType, cgr)
+}
+
 func (g *GameSession) addSnake(newid uint32, name string) {
 	log.Printf("Adding snake after tick: %d", newid)
 	if g.World.Snakes[newid] != nil {
@@ -422,6 +502,70 @@ func (g *GameSession) addSnake(newid uint32, name string) {
 	}
 }
 
+// segmentOwner returns the ID of the snake a body segment belongs to, 0 if it isn't part of one.
+func (g *GameSession) segmentOwner(segID uint32) uint32 {
+	for id, s := range g.World.Snakes {
+		for _, seg := range s.Segments {
+			if seg.ID == segID {
+				return id
+			}
+		}
+	}
+	return 0
+}
+
+// snakeLife tracks what a player's snake did between joining and dying or leaving.
+type snakeLife struct {
+	name  string // Account name.
+	born  time.Time
+	kills uint32
+	food  uint32
+	peak  int32
+}
+
+// endLife adds a snake's life to the player's stats.
+func (g *GameSession) endLife(snakeID uint32, died bool) {
+	life := g.lives[snakeID]
+	if life == nil {
+		return
+	}
+	delete(g.lives, snakeID)
+	report := &messages.PlayerStats{
+		Name:       life.name,
+		Kills:      life.kills,
+		PeakLength: uint32(life.peak),
+		FoodEaten:  life.food,
+		TimeAlive:  uint32(time.Since(life.born) / time.Second),
+	}
+	if died {
+		report.Deaths = 1
+	}
+	g.addStats(report)
+}
+
+// addStats adds to the stats waiting to be sent to the manager for a player.
+func (g *GameSession) addStats(r *messages.PlayerStats) {
+	s := g.stats[r.Name]
+	if s == nil {
+		s = &Stats{}
+		g.stats[r.Name] = s
+	}
+	s.add(r)
+}
+
+// sendStats sends the manager the stats gathered since the last tick. The game never waits on
+// the manager, stats it has no room for are kept and sent with the next tick's.
+func (g *GameSession) sendStats() {
+	for name, s := range g.stats {
+		select {
+		case g.IntoGameManager <- GameMessage{net: s.toMsg(name), mtype: messages.PlayerStatsMsgType}:
+			delete(g.stats, name)
+		default:
+			return
+		}
+	}
+}
+
 func (g *GameSession) setDirection(facing int16, snakeID uint32) {
 	snake := g.World.Snakes[snakeID]
 	if snake == nil {
@@ -432,31 +576,26 @@ func (g *GameSession) setDirection(facing int16, snakeID uint32) {
 
 func (g *GameSession) sendToAll(msg OutgoingMessage) {
 	msg.data = msg.msg.Pack()
-	for _, c := range g.Clients {
-		msg.dest = c.Client
-		g.ToNetwork <- msg
+	for _, users := range []map[uint32]*User{g.Clients, g.Spectators} {
+		for _, c := range users {
+			if c.Lost {
+				continue
+			}
+			c.Client.queue(msg)
+		}
 	}
 }
 func (g *GameSession) sendDied(snakeID uint32) {
 	removeSnake := &messages.SnakeDied{
 		ID: snakeID,
 	}
-	frame := messages.Frame{
-		MsgType:       messages.SnakeDiedMsgType,
-		Seq:           1,
-		ContentLength: uint16(removeSnake.Len()),
-	}
-	g.sendToAll(OutgoingMessage{
-		msg: messages.Packet{
-			Frame:  frame,
-			NetMsg: removeSnake,
-		},
-	})
+	g.sendToAll(NewOutgoingMsg(nil, messages.SnakeDiedMsgType, removeSnake))
 }
 func (g *GameSession) sendEat(snake *Snake, food *Entity) {
 	msg := NewOutgoingMsg(nil, messages.RemoveEntityMsgType, &messages.RemoveEntity{
 		Ent: food.toMsg(),
 	})
+	// Removals go to every spectator, they may still have food from an area they've moved on from.
 	g.sendToAll(msg)
 	msg = NewOutgoingMsg(nil, messages.UpdateEntityMsgType, &messages.UpdateEntity{
 		Ent: snake.Entity.toMsg(),
@@ -465,24 +604,57 @@ func (g *GameSession) sendEat(snake *Snake, food *Entity) {
 
 }
 
-// sendSpawns
+// sendSpawns lets clients know about new food. Spawns come in bursts and the next master
+// frame has them anyway, so they are the first thing dropped for a client that is behind.
 func (g *GameSession) sendSpawns(spawns []*messages.UpdateEntity) {
 	for _, s := range spawns {
-		frame := messages.Frame{
-			MsgType:       messages.UpdateEntityMsgType,
-			Seq:           1,
-			ContentLength: uint16(s.Len()),
+		msg := NewOutgoingMsg(nil, messages.UpdateEntityMsgType, s)
+		msg.priority = PriorityCosmetic
+		g.sendNear(msg, physics.Vect2{X: s.Ent.X, Y: s.Ent.Y})
+	}
+}
+
+// leaderboardLen is how many snakes the in game leaderboard lists.
+const leaderboardLen = 10
+
+// sendLeaderboard sends every player the biggest snakes in the game, along with where their own
+// snake ranks, or for spectators the snake they are watching. It is resent every second so it goes out as cosmetic.
+func (g *GameSession) sendLeaderboard() {
+	if len(g.Clients)+len(g.Spectators) == 0 {
+		return
+	}
+	snakes := g.World.snakesBySize()
+	ranks := make(map[uint32]uint32, len(snakes))
+	for i, s := range snakes {
+		ranks[s.ID] = uint32(i + 1)
+	}
+	if len(snakes) > leaderboardLen {
+		snakes = snakes[:leaderboardLen]
+	}
+	entries := make([]*messages.LeaderboardEntry, len(snakes))
+	for i, s := range snakes {
+		entries[i] = &messages.LeaderboardEntry{SnakeID: s.ID, Name: s.Name, Size: s.Size}
+	}
+	for _, users := range []map[uint32]*User{g.Clients, g.Spectators} {
+		for _, c := range users {
+			if c.Lost {
+				continue
+			}
+			snakeID := c.SnakeID
+			if c.Spectator {
+				snakeID = c.Watching
+			}
+			c.Client.send(messages.LeaderboardMsgType, &messages.Leaderboard{
+				Entries: entries,
+				Rank:    ranks[snakeID], // 0 once their snake has died.
+				Players: uint32(len(ranks)),
+			})
 		}
-		g.sendToAll(OutgoingMessage{
-			msg: messages.Packet{
-				Frame:  frame,
-				NetMsg: s,
-			},
-		})
 	}
 }
 
 // SendMasterFrame will create a 'master' state of all things and send to each client.
+// Spectators each get their own with the food in their area.
 func (g *GameSession) SendMasterFrame() {
 	mf := &messages.GameMasterFrame{
 		ID:       g.ID,
@@ -490,21 +662,25 @@ func (g *GameSession) SendMasterFrame() {
 		Snakes:   g.World.SnakesMsg(),
 		Tick:     g.World.RealTickID,
 	}
-	frame := messages.Frame{
-		MsgType:       messages.GameMasterFrameMsgType,
-		Seq:           1,
-		ContentLength: uint16(mf.Len()),
+	msg := NewOutgoingMsg(nil, messages.GameMasterFrameMsgType, mf)
+	msg.data = msg.msg.Pack()
+	for _, c := range g.Clients {
+		if !c.Lost {
+			c.Client.queue(msg)
+		}
+	}
+	for _, c := range g.Spectators {
+		if c.Lost {
+			continue
+		}
+		smf := *mf
+		smf.Entities = g.spectatorEntities(c)
+		c.Client.send(messages.GameMasterFrameMsgType, &smf)
 	}
-	g.sendToAll(OutgoingMessage{
-		msg: messages.Packet{
-			Frame:  frame,
-			NetMsg: mf,
-		},
-	})
 }
 
 // NewGame constructs a new game and starts it.
-func NewGame(toGameManager chan<- GameMessage, toNetwork chan<- OutgoingMessage) *GameSession {
+func NewGame(toGameManager chan<- GameMessage) *GameSession {
 	seed := uint64(rand.Uint32())
 	seed = seed << 32
 	seed += uint64(rand.Uint32())
@@ -513,10 +689,13 @@ func NewGame(toGameManager chan<- GameMessage, toNetwork chan<- OutgoingMessage)
 		IntoGameManager: toGameManager,
 		FromGameManager: make(chan InternalMessage, 100),
 		FromNetwork:     netchan,
-		ToNetwork:       toNetwork,
 		World:           NewWorld(),
 		Exit:            make(chan int, 1),
 		Clients:         make(map[uint32]*User, 16),
+		Spectators:      map[uint32]*User{},
+		lives:           map[uint32]*snakeLife{},
+		stats:           map[string]*Stats{},
+		names:           &nameFilter{},
 		commandHistory:  make([]GameMessage, 0, 10),
 	}
 	return g
@@ -530,6 +709,7 @@ type GameMessage struct {
 	currentTick uint32 // Tick when the game processed this mesage.
 	clientID    uint32 // ID of client. Cached so you can clear client.
 	clientName  string // Name of client so you can clear client.
+	lost        bool   // Disconnects only: the client timed out but can still resume its session.
 }
 
 // InternalMessage is for messages between internal components (gamesession and gamemanager) that never leaves the server.
@@ -540,6 +720,7 @@ type InternalMessage interface {
 type ConnectedGame struct {
 	ID     uint32
 	ToGame chan<- GameMessage
+	Clock  *gameClock // Tick the game is on, used to answer clock sync requests.
 }
 
 // RemovePlayer is sent to remove a player from a game.
@@ -547,8 +728,33 @@ type RemovePlayer struct {
 	Client *Client
 }
 
+// SuspendPlayer is sent when a player's connection is lost but their session can still be resumed.
+type SuspendPlayer struct {
+	Client *Client
+}
+
+// ResumePlayer is sent when a suspended player's client comes back.
+type ResumePlayer struct {
+	Client *Client
+}
+
 // AddPlayer is sent to add a player to a game.
 type AddPlayer struct {
-	Entity *Entity
+	Entity  *Entity
+	Client  *Client
+	Account *Account // Who is playing, stats are kept for them unless they are a guest.
+
+	MutedUntil time.Time // The player can't chat until then.
+	Spectate   bool      // Watch the game without a snake.
+}
+
+// MutePlayer is sent when a player is muted, they can't chat until Until.
+type MutePlayer struct {
 	Client *Client
+	Until  time.Time
+}
+
+// GlobalChat is a chat message for every player in every game.
+type GlobalChat struct {
+	Chat *messages.Chat
 }
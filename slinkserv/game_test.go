@@ -3,13 +3,14 @@ package slinkserv
 import (
 	"fmt"
 	"testing"
+
+	"github.com/lologarithm/slink/slinkserv/messages"
+	"github.com/lologarithm/survival/physics"
 )
 
 func TestTick(t *testing.T) {
 	tgm := make(chan GameMessage, 100)
-	ton := make(chan OutgoingMessage, 100)
-
-	g := NewGame(tgm, ton)
+	g := NewGame(tgm)
 	g.addSnake(1, "test")
 	g.setDirection(1, 1)
 
@@ -27,3 +28,92 @@ func TestTick(t *testing.T) {
 		fmt.Printf("  Ent %d @ (%v,%v)\n", ent.ID, ent.X, ent.Y)
 	}
 }
+
+func TestSnakeStats(t *testing.T) {
+	tgm := make(chan GameMessage, 100)
+	g := NewGame(tgm)
+	_, clients := newTestManager(DefaultConfig(), 2)
+	g.addPlayer(AddPlayer{Entity: &Entity{Name: "alice"}, Client: clients[1], Account: &Account{Name: "alice"}})
+	g.addPlayer(AddPlayer{Entity: &Entity{Name: "bob"}, Client: clients[2], Account: &Account{Name: "bob"}})
+	g.sendStats()
+	for i := 0; i < 2; i++ {
+		if report := (<-tgm).net.(*messages.PlayerStats); report.GamesPlayed != 1 {
+			t.Fatalf("Expected a game played for joining, got %+v", report)
+		}
+	}
+	alice, bob := g.Clients[1].SnakeID, g.Clients[2].SnakeID
+
+	// Lay bob out sideways with his head on alice's body, well away from her head.
+	target := g.World.Snakes[alice].Segments[5].Position
+	for i, e := range append([]*Entity{g.World.Snakes[bob].Entity}, g.World.Snakes[bob].Segments...) {
+		old := e.Bounds()
+		e.Position = physics.Vect2{X: target.X - int32(i)*150, Y: target.Y}
+		g.World.Tree.Move(e, old)
+	}
+	g.replayHistory(1)
+	g.sendStats()
+
+	report := (<-tgm).net.(*messages.PlayerStats)
+	if report.Name != "bob" || report.Deaths != 1 || report.PeakLength != 300 {
+		t.Fatalf("Expected bob's death to be reported, got %+v", report)
+	}
+	g.endLife(alice, false)
+	g.sendStats()
+	if report := (<-tgm).net.(*messages.PlayerStats); report.Name != "alice" || report.Kills != 1 || report.Deaths != 0 {
+		t.Fatalf("Expected alice to get the kill, got %+v", report)
+	}
+}
+
+func TestStatsWaitForManager(t *testing.T) {
+	tgm := make(chan GameMessage, 1)
+	g := NewGame(tgm)
+	_, clients := newTestManager(DefaultConfig(), 1)
+	tgm <- GameMessage{} // The manager is behind.
+	g.addPlayer(AddPlayer{Entity: &Entity{Name: "alice"}, Client: clients[1], Account: &Account{Name: "alice"}})
+	snake := g.Clients[1].SnakeID
+
+	// There's no room, so the stats are held on to rather than blocking the game.
+	g.sendStats()
+	g.endLife(snake, true)
+	g.sendStats()
+	if s := g.stats["alice"]; s == nil || s.GamesPlayed != 1 || s.Deaths != 1 {
+		t.Fatalf("Expected alice's stats kept together until the manager has room, got %+v", s)
+	}
+
+	<-tgm
+	g.sendStats()
+	if report := (<-tgm).net.(*messages.PlayerStats); report.GamesPlayed != 1 || report.Deaths != 1 {
+		t.Fatalf("Expected one report with everything alice did, got %+v", report)
+	}
+}
+
+func TestLeaderboard(t *testing.T) {
+	g := NewGame(make(chan GameMessage, 100))
+	_, clients := newTestManager(DefaultConfig(), 3)
+	for id, name := range []string{"", "alice", "bob", "carol"} {
+		if id > 0 {
+			g.addPlayer(AddPlayer{Entity: &Entity{Name: name}, Client: clients[id]})
+			clients[id].out.pop() // GameConnected
+		}
+	}
+	g.World.Snakes[g.Clients[2].SnakeID].Size = 900
+	g.World.Snakes[g.Clients[3].SnakeID].Size = 600
+	g.sendLeaderboard()
+
+	for id, rank := range []uint32{0, 3, 1, 2} {
+		if id == 0 {
+			continue
+		}
+		msg, ok := clients[id].out.pop()
+		if !ok {
+			t.Fatalf("Client %d didn't get a leaderboard.", id)
+		}
+		lb := msg.msg.NetMsg.(*messages.Leaderboard)
+		if lb.Rank != rank || lb.Players != 3 {
+			t.Fatalf("Expected client %d to be rank %d of 3, got %d of %d", id, rank, lb.Rank, lb.Players)
+		}
+		if len(lb.Entries) != 3 || lb.Entries[0].Name != "bob" || lb.Entries[0].Size != 900 || lb.Entries[2].Name != "alice" {
+			t.Fatalf("Expected snakes ordered by size, got %v", lb.Entries)
+		}
+	}
+}
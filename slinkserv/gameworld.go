@@ -2,6 +2,7 @@ package slinkserv
 
 import (
 	"log"
+	"sort"
 
 	"github.com/lologarithm/slink/slinkserv/messages"
 	"github.com/lologarithm/survival/physics"
@@ -47,6 +48,21 @@ func NewWorld() *GameWorld {
 	}
 }
 
+// snakesBySize returns every snake, biggest first.
+func (gw *GameWorld) snakesBySize() []*Snake {
+	snakes := make([]*Snake, 0, len(gw.Snakes))
+	for _, s := range gw.Snakes {
+		snakes = append(snakes, s)
+	}
+	sort.Slice(snakes, func(i, j int) bool {
+		if snakes[i].Size != snakes[j].Size {
+			return snakes[i].Size > snakes[j].Size
+		}
+		return snakes[i].ID < snakes[j].ID
+	})
+	return snakes
+}
+
 // Clone returns a deep copy of the game world at this time.
 func (gw *GameWorld) Clone() *GameWorld {
 	nw := NewWorld()
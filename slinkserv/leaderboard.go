@@ -0,0 +1,142 @@
+package slinkserv
+
+import (
+	"log"
+	"sort"
+	"time"
+
+	"github.com/lologarithm/slink/slinkserv/messages"
+)
+
+// topPlayersLen is how many players a TopPlayers response lists.
+const topPlayersLen = 10
+
+// topPlayersTTL is how long a ranking is reused before every account is looked through again.
+const topPlayersTTL = 5 * time.Second
+
+type topPlayersKey struct {
+	stat  byte
+	daily bool
+}
+
+type topPlayersList struct {
+	at      time.Time
+	players []*messages.PlayerStats
+}
+
+// statsDay is the day daily stats are counted against.
+func statsDay(now time.Time) string {
+	return now.UTC().Format("2006-01-02")
+}
+
+// add folds a report from a game into the totals.
+func (s *Stats) add(r *messages.PlayerStats) {
+	s.GamesPlayed += r.GamesPlayed
+	s.Kills += r.Kills
+	s.Deaths += r.Deaths
+	s.FoodEaten += r.FoodEaten
+	s.TimeAlive += r.TimeAlive
+	if r.PeakLength > s.PeakLength {
+		s.PeakLength = r.PeakLength
+	}
+}
+
+func (s Stats) toMsg(name string) *messages.PlayerStats {
+	return &messages.PlayerStats{
+		Name:        name,
+		GamesPlayed: s.GamesPlayed,
+		Kills:       s.Kills,
+		Deaths:      s.Deaths,
+		PeakLength:  s.PeakLength,
+		FoodEaten:   s.FoodEaten,
+		TimeAlive:   s.TimeAlive,
+	}
+}
+
+// statValue returns the stat players are ranked by.
+func statValue(s *messages.PlayerStats, stat byte) uint32 {
+	switch stat {
+	case messages.StatPeakLength:
+		return s.PeakLength
+	case messages.StatKills:
+		return s.Kills
+	case messages.StatFoodEaten:
+		return s.FoodEaten
+	case messages.StatTimeAlive:
+		return s.TimeAlive
+	case messages.StatGamesPlayed:
+		return s.GamesPlayed
+	}
+	return 0
+}
+
+// recordStats adds a game's report to the player's account, it is saved on the next saveStats.
+func (gm *GameManager) recordStats(msg GameMessage) {
+	report := msg.net.(*messages.PlayerStats)
+	acct, err := gm.accounts.ByName(report.Name)
+	if err != nil {
+		log.Printf("GM: got stats for unknown account %s.", report.Name)
+		return
+	}
+	if day := statsDay(time.Now()); acct.Day != day {
+		acct.Today = Stats{}
+		acct.Day = day
+	}
+	acct.Stats.add(report)
+	acct.Today.add(report)
+	gm.unsaved[acct] = true
+}
+
+// saveStats writes every account with new stats to the store. Stats change with every
+// snake that dies so they are saved in batches rather than one write each.
+func (gm *GameManager) saveStats() {
+	for acct := range gm.unsaved {
+		if err := gm.accounts.Update(acct); err != nil {
+			log.Printf("GM: failed to save stats for %s: %s", acct.Name, err)
+		}
+		delete(gm.unsaved, acct)
+	}
+}
+
+func (gm *GameManager) sendTopPlayers(msg GameMessage) {
+	req := msg.net.(*messages.TopPlayersReq)
+	msg.client.send(messages.TopPlayersMsgType, &messages.TopPlayers{
+		Stat:    req.Stat,
+		Daily:   req.Daily,
+		Players: gm.topPlayers(req.Stat, req.Daily != 0, time.Now()),
+	})
+}
+
+// topPlayers ranks accounts by a stat, either all time or for today.
+func (gm *GameManager) topPlayers(stat byte, daily bool, now time.Time) []*messages.PlayerStats {
+	key := topPlayersKey{stat: stat, daily: daily}
+	if list, ok := gm.topLists[key]; ok && now.Sub(list.at) < topPlayersTTL {
+		return list.players
+	}
+	today := statsDay(now)
+	players := []*messages.PlayerStats{}
+	gm.accounts.Each(func(acct *Account) {
+		s := acct.Stats
+		if daily {
+			if acct.Day != today {
+				return
+			}
+			s = acct.Today
+		}
+		if p := s.toMsg(acct.Name); statValue(p, stat) > 0 {
+			players = append(players, p)
+		}
+	})
+	sort.Slice(players, func(i, j int) bool {
+		vi, vj := statValue(players[i], stat), statValue(players[j], stat)
+		if vi != vj {
+			return vi > vj
+		}
+		return players[i].Name < players[j].Name
+	})
+	if len(players) > topPlayersLen {
+		players = players[:topPlayersLen]
+	}
+	gm.topLists[key] = topPlayersList{at: now, players: players}
+	return players
+}
@@ -0,0 +1,64 @@
+package slinkserv
+
+import (
+	"testing"
+	"time"
+
+	"github.com/lologarithm/slink/slinkserv/messages"
+)
+
+func TestTopPlayers(t *testing.T) {
+	gm, _ := newTestManager(DefaultConfig(), 0)
+	for _, name := range []string{"alice", "bob", "carol"} {
+		gm.accounts.Create(name, "")
+	}
+	report := func(r *messages.PlayerStats) {
+		gm.ProcessGameMsg(GameMessage{net: r, mtype: messages.PlayerStatsMsgType})
+	}
+	report(&messages.PlayerStats{Name: "alice", Kills: 2, PeakLength: 900})
+	report(&messages.PlayerStats{Name: "alice", Kills: 1, PeakLength: 600})
+	report(&messages.PlayerStats{Name: "bob", Kills: 5, PeakLength: 400})
+
+	// Yesterday's stats only count all time.
+	carol, _ := gm.accounts.ByName("carol")
+	carol.Stats = Stats{Kills: 10}
+	carol.Today = Stats{Kills: 10}
+	carol.Day = statsDay(time.Now().Add(-24 * time.Hour))
+
+	now := time.Now()
+	names := func(players []*messages.PlayerStats) (list []string) {
+		for _, p := range players {
+			list = append(list, p.Name)
+		}
+		return list
+	}
+	for _, c := range []struct {
+		stat  byte
+		daily bool
+		want  []string
+	}{
+		{messages.StatKills, false, []string{"carol", "bob", "alice"}},
+		{messages.StatKills, true, []string{"bob", "alice"}},
+		{messages.StatPeakLength, false, []string{"alice", "bob"}},
+	} {
+		got := names(gm.topPlayers(c.stat, c.daily, now))
+		if len(got) != len(c.want) {
+			t.Fatalf("Stat %d daily %v: expected %v, got %v", c.stat, c.daily, c.want, got)
+		}
+		for i := range got {
+			if got[i] != c.want[i] {
+				t.Fatalf("Stat %d daily %v: expected %v, got %v", c.stat, c.daily, c.want, got)
+			}
+		}
+	}
+	if alice, _ := gm.accounts.ByName("alice"); alice.Stats.Kills != 3 || alice.Stats.PeakLength != 900 {
+		t.Fatalf("Expected kills to add up and peak length to be the max, got %+v", alice.Stats)
+	}
+	if gm.unsaved[carol] || len(gm.unsaved) != 2 {
+		t.Fatalf("Expected the reported accounts to be waiting to be saved.")
+	}
+	gm.saveStats()
+	if len(gm.unsaved) != 0 {
+		t.Fatalf("Expected every account to be saved.")
+	}
+}
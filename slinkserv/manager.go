@@ -1,9 +1,14 @@
 package slinkserv
 
 import (
+	"crypto/rand"
+	"crypto/subtle"
 	"fmt"
 	"log"
 	"math"
+	"runtime"
+	"strings"
+	"time"
 
 	"github.com/lologarithm/slink/slinkserv/messages"
 )
@@ -24,46 +29,102 @@ type GameManager struct {
 	Games      map[uint32]*GameSession
 	NextGameID uint32 // TODO: this shouldn't just be a number..
 
+	maxPlayers  int                  // Most players placed in one game, 0 for no limit.
+	idleTimeout time.Duration        // How long a game can sit empty before it is shut down, 0 to keep it forever.
+	players     map[uint32]int       // Players in each game, including lost ones that might come back.
+	spectators  map[uint32]int       // Spectators in each game, they don't take up a player's spot.
+	emptySince  map[uint32]time.Time // When each game with no players was left empty.
+	codes       map[string]uint32    // Join codes of private games.
+
 	FromGames   chan GameMessage // Manager reads this only, all games created write only
 	FromNetwork <-chan GameMessage
-	ToNetwork   chan<- OutgoingMessage
 	Exit        chan int
 
-	// Temp junk to make this crap work
-	Accounts   []*Account
-	AccountID  uint32
-	AcctByName map[string]*Account
+	sessions       *sessionTable
+	sessionExpired chan *Client // Lost clients whose grace window might be up.
+
+	accounts     AccountStore
+	names        *nameFilter
+	guests       map[string]bool // Names given to guests that are still connected.
+	logins       *loginThrottle
+	hashWork     int               // PBKDF2 iterations for new password hashes.
+	hashSlots    chan bool         // Limits how many passwords are hashed at once.
+	hashFinished chan func()       // Passwords are hashed off the manager, the rest of the work is sent back here.
+	unsaved      map[*Account]bool // Accounts with stats that haven't been written to the store.
+	topLists     map[topPlayersKey]topPlayersList
+	mutes        map[string]time.Time    // Players who can't chat until the given time, by account name.
+	strikes      map[string]*chatStrikes // Filtered chat messages, by account name.
+	admin        chan func()             // Work asked for from outside the manager, like mutes, run on its goroutine.
+	dropped      uint64                  // Global chat thrown away because a game was busy.
 }
 
 // NewGameManager is the constructor for the main game manager.
 // This should only be called once on a single server.
-func NewGameManager(exit chan int, fromNetwork chan GameMessage, toNetwork chan OutgoingMessage) *GameManager {
+// Accounts are kept in the given store, which is closed when the manager exits.
+func NewGameManager(exit chan int, fromNetwork chan GameMessage, sessions *sessionTable, accounts AccountStore, cfg Config) *GameManager {
 	gm := &GameManager{
-		Users:       make([]*User, math.MaxUint16),
-		Games:       map[uint32]*GameSession{},
-		FromGames:   make(chan GameMessage, 100),
-		FromNetwork: fromNetwork,
-		ToNetwork:   toNetwork,
-		Exit:        exit,
-		Accounts:    make([]*Account, math.MaxUint16),
-		AcctByName:  map[string]*Account{},
+		Users:          make([]*User, math.MaxUint16),
+		Games:          map[uint32]*GameSession{},
+		maxPlayers:     cfg.MaxPlayers,
+		idleTimeout:    cfg.GameIdleTimeout,
+		players:        map[uint32]int{},
+		emptySince:     map[uint32]time.Time{},
+		spectators:     map[uint32]int{},
+		codes:          map[string]uint32{},
+		FromGames:      make(chan GameMessage, 100),
+		FromNetwork:    fromNetwork,
+		Exit:           exit,
+		sessions:       sessions,
+		sessionExpired: make(chan *Client, 100),
+		accounts:       accounts,
+		names:          &nameFilter{},
+		guests:         map[string]bool{},
+		logins:         newLoginThrottle(cfg.Logins),
+		hashWork:       cfg.PasswordIterations,
+		hashSlots:      make(chan bool, runtime.NumCPU()),
+		hashFinished:   make(chan func(), 100),
+		unsaved:        map[*Account]bool{},
+		topLists:       map[topPlayersKey]topPlayersList{},
+		mutes:          map[string]time.Time{},
+		strikes:        map[string]*chatStrikes{},
+		admin:          make(chan func(), 10),
 	}
 	return gm
 }
 
 // Run launches the game manager.
 func (gm *GameManager) Run() {
+	reap := time.NewTicker(gameReapInterval)
+	defer reap.Stop()
 	for {
 		select {
+		case now := <-reap.C:
+			gm.closeIdleGames(now.UTC())
+			gm.logins.expire(now.UTC())
+			gm.saveStats()
+			gm.expireMutes(now)
+		case finish := <-gm.hashFinished:
+			finish()
+		case work := <-gm.admin:
+			work()
 		case netMsg := <-gm.FromNetwork:
 			gm.ProcessNetMsg(netMsg)
 		case gMsg := <-gm.FromGames:
 			gm.ProcessGameMsg(gMsg)
+		case client := <-gm.sessionExpired:
+			if gm.sessions.expire(client.ID, time.Now().UTC()) {
+				log.Printf("GM: session for client %d expired.", client.ID)
+				gm.handleDisconnect(GameMessage{client: client, mtype: messages.DisconnectedMsgType})
+			}
 		case <-gm.Exit:
 			fmt.Printf("Manager got exit signal, shutting down all games.\n")
 			for _, game := range gm.Games {
 				game.Exit <- 1
 			}
+			gm.saveStats()
+			if err := gm.accounts.Close(); err != nil {
+				log.Printf("Failed to close account store: %s", err)
+			}
 			fmt.Printf("  Shutdown sent to all games, manager closing now.\n")
 			return
 		}
@@ -81,6 +142,10 @@ func (gm *GameManager) ProcessNetMsg(msg GameMessage) {
 		gm.createAccount(msg)
 	case messages.LoginMsgType:
 		gm.loginUser(msg)
+	case messages.GuestLoginMsgType:
+		gm.guestLogin(msg)
+	case messages.TopPlayersReqMsgType:
+		gm.sendTopPlayers(msg)
 	case messages.JoinGameMsgType:
 		gm.joinGame(msg)
 		// TODO: make this work
@@ -91,57 +156,265 @@ func (gm *GameManager) ProcessNetMsg(msg GameMessage) {
 }
 
 func (gm *GameManager) joinGame(msg GameMessage) {
-	if len(gm.Games) == 0 {
-		gm.createGame(msg)
+	user := gm.Users[msg.client.ID]
+	if gm.Games[user.GameID] != nil {
+		log.Printf("Client %d asked to join a game while already in game %d.", msg.client.ID, user.GameID)
+		return
+	}
+	if user.Account == nil {
+		msg.client.send(messages.JoinGameFailedMsgType, &messages.JoinGameFailed{Reason: "Log in or play as a guest first."})
+		return
+	}
+	req := msg.net.(*messages.JoinGame)
+	var g *GameSession
+	var reason string
+	if req.Spectate != 0 {
+		g, reason = gm.findWatchGame(req)
+	} else {
+		g, reason = gm.findGame(req)
+	}
+	if g == nil {
+		msg.client.send(messages.JoinGameFailedMsgType, &messages.JoinGameFailed{Reason: reason})
+		return
+	}
+	gm.addToGame(g, msg.client, req.Spectate != 0)
+}
+
+// findWatchGame works out which game a spectator watches. A code or game ID picks the game
+// the same as for players, even if it is full, otherwise they watch the busiest public game.
+// Games aren't started just to be watched.
+func (gm *GameManager) findWatchGame(req *messages.JoinGame) (*GameSession, string) {
+	switch {
+	case req.Code != "":
+		if g := gm.Games[gm.codes[strings.ToUpper(req.Code)]]; g != nil {
+			return g, ""
+		}
+		return nil, "There is no game with that code."
+	case req.GameID != 0:
+		if g := gm.Games[req.GameID]; g != nil && g.Code == "" {
+			return g, ""
+		}
+		return nil, "There is no such game."
+	}
+	var best *GameSession
+	for id, g := range gm.Games {
+		if g.Code != "" {
+			continue
+		}
+		if best == nil || gm.players[id] > gm.players[best.ID] || (gm.players[id] == gm.players[best.ID] && id < best.ID) {
+			best = g
+		}
+	}
+	if best == nil {
+		return nil, "There are no games to watch."
+	}
+	return best, ""
+}
+
+// findGame works out which game a join request goes to, starting a new one if needed.
+// A code joins that private game, a game ID joins that public game, Private starts a new
+// private game and otherwise the player is matched into a public game.
+// Returns the reason the player can't join if there is no game for them.
+func (gm *GameManager) findGame(req *messages.JoinGame) (*GameSession, string) {
+	switch {
+	case req.Code != "":
+		g := gm.Games[gm.codes[strings.ToUpper(req.Code)]]
+		if g == nil {
+			return nil, "There is no game with that code."
+		}
+		return gm.roomIn(g)
+	case req.GameID != 0:
+		g := gm.Games[req.GameID]
+		if g == nil || g.Code != "" {
+			return nil, "There is no such game."
+		}
+		return gm.roomIn(g)
+	case req.Private != 0:
+		return gm.createGame(true), ""
+	}
+	if g := gm.pickGame(); g != nil {
+		return g, ""
+	}
+	return gm.createGame(false), ""
+}
+
+// roomIn returns the game if it isn't full.
+func (gm *GameManager) roomIn(g *GameSession) (*GameSession, string) {
+	if gm.maxPlayers > 0 && gm.players[g.ID] >= gm.maxPlayers {
+		return nil, "That game is full."
+	}
+	return g, ""
+}
+
+// pickGame returns the fullest public game that still has room, so players end up
+// together instead of spread thin. Returns nil if every game is full.
+func (gm *GameManager) pickGame() *GameSession {
+	var best *GameSession
+	for id, g := range gm.Games {
+		n := gm.players[id]
+		if g.Code != "" || (gm.maxPlayers > 0 && n >= gm.maxPlayers) {
+			continue
+		}
+		if best == nil || n > gm.players[best.ID] || (n == gm.players[best.ID] && id < best.ID) {
+			best = g
+		}
 	}
-	gameID := uint32(1) // TODO: scale multiple games!
+	return best
+}
 
-	g := gm.Games[gameID]
+func (gm *GameManager) addToGame(g *GameSession, client *Client, spectate bool) {
 	g.FromGameManager <- AddPlayer{
 		Entity: &Entity{
-			Name: gm.Users[msg.client.ID].Account.Name,
+			Name: gm.playerName(gm.Users[client.ID]),
 		},
-		Client: msg.client,
+		Client:     client,
+		Account:    gm.Users[client.ID].Account,
+		MutedUntil: gm.mutedUntil(gm.Users[client.ID]),
+		Spectate:   spectate,
+	}
+	gm.Users[client.ID].GameID = g.ID
+	gm.Users[client.ID].Spectator = spectate
+	if spectate {
+		gm.spectators[g.ID]++
+		log.Printf("Client %d is watching game %d, %d spectators.", client.ID, g.ID, gm.spectators[g.ID])
+	} else {
+		gm.players[g.ID]++
+		delete(gm.emptySince, g.ID)
+		log.Printf("Client %d joined game %d, %d players.", client.ID, g.ID, gm.players[g.ID])
 	}
-	gm.Users[msg.client.ID].GameID = gameID
 
-	msg.client.FromGameManager <- ConnectedGame{
+	client.FromGameManager <- ConnectedGame{
 		ToGame: g.FromNetwork,
-		ID:     gameID,
+		ID:     g.ID,
+		Clock:  &g.clock,
 	}
 }
 
-func (gm *GameManager) createGame(msg GameMessage) {
+// leaveGame takes a player out of the count for their game.
+func (gm *GameManager) leaveGame(gameID uint32, now time.Time) {
+	if gm.Games[gameID] == nil {
+		return
+	}
+	gm.players[gameID]--
+	if gm.players[gameID] <= 0 {
+		gm.players[gameID] = 0
+		gm.emptySince[gameID] = now
+	}
+}
+
+// createGame starts a new game, private games are given a join code.
+func (gm *GameManager) createGame(private bool) *GameSession {
 	gm.NextGameID++
 
-	g := NewGame(gm.FromGames, gm.ToNetwork)
+	g := NewGame(gm.FromGames)
 	g.ID = gm.NextGameID
+	if private {
+		g.Code = gm.newCode()
+		gm.codes[g.Code] = g.ID
+	}
+	g.names = gm.names
 	go g.Run()
 	log.Printf("Launched new game: %d", g.ID)
 	gm.Games[gm.NextGameID] = g
+	gm.emptySince[g.ID] = time.Now().UTC()
+	return g
+}
+
+// codeChars are used for join codes, leaving out letters and numbers that are easy to mix up.
+const codeChars = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+
+// codeLen is how long join codes are. With 32 characters there are about a billion of them.
+const codeLen = 6
+
+// newCode returns a join code that isn't used by any running game.
+func (gm *GameManager) newCode() string {
+	buf := make([]byte, codeLen)
+	for {
+		if _, err := rand.Read(buf); err != nil {
+			panic("unable to read random bytes for a join code: " + err.Error())
+		}
+		for i, b := range buf {
+			buf[i] = codeChars[int(b)%len(codeChars)]
+		}
+		if code := string(buf); gm.codes[code] == 0 {
+			return code
+		}
+	}
+}
+
+// gameReapInterval is how often the manager looks for empty games to shut down.
+const gameReapInterval = 10 * time.Second
+
+// closeIdleGames shuts down games that have been empty for longer than the idle timeout.
+func (gm *GameManager) closeIdleGames(now time.Time) {
+	if gm.idleTimeout <= 0 {
+		return
+	}
+	for id, since := range gm.emptySince {
+		if now.Sub(since) < gm.idleTimeout || gm.spectators[id] > 0 {
+			continue // Kept going while anyone is still watching.
+		}
+		log.Printf("Game %d has been empty for %s, shutting it down.", id, now.Sub(since).Truncate(time.Second))
+		gm.Games[id].Exit <- 1
+		delete(gm.codes, gm.Games[id].Code)
+		delete(gm.Games, id)
+		delete(gm.players, id)
+		delete(gm.spectators, id)
+		delete(gm.emptySince, id)
+	}
 }
 
 func (gm *GameManager) handleConnection(msg GameMessage) {
+	user := gm.Users[msg.client.ID]
 	// First make sure this is a new connection.
-	if gm.Users[msg.client.ID] == nil {
+	if user == nil {
 		// log.Printf("New user connected: %d", msg.client.ID)
 		gm.Users[msg.client.ID] = &User{
-			Client:  msg.client,
-			Account: &Account{},
+			Client: msg.client,
+		}
+		return
+	}
+	// Otherwise this is a lost client resuming its session.
+	if user.Lost {
+		user.Lost = false
+		if gm.Games[user.GameID] != nil {
+			gm.Games[user.GameID].FromGameManager <- ResumePlayer{Client: msg.client}
 		}
 	}
 }
 
 func (gm *GameManager) handleDisconnect(msg GameMessage) {
 	log.Printf("GM: handling disconnect now: %d", msg.client.ID)
+	user := gm.Users[msg.client.ID]
+	if user == nil {
+		return
+	}
+	gameid := user.GameID
+	if msg.lost {
+		// Keep the user and their snake around in case they come back.
+		user.Lost = true
+		if gm.Games[gameid] != nil {
+			gm.Games[gameid].FromGameManager <- SuspendPlayer{Client: msg.client}
+		}
+		time.AfterFunc(gm.sessions.grace, func() {
+			gm.sessionExpired <- msg.client
+		})
+		return
+	}
 	// message active game that player disconnected.
-	gameid := gm.Users[msg.client.ID].GameID
 	if gm.Games[gameid] != nil {
 		log.Printf("Signalling game %d to remove player %d.", gameid, msg.client.ID)
 		gm.Games[gameid].FromGameManager <- RemovePlayer{Client: msg.client}
+		if user.Spectator {
+			gm.spectators[gameid]--
+		} else {
+			gm.leaveGame(gameid, time.Now().UTC())
+		}
 	}
 	// Then clear out the user.
+	gm.setAccount(user, nil)
 	gm.Users[msg.client.ID] = nil
+	close(msg.client.FromGameManager)
 }
 
 func (gm *GameManager) createAccount(msg GameMessage) {
@@ -151,45 +424,191 @@ func (gm *GameManager) createAccount(msg GameMessage) {
 		Name:      netmsg.Name,
 	}
 	// log.Printf("Trying to login: %s", netmsg.Name)
-	if _, ok := gm.AcctByName[netmsg.Name]; !ok {
-		gm.AccountID++
-		gm.Accounts[gm.AccountID] = &Account{
-			ID:       gm.AccountID,
-			Name:     netmsg.Name,
-			Password: netmsg.Password,
+	ac.Reason = gm.names.check(netmsg.Name)
+	if ac.Reason == "" {
+		if _, err := gm.accounts.ByName(netmsg.Name); err != ErrNoAccount {
+			ac.Reason = "That name is taken."
 		}
-
-		ac.AccountID = gm.AccountID
-
-		gm.AcctByName[netmsg.Name] = gm.Accounts[gm.AccountID]
-		gm.Users[msg.client.ID].Account = gm.Accounts[gm.AccountID]
-		// log.Printf("logged in: %s", netmsg.Name)
 	}
-
-	resp := NewOutgoingMsg(msg.client, messages.CreateAcctRespMsgType, ac)
-	gm.ToNetwork <- resp
+	if ac.Reason != "" {
+		// Don't spend time hashing a password for a name that can't be used.
+		msg.client.send(messages.CreateAcctRespMsgType, ac)
+		return
+	}
+	var hash string
+	var err error
+	gm.hashOff(func() {
+		hash, err = hashPassword(netmsg.Password, gm.hashWork)
+	}, func() {
+		user := gm.Users[msg.client.ID]
+		if user == nil || user.Client != msg.client {
+			return // Left while the password was hashed.
+		}
+		var acct *Account
+		if err == nil {
+			acct, err = gm.accounts.Create(netmsg.Name, hash)
+		}
+		if err == nil {
+			ac.AccountID = acct.ID
+			ac.Token = gm.sessions.issue(msg.client)
+			gm.setAccount(user, acct)
+			// log.Printf("logged in: %s", netmsg.Name)
+		} else if err == ErrAccountExists {
+			ac.Reason = "That name is taken."
+		} else {
+			log.Printf("GM: failed to create account %s: %s", netmsg.Name, err)
+			ac.Reason = "Couldn't create the account, try again later."
+		}
+		msg.client.send(messages.CreateAcctRespMsgType, ac)
+	})
 }
 
 func (gm *GameManager) loginUser(msg GameMessage) {
 	tmsg := msg.net.(*messages.Login)
+	addr := clientIP(msg.client)
+	if wait := gm.logins.wait(tmsg.Name, addr, time.Now().UTC()); wait > 0 {
+		msg.client.send(messages.LoginRespMsgType, &messages.LoginResp{
+			Name:       tmsg.Name,
+			Reason:     messages.LoginThrottled,
+			RetryAfter: uint32((wait + time.Second - 1) / time.Second),
+		})
+		return
+	}
+	// Unknown names are checked against a hash that can't match so they take just as long to fail.
+	acct, err := gm.accounts.ByName(tmsg.Name)
+	hash, legacy := dummyHash(gm.hashWork), ""
+	if err == nil {
+		hash, legacy = acct.PasswordHash, acct.Password
+	}
+	var ok bool
+	var upgraded string
+	gm.hashOff(func() {
+		if hash == "" {
+			// Saved before passwords were hashed, hash it now that we know it.
+			ok = subtle.ConstantTimeCompare([]byte(legacy), []byte(tmsg.Password)) == 1
+			if ok {
+				upgraded, err = hashPassword(tmsg.Password, gm.hashWork)
+			}
+			return
+		}
+		ok, err = checkPassword(hash, tmsg.Password)
+		ok = ok && acct != nil
+	}, func() {
+		gm.finishLogin(msg, addr, acct, ok, upgraded, err)
+	})
+}
+
+// finishLogin replies to a login once its password has been checked.
+// upgraded is a new hash for an account whose password was saved in plaintext.
+func (gm *GameManager) finishLogin(msg GameMessage, addr string, acct *Account, ok bool, upgraded string, err error) {
+	user := gm.Users[msg.client.ID]
+	if user == nil || user.Client != msg.client {
+		return // Left while the password was checked.
+	}
+	name := msg.net.(*messages.Login).Name
 	lr := messages.LoginResp{
 		Success: 0,
-		Name:    tmsg.Name,
+		Name:    name,
 	}
-	if acct, ok := gm.AcctByName[tmsg.Name]; ok {
-		if acct.Password == tmsg.Password {
-			// log.Printf("Logging in account: %s", tmsg.Name)
-			lr.AccountID = acct.ID
-			gm.Users[msg.client.ID].Account = acct
+	switch {
+	case err != nil:
+		log.Printf("GM: failed to check password for %s: %s", name, err)
+		lr.Reason = messages.LoginError
+	case !ok:
+		gm.logins.failed(name, addr, time.Now().UTC())
+		lr.Reason = messages.LoginBadCredentials
+	default:
+		// log.Printf("Logging in account: %s", name)
+		gm.logins.succeeded(name)
+		if upgraded != "" {
+			acct.PasswordHash, acct.Password = upgraded, ""
+			if err := gm.accounts.Update(acct); err != nil {
+				log.Printf("GM: failed to save new password hash for %s: %s", name, err)
+			}
 		}
+		lr.Success = 1
+		lr.AccountID = acct.ID
+		lr.Token = gm.sessions.issue(msg.client)
+		gm.setAccount(user, acct)
+	}
+	msg.client.send(messages.LoginRespMsgType, &lr)
+}
+
+// guestLogin lets a player in without an account, under a made up name.
+// Guests are never saved, the name is free again once they leave.
+func (gm *GameManager) guestLogin(msg GameMessage) {
+	user := gm.Users[msg.client.ID]
+	if user.Account != nil {
+		// Most likely our last reply was lost, so send it again for the account they already have.
+		log.Printf("Client %d asked for a guest login while logged in as %s.", msg.client.ID, user.Account.Name)
+		msg.client.send(messages.LoginRespMsgType, &messages.LoginResp{
+			Success:   1,
+			Name:      user.Account.Name,
+			AccountID: user.Account.ID,
+			Token:     gm.sessions.issue(msg.client),
+		})
+		return
+	}
+	name := guestName()
+	for gm.guests[name] {
+		name = guestName()
+	}
+	gm.setAccount(user, &Account{Name: name, Guest: true})
+	msg.client.send(messages.LoginRespMsgType, &messages.LoginResp{
+		Success: 1,
+		Name:    name,
+		Token:   gm.sessions.issue(msg.client),
+	})
+}
+
+// setAccount changes which account a user is logged in as, freeing the name if they were a guest.
+func (gm *GameManager) setAccount(user *User, acct *Account) {
+	if user.Account != nil && user.Account.Guest {
+		delete(gm.guests, user.Account.Name)
+	}
+	if acct != nil && acct.Guest {
+		gm.guests[acct.Name] = true
+	}
+	user.Account = acct
+}
+
+// playerName is the name shown on a player's snake. Accounts whose name is no longer
+// allowed, say after the blocklist was updated, play under a guest name instead.
+func (gm *GameManager) playerName(user *User) string {
+	if user.Account.Guest || gm.names.check(user.Account.Name) == "" {
+		return user.Account.Name
+	}
+	return guestName()
+}
+
+// hashOff runs slow password work on its own goroutine so the manager isn't held up,
+// then hands finish back to the manager to run.
+func (gm *GameManager) hashOff(work func(), finish func()) {
+	go func() {
+		gm.hashSlots <- true
+		work()
+		<-gm.hashSlots
+		gm.hashFinished <- finish
+	}()
+}
+
+// clientIP is the address failed logins are counted against.
+func clientIP(client *Client) string {
+	if addr := client.Address(); addr != nil {
+		return addr.IP.String()
 	}
-	resp := NewOutgoingMsg(msg.client, messages.LoginRespMsgType, &lr)
-	gm.ToNetwork <- resp
+	return ""
 }
 
 // ProcessGameMsg is used to process messages from an individual game to the main server controller.
 func (gm *GameManager) ProcessGameMsg(msg GameMessage) {
 	switch msg.mtype {
+	case messages.PlayerStatsMsgType:
+		gm.recordStats(msg)
+	case messages.ChatMsgType:
+		gm.relayChat(msg)
+	case messages.ChatMutedMsgType:
+		gm.chatStrike(msg)
 	}
 }
 
@@ -206,6 +625,7 @@ func NewOutgoingMsg(dest *Client, tp messages.MessageType, msg messages.Net) Out
 			Frame:  frame,
 			NetMsg: msg,
 		},
+		priority: priorityOf(tp),
 	}
 	return resp
 }
@@ -0,0 +1,114 @@
+package slinkserv
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lologarithm/slink/slinkserv/messages"
+)
+
+// newTestManager creates a manager with a user for each client ID, without starting it.
+func newTestManager(cfg Config, clients int) (*GameManager, []*Client) {
+	gm := NewGameManager(make(chan int, 1), make(chan GameMessage, 10), newSessionTable(time.Second), NewMemoryStore(), cfg)
+	list := make([]*Client, clients+1)
+	for id := 1; id <= clients; id++ {
+		list[id] = &Client{ID: uint32(id), FromGameManager: make(chan InternalMessage, 10)}
+		list[id].out = newOutQueue(list[id], nil, DefaultOutQueueLimits())
+		gm.Users[id] = &User{Client: list[id], Account: &Account{Name: fmt.Sprintf("player%d", id)}}
+	}
+	return gm, list
+}
+
+func TestMatchmaking(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.MaxPlayers = 2
+	cfg.GameIdleTimeout = time.Minute
+	gm, clients := newTestManager(cfg, 5)
+	defer func() {
+		for _, g := range gm.Games {
+			g.Exit <- 1
+		}
+	}()
+
+	join := func(id int, expected uint32) {
+		gm.joinGame(GameMessage{client: clients[id], net: &messages.JoinGame{}})
+		if game := gm.Users[id].GameID; game != expected {
+			t.Fatalf("Expected client %d in game %d, got %d", id, expected, game)
+		}
+		if cg := (<-clients[id].FromGameManager).(ConnectedGame); cg.ID != expected {
+			t.Fatalf("Client %d was told it joined game %d, expected %d", id, cg.ID, expected)
+		}
+	}
+	join(1, 1)
+	join(2, 1)
+	join(3, 2) // Game 1 is full.
+
+	// With a spot open in each, players go to the fullest game.
+	gm.handleDisconnect(GameMessage{client: clients[1]})
+	join(4, 1)
+	join(5, 2)
+	if len(gm.Games) != 2 {
+		t.Fatalf("Expected 2 games, got %d", len(gm.Games))
+	}
+
+	// Empty games are shut down once they've been idle long enough.
+	gm.handleDisconnect(GameMessage{client: clients[3]})
+	gm.handleDisconnect(GameMessage{client: clients[5]})
+	gm.closeIdleGames(time.Now().UTC())
+	if gm.Games[2] == nil {
+		t.Fatalf("Game 2 was shut down before its idle timeout.")
+	}
+	gm.closeIdleGames(time.Now().UTC().Add(cfg.GameIdleTimeout))
+	if gm.Games[2] != nil || gm.Games[1] == nil {
+		t.Fatalf("Expected only the empty game to be shut down.")
+	}
+}
+
+func TestPrivateGames(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.MaxPlayers = 2
+	gm, clients := newTestManager(cfg, 5)
+	defer func() {
+		for _, g := range gm.Games {
+			g.Exit <- 1
+		}
+	}()
+	join := func(id int, req *messages.JoinGame) *GameSession {
+		gm.joinGame(GameMessage{client: clients[id], net: req})
+		return gm.Games[gm.Users[id].GameID]
+	}
+	failed := func(id int) bool {
+		// The failure is the only message queued for the client.
+		msg, ok := clients[id].out.pop()
+		return ok && msg.msg.Frame.MsgType == messages.JoinGameFailedMsgType
+	}
+
+	private := join(1, &messages.JoinGame{Private: 1})
+	if private == nil || len(private.Code) != codeLen {
+		t.Fatalf("Expected a private game with a join code.")
+	}
+	// Public players are never matched into it.
+	if public := join(2, &messages.JoinGame{}); public == private {
+		t.Fatalf("Public join was matched into a private game.")
+	}
+	// Nor can it be joined by ID.
+	if join(3, &messages.JoinGame{GameID: private.ID}) != nil || !failed(3) {
+		t.Fatalf("Joining a private game by ID should fail.")
+	}
+	// Codes aren't case sensitive.
+	if join(3, &messages.JoinGame{Code: strings.ToLower(private.Code)}) != private {
+		t.Fatalf("Expected to join the private game by its code.")
+	}
+	if join(4, &messages.JoinGame{Code: private.Code}) != nil || !failed(4) {
+		t.Fatalf("Joining a full private game should fail.")
+	}
+	if join(4, &messages.JoinGame{Code: "NOPE"}) != nil || !failed(4) {
+		t.Fatalf("Joining with an unknown code should fail.")
+	}
+	public := gm.Games[gm.Users[2].GameID]
+	if join(5, &messages.JoinGame{GameID: public.ID}) != public {
+		t.Fatalf("Expected to join the public game by ID.")
+	}
+}
@@ -0,0 +1,7 @@
+package messages
+
+// Values of ChatSend.Channel and Chat.Channel.
+const (
+	ChatGame   byte = iota // Everyone in the same game.
+	ChatGlobal             // Everyone in every game.
+)
@@ -0,0 +1,67 @@
+package messages
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"io"
+	"sync"
+)
+
+// CompressedFlag is set in the high bit of a frame's message type when its content is deflated.
+const CompressedFlag MessageType = 0x8000
+
+// maxInflatedLen caps how big compressed content can grow, content lengths are 16 bits anyway.
+const maxInflatedLen = 1 << 16
+
+var flateWriters = sync.Pool{
+	New: func() interface{} {
+		w, _ := flate.NewWriter(nil, flate.BestSpeed)
+		return w
+	},
+}
+
+var flateReaders = sync.Pool{
+	New: func() interface{} {
+		return flate.NewReader(nil)
+	},
+}
+
+// Compress deflates the content of a packed packet and sets the compressed flag in its frame.
+// Returns false, and the packet untouched, if compressing wouldn't make it any smaller.
+func Compress(packed []byte) ([]byte, bool) {
+	if len(packed) <= FrameLen {
+		return packed, false
+	}
+	buf := bytes.NewBuffer(make([]byte, FrameLen, len(packed)))
+	w := flateWriters.Get().(*flate.Writer)
+	defer flateWriters.Put(w)
+	w.Reset(buf)
+	w.Write(packed[FrameLen:])
+	w.Close()
+
+	compressed := buf.Bytes()
+	if len(compressed) >= len(packed) {
+		return packed, false
+	}
+	mtype := binary.LittleEndian.Uint16(packed)
+	binary.LittleEndian.PutUint16(compressed, mtype|uint16(CompressedFlag))
+	copy(compressed[2:4], packed[2:4])
+	binary.LittleEndian.PutUint16(compressed[4:], uint16(len(compressed)-FrameLen))
+	return compressed, true
+}
+
+// inflate reverses Compress on the content of a packet.
+func inflate(content []byte) ([]byte, error) {
+	r := flateReaders.Get().(io.ReadCloser)
+	defer flateReaders.Put(r)
+	r.(flate.Resetter).Reset(bytes.NewReader(content), nil)
+	out, err := io.ReadAll(io.LimitReader(r, maxInflatedLen+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(out) > maxInflatedLen {
+		return nil, io.ErrShortBuffer
+	}
+	return out, nil
+}
@@ -0,0 +1,40 @@
+package messages
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestCompress(t *testing.T) {
+	mf := &GameMasterFrame{ID: 1, Tick: 100}
+	for i := uint32(0); i < 50; i++ {
+		mf.Entities = append(mf.Entities, &Entity{ID: i, EType: 3, X: int32(i), Y: -int32(i), Facing: &Vect2{}})
+	}
+	packet := NewPacket(GameMasterFrameMsgType, mf)
+	packet.Frame.Seq = 7
+	packed := packet.Pack()
+
+	compressed, ok := Compress(packed)
+	if !ok || len(compressed) >= len(packed) {
+		t.Fatalf("Expected entities to compress, %d -> %d bytes.", len(packed), len(compressed))
+	}
+	// Trailing bytes belong to the next packet in the datagram and should be left alone.
+	parsed, ok := NextPacket(append(compressed, 1, 2, 3))
+	if !ok {
+		t.Fatalf("Failed to parse compressed packet.")
+	}
+	if !parsed.Frame.Compressed || parsed.Frame.MsgType != GameMasterFrameMsgType || parsed.Frame.Seq != 7 {
+		t.Fatalf("Compressed frame didn't survive: %v", parsed.Frame)
+	}
+	if parsed.Len() != len(compressed) {
+		t.Fatalf("Packet length should be its size on the wire, got %d expected %d", parsed.Len(), len(compressed))
+	}
+	if !bytes.Equal(parsed.Pack(), packed) {
+		t.Fatalf("Repacking a compressed packet should give the original packet.")
+	}
+
+	small := NewPacket(MTUProbeAckMsgType, &MTUProbeAck{Size: 512}).Pack()
+	if out, ok := Compress(small); ok || !bytes.Equal(out, small) {
+		t.Fatalf("Packets that don't shrink should be left alone.")
+	}
+}
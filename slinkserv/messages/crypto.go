@@ -0,0 +1,167 @@
+package messages
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+)
+
+// EncryptionOverhead is how many bytes sealing a datagram adds to it.
+var EncryptionOverhead = FrameLen + (&Encrypted{}).Len() + 16
+
+// Nonce prefixes so the two directions of a session never share a nonce.
+const (
+	toServer uint32 = 0
+	toClient uint32 = 1
+)
+
+// SessionCipher seals and opens the datagrams of an encrypted session with AES-GCM.
+// Every datagram is wrapped in an Encrypted packet whose Seq, together with the direction
+// it is traveling, makes up the nonce. Seal and Open can be called from different
+// goroutines but neither is safe to call from more than one at a time.
+type SessionCipher struct {
+	key     []byte
+	aead    cipher.AEAD
+	sendDir uint32
+	sendSeq uint64
+
+	recvMax  uint64 // Highest Seq opened so far.
+	recvSeen uint64 // Bitmap of the 64 Seqs below recvMax that have been opened.
+}
+
+// NewSessionCipher creates the cipher for one end of a session.
+// The server and client must pass the same key and opposite values of server.
+func NewSessionCipher(key []byte, server bool) (*SessionCipher, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	sc := &SessionCipher{key: key, aead: aead, sendDir: toServer}
+	if server {
+		sc.sendDir = toClient
+	}
+	return sc, nil
+}
+
+func (sc *SessionCipher) nonce(dir uint32, seq uint64) []byte {
+	nonce := make([]byte, sc.aead.NonceSize())
+	binary.LittleEndian.PutUint32(nonce, dir)
+	binary.LittleEndian.PutUint64(nonce[4:], seq)
+	return nonce
+}
+
+// Seal encrypts a datagram and returns the packed Encrypted packet to send in its place.
+func (sc *SessionCipher) Seal(datagram []byte) []byte {
+	sc.sendSeq++
+	wrapper := &Encrypted{
+		Seq:  sc.sendSeq,
+		Data: sc.aead.Seal(nil, sc.nonce(sc.sendDir, sc.sendSeq), datagram, nil),
+	}
+	return NewPacket(EncryptedMsgType, wrapper).Pack()
+}
+
+// Open decrypts a datagram sealed by the other end of the session.
+// Returns false if it isn't an Encrypted packet, fails authentication or is a replay.
+func (sc *SessionCipher) Open(datagram []byte) ([]byte, bool) {
+	packet, ok := NextPacket(datagram)
+	if !ok || packet.Frame.MsgType != EncryptedMsgType {
+		return nil, false
+	}
+	wrapper := packet.NetMsg.(*Encrypted)
+	if wrapper.Seq == 0 || sc.replayed(wrapper.Seq) {
+		return nil, false
+	}
+	dir := toClient
+	if sc.sendDir == toClient {
+		dir = toServer
+	}
+	plain, err := sc.aead.Open(nil, sc.nonce(dir, wrapper.Seq), wrapper.Data, nil)
+	if err != nil {
+		return nil, false
+	}
+	sc.markSeen(wrapper.Seq)
+	return plain, true
+}
+
+func (sc *SessionCipher) replayed(seq uint64) bool {
+	if seq > sc.recvMax {
+		return false
+	}
+	diff := sc.recvMax - seq
+	if diff >= 64 {
+		return true // Too old to tell, treat it as a replay.
+	}
+	return sc.recvSeen&(1<<diff) != 0
+}
+
+func (sc *SessionCipher) markSeen(seq uint64) {
+	if seq > sc.recvMax {
+		shift := seq - sc.recvMax
+		if shift >= 64 {
+			sc.recvSeen = 0
+		} else {
+			sc.recvSeen <<= shift
+		}
+		sc.recvMax = seq
+	}
+	sc.recvSeen |= 1 << (sc.recvMax - seq)
+}
+
+// ResumeProof is sent in a Connect to show the server we held this session's key, so the
+// session token alone, which is sent in the clear, can't be used to take the session over.
+// It covers the connect cookie, which only works from the address it was issued to.
+func (sc *SessionCipher) ResumeProof(cookie []byte) []byte {
+	mac := hmac.New(sha256.New, sc.key)
+	mac.Write([]byte("slink resume"))
+	mac.Write(cookie)
+	return mac.Sum(nil)
+}
+
+// NewSessionKey runs the client's half of the key exchange against the X25519 public key the
+// server sent in Connected. Returns the session key and the public key to send the server in a SessionKey message.
+func NewSessionKey(serverPublic []byte) (key []byte, clientPublic []byte, err error) {
+	server, err := ecdh.X25519().NewPublicKey(serverPublic)
+	if err != nil {
+		return nil, nil, err
+	}
+	priv, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	shared, err := priv.ECDH(server)
+	if err != nil {
+		return nil, nil, err
+	}
+	clientPublic = priv.PublicKey().Bytes()
+	return deriveSessionKey(shared, clientPublic, serverPublic), clientPublic, nil
+}
+
+// OpenSessionKey runs the server's half of the key exchange with the public key a client sent in SessionKey.
+func OpenSessionKey(priv *ecdh.PrivateKey, clientPublic []byte) ([]byte, error) {
+	client, err := ecdh.X25519().NewPublicKey(clientPublic)
+	if err != nil {
+		return nil, err
+	}
+	shared, err := priv.ECDH(client)
+	if err != nil {
+		return nil, err
+	}
+	return deriveSessionKey(shared, clientPublic, priv.PublicKey().Bytes()), nil
+}
+
+// deriveSessionKey hashes the shared secret with both public keys into an AES-256 key.
+func deriveSessionKey(shared, clientPublic, serverPublic []byte) []byte {
+	h := sha256.New()
+	h.Write(shared)
+	h.Write(clientPublic)
+	h.Write(serverPublic)
+	return h.Sum(nil)
+}
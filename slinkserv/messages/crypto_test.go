@@ -0,0 +1,67 @@
+package messages
+
+import (
+	"bytes"
+	"crypto/ecdh"
+	"crypto/rand"
+	"testing"
+)
+
+func newCipherPair(t *testing.T) (client, server *SessionCipher) {
+	serverKey, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, clientPublic, err := NewSessionKey(serverKey.PublicKey().Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	serverSide, err := OpenSessionKey(serverKey, clientPublic)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(key, serverSide) {
+		t.Fatalf("Both ends should derive the same session key.")
+	}
+	client, _ = NewSessionCipher(key, false)
+	server, _ = NewSessionCipher(serverSide, true)
+	return client, server
+}
+
+func TestSessionCipher(t *testing.T) {
+	client, server := newCipherPair(t)
+	datagram := NewPacket(HeartbeatMsgType, &Heartbeat{Time: 1234}).Pack()
+
+	sealed := client.Seal(datagram)
+	if len(sealed) != len(datagram)+EncryptionOverhead {
+		t.Fatalf("Expected %d bytes of overhead, got %d", EncryptionOverhead, len(sealed)-len(datagram))
+	}
+	plain, ok := server.Open(sealed)
+	if !ok || !bytes.Equal(plain, datagram) {
+		t.Fatalf("Server failed to open client datagram.")
+	}
+	if _, ok := server.Open(sealed); ok {
+		t.Fatalf("Replayed datagram should not open.")
+	}
+	if _, ok := client.Open(client.Seal(datagram)); ok {
+		t.Fatalf("A datagram should not open in the direction it was sent.")
+	}
+	if _, ok := server.Open(datagram); ok {
+		t.Fatalf("Plaintext should not open.")
+	}
+
+	tampered := client.Seal(datagram)
+	tampered[len(tampered)-1] ^= 1
+	if _, ok := server.Open(tampered); ok {
+		t.Fatalf("Tampered datagram should not open.")
+	}
+
+	// Reordered datagrams within the window are fine.
+	first, second := server.Seal(datagram), server.Seal(datagram)
+	if _, ok := client.Open(second); !ok {
+		t.Fatalf("Client failed to open second datagram.")
+	}
+	if _, ok := client.Open(first); !ok {
+		t.Fatalf("Client failed to open a reordered datagram.")
+	}
+}
@@ -2,11 +2,16 @@ package messages
 
 import (
 	"encoding/binary"
+	"errors"
 	"fmt"
 )
 
 const FrameLen int = 6
 
+// ErrTruncated is returned by Deserialize when the content ends before the message does,
+// or a length inside it runs past the end.
+var ErrTruncated = errors.New("messages: truncated message")
+
 func NewPacket(t MessageType, msg Net) *Packet {
 	return &Packet{
 		Frame: Frame{
@@ -23,16 +28,18 @@ type Packet struct {
 }
 
 // Pack serializes the content into RawBytes.
+// The content is never compressed, even if the packet arrived compressed, use Compress for that.
 func (m *Packet) Pack() []byte {
-	buf := make([]byte, m.Len())
+	length := m.NetMsg.Len()
+	buf := make([]byte, FrameLen+length)
 	binary.LittleEndian.PutUint16(buf, uint16(m.Frame.MsgType))
 	binary.LittleEndian.PutUint16(buf[2:], m.Frame.Seq)
-	binary.LittleEndian.PutUint16(buf[4:], m.Frame.ContentLength)
+	binary.LittleEndian.PutUint16(buf[4:], uint16(length))
 	m.NetMsg.Serialize(buf[6:])
 	return buf
 }
 
-// Len returns the total length of the message including the frame
+// Len returns the total length of the message including the frame, as it was on the wire.
 func (m *Packet) Len() int {
 	return int(m.Frame.ContentLength) + FrameLen
 }
@@ -41,6 +48,7 @@ type Frame struct {
 	MsgType       MessageType // byte 0-1, type
 	Seq           uint16      // byte 2-3, order of message
 	ContentLength uint16      // byte 4-5, content length
+	Compressed    bool        // high bit of the type, content is deflated
 }
 
 func (mf Frame) String() string {
@@ -52,6 +60,10 @@ func ParseFrame(rawBytes []byte) (mf Frame, ok bool) {
 		return
 	}
 	mf.MsgType = MessageType(binary.LittleEndian.Uint16(rawBytes[0:2]))
+	if mf.MsgType&CompressedFlag != 0 {
+		mf.MsgType &^= CompressedFlag
+		mf.Compressed = true
+	}
 	mf.Seq = binary.LittleEndian.Uint16(rawBytes[2:4])
 	mf.ContentLength = binary.LittleEndian.Uint16(rawBytes[4:6])
 	return mf, true
@@ -62,10 +74,16 @@ func NextPacket(rawBytes []byte) (packet Packet, ok bool) {
 	if !ok {
 		return
 	}
-
 	ok = false
 	if packet.Len() <= len(rawBytes) {
-		packet.NetMsg = ParseNetMessage(packet, rawBytes[FrameLen:packet.Len()])
+		content := rawBytes[FrameLen:packet.Len()]
+		if packet.Frame.Compressed {
+			var err error
+			if content, err = inflate(content); err != nil {
+				return
+			}
+		}
+		packet.NetMsg = ParseNetMessage(packet, content)
 		if packet.NetMsg != nil {
 			ok = true
 		}
@@ -0,0 +1,33 @@
+package messages
+
+import (
+	"encoding/binary"
+	"testing"
+)
+
+func TestTruncatedPacket(t *testing.T) {
+	gc := &GameConnected{ID: 1, SnakeID: 2, TickID: 3, Code: "ABCD"}
+	gc.Entities = []*Entity{{ID: 1, Size: 300, Facing: &Vect2{X: 1}}}
+	gc.Snakes = []*Snake{{ID: 1, Name: "snake", Segments: []uint32{2, 3}}}
+	packed := NewPacket(GameConnectedMsgType, gc).Pack()
+
+	// Every cut short version of the content has its length fixed up so only the
+	// deserializer can notice something is missing.
+	for n := FrameLen; n < len(packed); n++ {
+		cut := append([]byte{}, packed[:n]...)
+		binary.LittleEndian.PutUint16(cut[4:], uint16(n-FrameLen))
+		if _, ok := NextPacket(cut); ok {
+			t.Fatalf("Expected content cut to %d bytes to be rejected.", n-FrameLen)
+		}
+	}
+	if p, ok := NextPacket(packed); !ok || p.NetMsg.(*GameConnected).Code != "ABCD" {
+		t.Fatalf("Expected the whole packet to parse.")
+	}
+
+	// A length that runs past the end is rejected before anything is allocated for it.
+	bad := append([]byte{}, packed...)
+	binary.LittleEndian.PutUint32(bad[FrameLen+12:], 1<<31)
+	if err := (&GameConnected{}).Deserialize(bad[FrameLen:]); err != ErrTruncated {
+		t.Fatalf("Expected ErrTruncated for an impossible array length, got %v", err)
+	}
+}
@@ -0,0 +1,9 @@
+package messages
+
+// Values of LoginResp.Reason.
+const (
+	LoginOK             byte = iota // Logged in.
+	LoginBadCredentials             // No account with that name and password.
+	LoginThrottled                  // Too many failed logins, try again in RetryAfter seconds.
+	LoginError                      // Something went wrong on the server.
+)
@@ -4,11 +4,12 @@ import (
 	"encoding/binary"
 	"log"
 	"math"
+	"strconv"
 )
 
 type Net interface {
 	Serialize([]byte)
-	Deserialize([]byte)
+	Deserialize([]byte) error
 	Len() int
 }
 
@@ -35,9 +36,126 @@ const (
 	UpdateEntityMsgType
 	SnakeDiedMsgType
 	Vect2MsgType
+	ConnectMsgType
+	ConnectChallengeMsgType
+	SessionKeyMsgType
+	SessionKeyAckMsgType
+	EncryptedMsgType
+	WarningMsgType
+	MTUProbeMsgType
+	MTUProbeAckMsgType
+	JoinGameFailedMsgType
+	GuestLoginMsgType
+	PlayerStatsMsgType
+	TopPlayersReqMsgType
+	TopPlayersMsgType
+	LeaderboardEntryMsgType
+	LeaderboardMsgType
+	MinimapSnakeMsgType
+	MinimapMsgType
+	ChatSendMsgType
+	ChatMsgType
+	ChatMutedMsgType
+	SpectateMsgType
+	SpectatingMsgType
+	AreaFoodMsgType
 	AMsgType
 )
 
+func (t MessageType) String() string {
+	switch t {
+	case UnknownMsgType:
+		return "Unknown"
+	case AckMsgType:
+		return "Ack"
+	case MultipartMsgType:
+		return "Multipart"
+	case HeartbeatMsgType:
+		return "Heartbeat"
+	case ConnectedMsgType:
+		return "Connected"
+	case DisconnectedMsgType:
+		return "Disconnected"
+	case CreateAcctMsgType:
+		return "CreateAcct"
+	case CreateAcctRespMsgType:
+		return "CreateAcctResp"
+	case LoginMsgType:
+		return "Login"
+	case LoginRespMsgType:
+		return "LoginResp"
+	case JoinGameMsgType:
+		return "JoinGame"
+	case GameConnectedMsgType:
+		return "GameConnected"
+	case GameMasterFrameMsgType:
+		return "GameMasterFrame"
+	case EntityMsgType:
+		return "Entity"
+	case SnakeMsgType:
+		return "Snake"
+	case TurnSnakeMsgType:
+		return "TurnSnake"
+	case RemoveEntityMsgType:
+		return "RemoveEntity"
+	case UpdateEntityMsgType:
+		return "UpdateEntity"
+	case SnakeDiedMsgType:
+		return "SnakeDied"
+	case Vect2MsgType:
+		return "Vect2"
+	case ConnectMsgType:
+		return "Connect"
+	case ConnectChallengeMsgType:
+		return "ConnectChallenge"
+	case SessionKeyMsgType:
+		return "SessionKey"
+	case SessionKeyAckMsgType:
+		return "SessionKeyAck"
+	case EncryptedMsgType:
+		return "Encrypted"
+	case WarningMsgType:
+		return "Warning"
+	case MTUProbeMsgType:
+		return "MTUProbe"
+	case MTUProbeAckMsgType:
+		return "MTUProbeAck"
+	case JoinGameFailedMsgType:
+		return "JoinGameFailed"
+	case GuestLoginMsgType:
+		return "GuestLogin"
+	case PlayerStatsMsgType:
+		return "PlayerStats"
+	case TopPlayersReqMsgType:
+		return "TopPlayersReq"
+	case TopPlayersMsgType:
+		return "TopPlayers"
+	case LeaderboardEntryMsgType:
+		return "LeaderboardEntry"
+	case LeaderboardMsgType:
+		return "Leaderboard"
+	case MinimapSnakeMsgType:
+		return "MinimapSnake"
+	case MinimapMsgType:
+		return "Minimap"
+	case ChatSendMsgType:
+		return "ChatSend"
+	case ChatMsgType:
+		return "Chat"
+	case ChatMutedMsgType:
+		return "ChatMuted"
+	case SpectateMsgType:
+		return "Spectate"
+	case SpectatingMsgType:
+		return "Spectating"
+	case AreaFoodMsgType:
+		return "AreaFood"
+	case AMsgType:
+		return "A"
+	}
+	return "MessageType(" + strconv.Itoa(int(t)) + ")"
+}
+
 // ParseNetMessage accepts input of raw bytes from a NetMessage. Parses and returns a Net message.
 func ParseNetMessage(packet Packet, content []byte) Net {
 	var msg Net
@@ -78,13 +196,61 @@ func ParseNetMessage(packet Packet, content []byte) Net {
 		msg = &SnakeDied{}
 	case Vect2MsgType:
 		msg = &Vect2{}
+	case ConnectMsgType:
+		msg = &Connect{}
+	case ConnectChallengeMsgType:
+		msg = &ConnectChallenge{}
+	case SessionKeyMsgType:
+		msg = &SessionKey{}
+	case SessionKeyAckMsgType:
+		msg = &SessionKeyAck{}
+	case EncryptedMsgType:
+		msg = &Encrypted{}
+	case WarningMsgType:
+		msg = &Warning{}
+	case MTUProbeMsgType:
+		msg = &MTUProbe{}
+	case MTUProbeAckMsgType:
+		msg = &MTUProbeAck{}
+	case JoinGameFailedMsgType:
+		msg = &JoinGameFailed{}
+	case GuestLoginMsgType:
+		msg = &GuestLogin{}
+	case PlayerStatsMsgType:
+		msg = &PlayerStats{}
+	case TopPlayersReqMsgType:
+		msg = &TopPlayersReq{}
+	case TopPlayersMsgType:
+		msg = &TopPlayers{}
+	case LeaderboardEntryMsgType:
+		msg = &LeaderboardEntry{}
+	case LeaderboardMsgType:
+		msg = &Leaderboard{}
+	case MinimapSnakeMsgType:
+		msg = &MinimapSnake{}
+	case MinimapMsgType:
+		msg = &Minimap{}
+	case ChatSendMsgType:
+		msg = &ChatSend{}
+	case ChatMsgType:
+		msg = &Chat{}
+	case ChatMutedMsgType:
+		msg = &ChatMuted{}
+	case SpectateMsgType:
+		msg = &Spectate{}
+	case SpectatingMsgType:
+		msg = &Spectating{}
+	case AreaFoodMsgType:
+		msg = &AreaFood{}
 	case AMsgType:
 		msg = &A{}
 	default:
 		log.Printf("Unknown message type: %d", packet.Frame.MsgType)
 		return nil
 	}
-	msg.Deserialize(content)
+	if err := msg.Deserialize(content); err != nil {
+		return nil
+	}
 	return msg
 }
 
@@ -111,24 +277,43 @@ func (m *Multipart) Serialize(buffer []byte) {
 	_ = idx
 }
 
-func (m *Multipart) Deserialize(buffer []byte) {
+func (m *Multipart) Deserialize(buffer []byte) error {
 	idx := 0
+	if len(buffer)-idx < 2 {
+		return ErrTruncated
+	}
 	m.ID = binary.LittleEndian.Uint16(buffer[idx:])
 	idx+=2
+	if len(buffer)-idx < 4 {
+		return ErrTruncated
+	}
 	m.GroupID = binary.LittleEndian.Uint32(buffer[idx:])
 	idx+=4
+	if len(buffer)-idx < 2 {
+		return ErrTruncated
+	}
 	m.NumParts = binary.LittleEndian.Uint16(buffer[idx:])
 	idx+=2
+	if len(buffer)-idx < 4 {
+		return ErrTruncated
+	}
 	l3_1 := int(binary.LittleEndian.Uint32(buffer[idx:]))
 	idx += 4
+	if l3_1 < 0 || len(buffer)-idx < l3_1 {
+		return ErrTruncated
+	}
 	m.Content = make([]byte, l3_1)
 	for i := 0; i < int(l3_1); i++ {
+		if len(buffer)-idx < 1 {
+			return ErrTruncated
+		}
 		m.Content[i] = buffer[idx]
 
 		idx+=1
 	}
 
 	_ = idx
+	return nil
 }
 
 func (m *Multipart) Len() int {
@@ -143,6 +328,20 @@ func (m *Multipart) Len() int {
 type Heartbeat struct {
 	Time int64
 	Latency int64
+	RTTMin int64
+	RTTMax int64
+	Jitter int64
+	LossIn uint16
+	LossOut uint16
+	BytesInPerSec uint32
+	BytesOutPerSec uint32
+	FragmentsIn uint32
+	FragmentsOut uint32
+	Received uint32
+	Lost uint32
+	ClientTime int64
+	Tick uint32
+	TickTime int64
 }
 
 func (m *Heartbeat) Serialize(buffer []byte) {
@@ -151,44 +350,197 @@ func (m *Heartbeat) Serialize(buffer []byte) {
 	idx+=8
 	binary.LittleEndian.PutUint64(buffer[idx:], uint64(m.Latency))
 	idx+=8
+	binary.LittleEndian.PutUint64(buffer[idx:], uint64(m.RTTMin))
+	idx+=8
+	binary.LittleEndian.PutUint64(buffer[idx:], uint64(m.RTTMax))
+	idx+=8
+	binary.LittleEndian.PutUint64(buffer[idx:], uint64(m.Jitter))
+	idx+=8
+	binary.LittleEndian.PutUint16(buffer[idx:], uint16(m.LossIn))
+	idx+=2
+	binary.LittleEndian.PutUint16(buffer[idx:], uint16(m.LossOut))
+	idx+=2
+	binary.LittleEndian.PutUint32(buffer[idx:], uint32(m.BytesInPerSec))
+	idx+=4
+	binary.LittleEndian.PutUint32(buffer[idx:], uint32(m.BytesOutPerSec))
+	idx+=4
+	binary.LittleEndian.PutUint32(buffer[idx:], uint32(m.FragmentsIn))
+	idx+=4
+	binary.LittleEndian.PutUint32(buffer[idx:], uint32(m.FragmentsOut))
+	idx+=4
+	binary.LittleEndian.PutUint32(buffer[idx:], uint32(m.Received))
+	idx+=4
+	binary.LittleEndian.PutUint32(buffer[idx:], uint32(m.Lost))
+	idx+=4
+	binary.LittleEndian.PutUint64(buffer[idx:], uint64(m.ClientTime))
+	idx+=8
+	binary.LittleEndian.PutUint32(buffer[idx:], uint32(m.Tick))
+	idx+=4
+	binary.LittleEndian.PutUint64(buffer[idx:], uint64(m.TickTime))
+	idx+=8
 
 	_ = idx
 }
 
-func (m *Heartbeat) Deserialize(buffer []byte) {
+func (m *Heartbeat) Deserialize(buffer []byte) error {
 	idx := 0
+	if len(buffer)-idx < 8 {
+		return ErrTruncated
+	}
 	m.Time = int64(binary.LittleEndian.Uint64(buffer[idx:]))
 	idx+=8
+	if len(buffer)-idx < 8 {
+		return ErrTruncated
+	}
 	m.Latency = int64(binary.LittleEndian.Uint64(buffer[idx:]))
 	idx+=8
+	if len(buffer)-idx < 8 {
+		return ErrTruncated
+	}
+	m.RTTMin = int64(binary.LittleEndian.Uint64(buffer[idx:]))
+	idx+=8
+	if len(buffer)-idx < 8 {
+		return ErrTruncated
+	}
+	m.RTTMax = int64(binary.LittleEndian.Uint64(buffer[idx:]))
+	idx+=8
+	if len(buffer)-idx < 8 {
+		return ErrTruncated
+	}
+	m.Jitter = int64(binary.LittleEndian.Uint64(buffer[idx:]))
+	idx+=8
+	if len(buffer)-idx < 2 {
+		return ErrTruncated
+	}
+	m.LossIn = binary.LittleEndian.Uint16(buffer[idx:])
+	idx+=2
+	if len(buffer)-idx < 2 {
+		return ErrTruncated
+	}
+	m.LossOut = binary.LittleEndian.Uint16(buffer[idx:])
+	idx+=2
+	if len(buffer)-idx < 4 {
+		return ErrTruncated
+	}
+	m.BytesInPerSec = binary.LittleEndian.Uint32(buffer[idx:])
+	idx+=4
+	if len(buffer)-idx < 4 {
+		return ErrTruncated
+	}
+	m.BytesOutPerSec = binary.LittleEndian.Uint32(buffer[idx:])
+	idx+=4
+	if len(buffer)-idx < 4 {
+		return ErrTruncated
+	}
+	m.FragmentsIn = binary.LittleEndian.Uint32(buffer[idx:])
+	idx+=4
+	if len(buffer)-idx < 4 {
+		return ErrTruncated
+	}
+	m.FragmentsOut = binary.LittleEndian.Uint32(buffer[idx:])
+	idx+=4
+	if len(buffer)-idx < 4 {
+		return ErrTruncated
+	}
+	m.Received = binary.LittleEndian.Uint32(buffer[idx:])
+	idx+=4
+	if len(buffer)-idx < 4 {
+		return ErrTruncated
+	}
+	m.Lost = binary.LittleEndian.Uint32(buffer[idx:])
+	idx+=4
+	if len(buffer)-idx < 8 {
+		return ErrTruncated
+	}
+	m.ClientTime = int64(binary.LittleEndian.Uint64(buffer[idx:]))
+	idx+=8
+	if len(buffer)-idx < 4 {
+		return ErrTruncated
+	}
+	m.Tick = binary.LittleEndian.Uint32(buffer[idx:])
+	idx+=4
+	if len(buffer)-idx < 8 {
+		return ErrTruncated
+	}
+	m.TickTime = int64(binary.LittleEndian.Uint64(buffer[idx:]))
+	idx+=8
 
 	_ = idx
+	return nil
 }
 
 func (m *Heartbeat) Len() int {
 	mylen := 0
 	mylen += 8
 	mylen += 8
+	mylen += 8
+	mylen += 8
+	mylen += 8
+	mylen += 2
+	mylen += 2
+	mylen += 4
+	mylen += 4
+	mylen += 4
+	mylen += 4
+	mylen += 4
+	mylen += 4
+	mylen += 8
+	mylen += 4
+	mylen += 8
 	return mylen
 }
 
 type Connected struct {
+	PublicKey []byte
+	Resumed byte
 }
 
 func (m *Connected) Serialize(buffer []byte) {
 	idx := 0
+	binary.LittleEndian.PutUint32(buffer[idx:], uint32(len(m.PublicKey)))
+	idx += 4
+	copy(buffer[idx:], m.PublicKey)
+	idx+=len(m.PublicKey)
+	buffer[idx] = m.Resumed
+	idx+=1
 
 	_ = idx
 }
 
-func (m *Connected) Deserialize(buffer []byte) {
+func (m *Connected) Deserialize(buffer []byte) error {
 	idx := 0
+	if len(buffer)-idx < 4 {
+		return ErrTruncated
+	}
+	l0_1 := int(binary.LittleEndian.Uint32(buffer[idx:]))
+	idx += 4
+	if l0_1 < 0 || len(buffer)-idx < l0_1 {
+		return ErrTruncated
+	}
+	m.PublicKey = make([]byte, l0_1)
+	for i := 0; i < int(l0_1); i++ {
+		if len(buffer)-idx < 1 {
+			return ErrTruncated
+		}
+		m.PublicKey[i] = buffer[idx]
+
+		idx+=1
+	}
+	if len(buffer)-idx < 1 {
+		return ErrTruncated
+	}
+	m.Resumed = buffer[idx]
+
+	idx+=1
 
 	_ = idx
+	return nil
 }
 
 func (m *Connected) Len() int {
 	mylen := 0
+	mylen += 4 + len(m.PublicKey)
+	mylen += 1
 	return mylen
 }
 
@@ -201,10 +553,11 @@ func (m *Disconnected) Serialize(buffer []byte) {
 	_ = idx
 }
 
-func (m *Disconnected) Deserialize(buffer []byte) {
+func (m *Disconnected) Deserialize(buffer []byte) error {
 	idx := 0
 
 	_ = idx
+	return nil
 }
 
 func (m *Disconnected) Len() int {
@@ -231,18 +584,31 @@ func (m *CreateAcct) Serialize(buffer []byte) {
 	_ = idx
 }
 
-func (m *CreateAcct) Deserialize(buffer []byte) {
+func (m *CreateAcct) Deserialize(buffer []byte) error {
 	idx := 0
+	if len(buffer)-idx < 4 {
+		return ErrTruncated
+	}
 	l0_1 := int(binary.LittleEndian.Uint32(buffer[idx:]))
 	idx += 4
+	if l0_1 < 0 || len(buffer)-idx < l0_1 {
+		return ErrTruncated
+	}
 	m.Name = string(buffer[idx:idx+l0_1])
 	idx+=len(m.Name)
+	if len(buffer)-idx < 4 {
+		return ErrTruncated
+	}
 	l1_1 := int(binary.LittleEndian.Uint32(buffer[idx:]))
 	idx += 4
+	if l1_1 < 0 || len(buffer)-idx < l1_1 {
+		return ErrTruncated
+	}
 	m.Password = string(buffer[idx:idx+l1_1])
 	idx+=len(m.Password)
 
 	_ = idx
+	return nil
 }
 
 func (m *CreateAcct) Len() int {
@@ -255,6 +621,8 @@ func (m *CreateAcct) Len() int {
 type CreateAcctResp struct {
 	AccountID uint32
 	Name string
+	Token []byte
+	Reason string
 }
 
 func (m *CreateAcctResp) Serialize(buffer []byte) {
@@ -265,26 +633,73 @@ func (m *CreateAcctResp) Serialize(buffer []byte) {
 	idx += 4
 	copy(buffer[idx:], []byte(m.Name))
 	idx+=len(m.Name)
+	binary.LittleEndian.PutUint32(buffer[idx:], uint32(len(m.Token)))
+	idx += 4
+	copy(buffer[idx:], m.Token)
+	idx+=len(m.Token)
+	binary.LittleEndian.PutUint32(buffer[idx:], uint32(len(m.Reason)))
+	idx += 4
+	copy(buffer[idx:], []byte(m.Reason))
+	idx+=len(m.Reason)
 
 	_ = idx
 }
 
-func (m *CreateAcctResp) Deserialize(buffer []byte) {
+func (m *CreateAcctResp) Deserialize(buffer []byte) error {
 	idx := 0
+	if len(buffer)-idx < 4 {
+		return ErrTruncated
+	}
 	m.AccountID = binary.LittleEndian.Uint32(buffer[idx:])
 	idx+=4
+	if len(buffer)-idx < 4 {
+		return ErrTruncated
+	}
 	l1_1 := int(binary.LittleEndian.Uint32(buffer[idx:]))
 	idx += 4
+	if l1_1 < 0 || len(buffer)-idx < l1_1 {
+		return ErrTruncated
+	}
 	m.Name = string(buffer[idx:idx+l1_1])
 	idx+=len(m.Name)
+	if len(buffer)-idx < 4 {
+		return ErrTruncated
+	}
+	l2_1 := int(binary.LittleEndian.Uint32(buffer[idx:]))
+	idx += 4
+	if l2_1 < 0 || len(buffer)-idx < l2_1 {
+		return ErrTruncated
+	}
+	m.Token = make([]byte, l2_1)
+	for i := 0; i < int(l2_1); i++ {
+		if len(buffer)-idx < 1 {
+			return ErrTruncated
+		}
+		m.Token[i] = buffer[idx]
+
+		idx+=1
+	}
+	if len(buffer)-idx < 4 {
+		return ErrTruncated
+	}
+	l3_1 := int(binary.LittleEndian.Uint32(buffer[idx:]))
+	idx += 4
+	if l3_1 < 0 || len(buffer)-idx < l3_1 {
+		return ErrTruncated
+	}
+	m.Reason = string(buffer[idx:idx+l3_1])
+	idx+=len(m.Reason)
 
 	_ = idx
+	return nil
 }
 
 func (m *CreateAcctResp) Len() int {
 	mylen := 0
 	mylen += 4
 	mylen += 4 + len(m.Name)
+	mylen += 4 + len(m.Token)
+	mylen += 4 + len(m.Reason)
 	return mylen
 }
 
@@ -307,18 +722,31 @@ func (m *Login) Serialize(buffer []byte) {
 	_ = idx
 }
 
-func (m *Login) Deserialize(buffer []byte) {
+func (m *Login) Deserialize(buffer []byte) error {
 	idx := 0
+	if len(buffer)-idx < 4 {
+		return ErrTruncated
+	}
 	l0_1 := int(binary.LittleEndian.Uint32(buffer[idx:]))
 	idx += 4
+	if l0_1 < 0 || len(buffer)-idx < l0_1 {
+		return ErrTruncated
+	}
 	m.Name = string(buffer[idx:idx+l0_1])
 	idx+=len(m.Name)
+	if len(buffer)-idx < 4 {
+		return ErrTruncated
+	}
 	l1_1 := int(binary.LittleEndian.Uint32(buffer[idx:]))
 	idx += 4
+	if l1_1 < 0 || len(buffer)-idx < l1_1 {
+		return ErrTruncated
+	}
 	m.Password = string(buffer[idx:idx+l1_1])
 	idx+=len(m.Password)
 
 	_ = idx
+	return nil
 }
 
 func (m *Login) Len() int {
@@ -332,6 +760,9 @@ type LoginResp struct {
 	Success byte
 	Name string
 	AccountID uint32
+	Token []byte
+	Reason byte
+	RetryAfter uint32
 }
 
 func (m *LoginResp) Serialize(buffer []byte) {
@@ -344,23 +775,72 @@ func (m *LoginResp) Serialize(buffer []byte) {
 	idx+=len(m.Name)
 	binary.LittleEndian.PutUint32(buffer[idx:], uint32(m.AccountID))
 	idx+=4
+	binary.LittleEndian.PutUint32(buffer[idx:], uint32(len(m.Token)))
+	idx += 4
+	copy(buffer[idx:], m.Token)
+	idx+=len(m.Token)
+	buffer[idx] = m.Reason
+	idx+=1
+	binary.LittleEndian.PutUint32(buffer[idx:], uint32(m.RetryAfter))
+	idx+=4
 
 	_ = idx
 }
 
-func (m *LoginResp) Deserialize(buffer []byte) {
+func (m *LoginResp) Deserialize(buffer []byte) error {
 	idx := 0
+	if len(buffer)-idx < 1 {
+		return ErrTruncated
+	}
 	m.Success = buffer[idx]
 
 	idx+=1
+	if len(buffer)-idx < 4 {
+		return ErrTruncated
+	}
 	l1_1 := int(binary.LittleEndian.Uint32(buffer[idx:]))
 	idx += 4
+	if l1_1 < 0 || len(buffer)-idx < l1_1 {
+		return ErrTruncated
+	}
 	m.Name = string(buffer[idx:idx+l1_1])
 	idx+=len(m.Name)
+	if len(buffer)-idx < 4 {
+		return ErrTruncated
+	}
 	m.AccountID = binary.LittleEndian.Uint32(buffer[idx:])
 	idx+=4
+	if len(buffer)-idx < 4 {
+		return ErrTruncated
+	}
+	l3_1 := int(binary.LittleEndian.Uint32(buffer[idx:]))
+	idx += 4
+	if l3_1 < 0 || len(buffer)-idx < l3_1 {
+		return ErrTruncated
+	}
+	m.Token = make([]byte, l3_1)
+	for i := 0; i < int(l3_1); i++ {
+		if len(buffer)-idx < 1 {
+			return ErrTruncated
+		}
+		m.Token[i] = buffer[idx]
+
+		idx+=1
+	}
+	if len(buffer)-idx < 1 {
+		return ErrTruncated
+	}
+	m.Reason = buffer[idx]
+
+	idx+=1
+	if len(buffer)-idx < 4 {
+		return ErrTruncated
+	}
+	m.RetryAfter = binary.LittleEndian.Uint32(buffer[idx:])
+	idx+=4
 
 	_ = idx
+	return nil
 }
 
 func (m *LoginResp) Len() int {
@@ -368,26 +848,75 @@ func (m *LoginResp) Len() int {
 	mylen += 1
 	mylen += 4 + len(m.Name)
 	mylen += 4
+	mylen += 4 + len(m.Token)
+	mylen += 1
+	mylen += 4
 	return mylen
 }
 
 type JoinGame struct {
+	Private byte
+	Code string
+	GameID uint32
+	Spectate byte
 }
 
 func (m *JoinGame) Serialize(buffer []byte) {
 	idx := 0
+	buffer[idx] = m.Private
+	idx+=1
+	binary.LittleEndian.PutUint32(buffer[idx:], uint32(len(m.Code)))
+	idx += 4
+	copy(buffer[idx:], []byte(m.Code))
+	idx+=len(m.Code)
+	binary.LittleEndian.PutUint32(buffer[idx:], uint32(m.GameID))
+	idx+=4
+	buffer[idx] = m.Spectate
+	idx+=1
 
 	_ = idx
 }
 
-func (m *JoinGame) Deserialize(buffer []byte) {
+func (m *JoinGame) Deserialize(buffer []byte) error {
 	idx := 0
+	if len(buffer)-idx < 1 {
+		return ErrTruncated
+	}
+	m.Private = buffer[idx]
+
+	idx+=1
+	if len(buffer)-idx < 4 {
+		return ErrTruncated
+	}
+	l1_1 := int(binary.LittleEndian.Uint32(buffer[idx:]))
+	idx += 4
+	if l1_1 < 0 || len(buffer)-idx < l1_1 {
+		return ErrTruncated
+	}
+	m.Code = string(buffer[idx:idx+l1_1])
+	idx+=len(m.Code)
+	if len(buffer)-idx < 4 {
+		return ErrTruncated
+	}
+	m.GameID = binary.LittleEndian.Uint32(buffer[idx:])
+	idx+=4
+	if len(buffer)-idx < 1 {
+		return ErrTruncated
+	}
+	m.Spectate = buffer[idx]
+
+	idx+=1
 
 	_ = idx
+	return nil
 }
 
 func (m *JoinGame) Len() int {
 	mylen := 0
+	mylen += 1
+	mylen += 4 + len(m.Code)
+	mylen += 4
+	mylen += 1
 	return mylen
 }
 
@@ -397,6 +926,7 @@ type GameConnected struct {
 	TickID uint32
 	Entities []*Entity
 	Snakes []*Snake
+	Code string
 }
 
 func (m *GameConnected) Serialize(buffer []byte) {
@@ -419,36 +949,76 @@ func (m *GameConnected) Serialize(buffer []byte) {
 		v2.Serialize(buffer[idx:])
 		idx+=v2.Len()
 	}
+	binary.LittleEndian.PutUint32(buffer[idx:], uint32(len(m.Code)))
+	idx += 4
+	copy(buffer[idx:], []byte(m.Code))
+	idx+=len(m.Code)
 
 	_ = idx
 }
 
-func (m *GameConnected) Deserialize(buffer []byte) {
+func (m *GameConnected) Deserialize(buffer []byte) error {
 	idx := 0
+	if len(buffer)-idx < 4 {
+		return ErrTruncated
+	}
 	m.ID = binary.LittleEndian.Uint32(buffer[idx:])
 	idx+=4
+	if len(buffer)-idx < 4 {
+		return ErrTruncated
+	}
 	m.SnakeID = binary.LittleEndian.Uint32(buffer[idx:])
 	idx+=4
+	if len(buffer)-idx < 4 {
+		return ErrTruncated
+	}
 	m.TickID = binary.LittleEndian.Uint32(buffer[idx:])
 	idx+=4
+	if len(buffer)-idx < 4 {
+		return ErrTruncated
+	}
 	l3_1 := int(binary.LittleEndian.Uint32(buffer[idx:]))
 	idx += 4
+	if l3_1 < 0 || len(buffer)-idx < l3_1 {
+		return ErrTruncated
+	}
 	m.Entities = make([]*Entity, l3_1)
 	for i := 0; i < int(l3_1); i++ {
 		m.Entities[i] = new(Entity)
-		m.Entities[i].Deserialize(buffer[idx:])
-idx+=m.Entities[i].Len()
+		if err := m.Entities[i].Deserialize(buffer[idx:]); err != nil {
+			return err
+		}
+		idx+=m.Entities[i].Len()
+	}
+	if len(buffer)-idx < 4 {
+		return ErrTruncated
 	}
 	l4_1 := int(binary.LittleEndian.Uint32(buffer[idx:]))
 	idx += 4
+	if l4_1 < 0 || len(buffer)-idx < l4_1 {
+		return ErrTruncated
+	}
 	m.Snakes = make([]*Snake, l4_1)
 	for i := 0; i < int(l4_1); i++ {
 		m.Snakes[i] = new(Snake)
-		m.Snakes[i].Deserialize(buffer[idx:])
-idx+=m.Snakes[i].Len()
+		if err := m.Snakes[i].Deserialize(buffer[idx:]); err != nil {
+			return err
+		}
+		idx+=m.Snakes[i].Len()
+	}
+	if len(buffer)-idx < 4 {
+		return ErrTruncated
+	}
+	l5_1 := int(binary.LittleEndian.Uint32(buffer[idx:]))
+	idx += 4
+	if l5_1 < 0 || len(buffer)-idx < l5_1 {
+		return ErrTruncated
 	}
+	m.Code = string(buffer[idx:idx+l5_1])
+	idx+=len(m.Code)
 
 	_ = idx
+	return nil
 }
 
 func (m *GameConnected) Len() int {
@@ -468,6 +1038,7 @@ func (m *GameConnected) Len() int {
 		mylen += v2.Len()
 	}
 
+	mylen += 4 + len(m.Code)
 	return mylen
 }
 
@@ -500,30 +1071,53 @@ func (m *GameMasterFrame) Serialize(buffer []byte) {
 	_ = idx
 }
 
-func (m *GameMasterFrame) Deserialize(buffer []byte) {
+func (m *GameMasterFrame) Deserialize(buffer []byte) error {
 	idx := 0
+	if len(buffer)-idx < 4 {
+		return ErrTruncated
+	}
 	m.ID = binary.LittleEndian.Uint32(buffer[idx:])
 	idx+=4
+	if len(buffer)-idx < 4 {
+		return ErrTruncated
+	}
 	l1_1 := int(binary.LittleEndian.Uint32(buffer[idx:]))
 	idx += 4
+	if l1_1 < 0 || len(buffer)-idx < l1_1 {
+		return ErrTruncated
+	}
 	m.Entities = make([]*Entity, l1_1)
 	for i := 0; i < int(l1_1); i++ {
 		m.Entities[i] = new(Entity)
-		m.Entities[i].Deserialize(buffer[idx:])
-idx+=m.Entities[i].Len()
+		if err := m.Entities[i].Deserialize(buffer[idx:]); err != nil {
+			return err
+		}
+		idx+=m.Entities[i].Len()
+	}
+	if len(buffer)-idx < 4 {
+		return ErrTruncated
 	}
 	l2_1 := int(binary.LittleEndian.Uint32(buffer[idx:]))
 	idx += 4
+	if l2_1 < 0 || len(buffer)-idx < l2_1 {
+		return ErrTruncated
+	}
 	m.Snakes = make([]*Snake, l2_1)
 	for i := 0; i < int(l2_1); i++ {
 		m.Snakes[i] = new(Snake)
-		m.Snakes[i].Deserialize(buffer[idx:])
-idx+=m.Snakes[i].Len()
+		if err := m.Snakes[i].Deserialize(buffer[idx:]); err != nil {
+			return err
+		}
+		idx+=m.Snakes[i].Len()
+	}
+	if len(buffer)-idx < 4 {
+		return ErrTruncated
 	}
 	m.Tick = binary.LittleEndian.Uint32(buffer[idx:])
 	idx+=4
 
 	_ = idx
+	return nil
 }
 
 func (m *GameMasterFrame) Len() int {
@@ -572,23 +1166,41 @@ func (m *Entity) Serialize(buffer []byte) {
 	_ = idx
 }
 
-func (m *Entity) Deserialize(buffer []byte) {
+func (m *Entity) Deserialize(buffer []byte) error {
 	idx := 0
+	if len(buffer)-idx < 4 {
+		return ErrTruncated
+	}
 	m.ID = binary.LittleEndian.Uint32(buffer[idx:])
 	idx+=4
+	if len(buffer)-idx < 2 {
+		return ErrTruncated
+	}
 	m.EType = binary.LittleEndian.Uint16(buffer[idx:])
 	idx+=2
+	if len(buffer)-idx < 4 {
+		return ErrTruncated
+	}
 	m.X = int32(binary.LittleEndian.Uint32(buffer[idx:]))
 	idx+=4
+	if len(buffer)-idx < 4 {
+		return ErrTruncated
+	}
 	m.Y = int32(binary.LittleEndian.Uint32(buffer[idx:]))
 	idx+=4
+	if len(buffer)-idx < 4 {
+		return ErrTruncated
+	}
 	m.Size = int32(binary.LittleEndian.Uint32(buffer[idx:]))
 	idx+=4
 	m.Facing = new(Vect2)
-	m.Facing.Deserialize(buffer[idx:])
-idx+=m.Facing.Len()
+	if err := m.Facing.Deserialize(buffer[idx:]); err != nil {
+		return err
+	}
+	idx+=m.Facing.Len()
 
 	_ = idx
+	return nil
 }
 
 func (m *Entity) Len() int {
@@ -632,27 +1244,52 @@ func (m *Snake) Serialize(buffer []byte) {
 	_ = idx
 }
 
-func (m *Snake) Deserialize(buffer []byte) {
+func (m *Snake) Deserialize(buffer []byte) error {
 	idx := 0
+	if len(buffer)-idx < 4 {
+		return ErrTruncated
+	}
 	m.ID = binary.LittleEndian.Uint32(buffer[idx:])
 	idx+=4
+	if len(buffer)-idx < 4 {
+		return ErrTruncated
+	}
 	l1_1 := int(binary.LittleEndian.Uint32(buffer[idx:]))
 	idx += 4
+	if l1_1 < 0 || len(buffer)-idx < l1_1 {
+		return ErrTruncated
+	}
 	m.Name = string(buffer[idx:idx+l1_1])
 	idx+=len(m.Name)
+	if len(buffer)-idx < 4 {
+		return ErrTruncated
+	}
 	l2_1 := int(binary.LittleEndian.Uint32(buffer[idx:]))
 	idx += 4
+	if l2_1 < 0 || len(buffer)-idx < l2_1 {
+		return ErrTruncated
+	}
 	m.Segments = make([]uint32, l2_1)
 	for i := 0; i < int(l2_1); i++ {
+		if len(buffer)-idx < 4 {
+			return ErrTruncated
+		}
 		m.Segments[i] = binary.LittleEndian.Uint32(buffer[idx:])
 		idx+=4
 	}
+	if len(buffer)-idx < 4 {
+		return ErrTruncated
+	}
 	m.Speed = int32(binary.LittleEndian.Uint32(buffer[idx:]))
 	idx+=4
+	if len(buffer)-idx < 2 {
+		return ErrTruncated
+	}
 	m.Turning = int16(binary.LittleEndian.Uint16(buffer[idx:]))
 	idx+=2
 
 	_ = idx
+	return nil
 }
 
 func (m *Snake) Len() int {
@@ -688,16 +1325,26 @@ func (m *TurnSnake) Serialize(buffer []byte) {
 	_ = idx
 }
 
-func (m *TurnSnake) Deserialize(buffer []byte) {
+func (m *TurnSnake) Deserialize(buffer []byte) error {
 	idx := 0
+	if len(buffer)-idx < 4 {
+		return ErrTruncated
+	}
 	m.ID = binary.LittleEndian.Uint32(buffer[idx:])
 	idx+=4
+	if len(buffer)-idx < 2 {
+		return ErrTruncated
+	}
 	m.Direction = int16(binary.LittleEndian.Uint16(buffer[idx:]))
 	idx+=2
+	if len(buffer)-idx < 4 {
+		return ErrTruncated
+	}
 	m.TickID = binary.LittleEndian.Uint32(buffer[idx:])
 	idx+=4
 
 	_ = idx
+	return nil
 }
 
 func (m *TurnSnake) Len() int {
@@ -720,13 +1367,16 @@ func (m *RemoveEntity) Serialize(buffer []byte) {
 	_ = idx
 }
 
-func (m *RemoveEntity) Deserialize(buffer []byte) {
+func (m *RemoveEntity) Deserialize(buffer []byte) error {
 	idx := 0
 	m.Ent = new(Entity)
-	m.Ent.Deserialize(buffer[idx:])
-idx+=m.Ent.Len()
+	if err := m.Ent.Deserialize(buffer[idx:]); err != nil {
+		return err
+	}
+	idx+=m.Ent.Len()
 
 	_ = idx
+	return nil
 }
 
 func (m *RemoveEntity) Len() int {
@@ -747,13 +1397,16 @@ func (m *UpdateEntity) Serialize(buffer []byte) {
 	_ = idx
 }
 
-func (m *UpdateEntity) Deserialize(buffer []byte) {
+func (m *UpdateEntity) Deserialize(buffer []byte) error {
 	idx := 0
 	m.Ent = new(Entity)
-	m.Ent.Deserialize(buffer[idx:])
-idx+=m.Ent.Len()
+	if err := m.Ent.Deserialize(buffer[idx:]); err != nil {
+		return err
+	}
+	idx+=m.Ent.Len()
 
 	_ = idx
+	return nil
 }
 
 func (m *UpdateEntity) Len() int {
@@ -774,12 +1427,16 @@ func (m *SnakeDied) Serialize(buffer []byte) {
 	_ = idx
 }
 
-func (m *SnakeDied) Deserialize(buffer []byte) {
+func (m *SnakeDied) Deserialize(buffer []byte) error {
 	idx := 0
+	if len(buffer)-idx < 4 {
+		return ErrTruncated
+	}
 	m.ID = binary.LittleEndian.Uint32(buffer[idx:])
 	idx+=4
 
 	_ = idx
+	return nil
 }
 
 func (m *SnakeDied) Len() int {
@@ -803,14 +1460,21 @@ func (m *Vect2) Serialize(buffer []byte) {
 	_ = idx
 }
 
-func (m *Vect2) Deserialize(buffer []byte) {
+func (m *Vect2) Deserialize(buffer []byte) error {
 	idx := 0
+	if len(buffer)-idx < 4 {
+		return ErrTruncated
+	}
 	m.X = int32(binary.LittleEndian.Uint32(buffer[idx:]))
 	idx+=4
+	if len(buffer)-idx < 4 {
+		return ErrTruncated
+	}
 	m.Y = int32(binary.LittleEndian.Uint32(buffer[idx:]))
 	idx+=4
 
 	_ = idx
+	return nil
 }
 
 func (m *Vect2) Len() int {
@@ -820,58 +1484,1261 @@ func (m *Vect2) Len() int {
 	return mylen
 }
 
-type A struct {
-	Name string
-	BirthDay int64
-	Phone string
-	Siblings int32
-	Spouse byte
-	Money float64
+type Connect struct {
+	Cookie []byte
+	Token []byte
+	Proof []byte
 }
 
-func (m *A) Serialize(buffer []byte) {
+func (m *Connect) Serialize(buffer []byte) {
 	idx := 0
-	binary.LittleEndian.PutUint32(buffer[idx:], uint32(len(m.Name)))
+	binary.LittleEndian.PutUint32(buffer[idx:], uint32(len(m.Cookie)))
 	idx += 4
-	copy(buffer[idx:], []byte(m.Name))
-	idx+=len(m.Name)
-	binary.LittleEndian.PutUint64(buffer[idx:], uint64(m.BirthDay))
-	idx+=8
-	binary.LittleEndian.PutUint32(buffer[idx:], uint32(len(m.Phone)))
+	copy(buffer[idx:], m.Cookie)
+	idx+=len(m.Cookie)
+	binary.LittleEndian.PutUint32(buffer[idx:], uint32(len(m.Token)))
 	idx += 4
-	copy(buffer[idx:], []byte(m.Phone))
-	idx+=len(m.Phone)
-	binary.LittleEndian.PutUint32(buffer[idx:], uint32(m.Siblings))
-	idx+=4
-	buffer[idx] = m.Spouse
-	idx+=1
-	binary.LittleEndian.PutUint64(buffer[idx:], math.Float64bits(m.Money))
-	idx+=8
+	copy(buffer[idx:], m.Token)
+	idx+=len(m.Token)
+	binary.LittleEndian.PutUint32(buffer[idx:], uint32(len(m.Proof)))
+	idx += 4
+	copy(buffer[idx:], m.Proof)
+	idx+=len(m.Proof)
 
 	_ = idx
 }
 
-func (m *A) Deserialize(buffer []byte) {
+func (m *Connect) Deserialize(buffer []byte) error {
 	idx := 0
+	if len(buffer)-idx < 4 {
+		return ErrTruncated
+	}
 	l0_1 := int(binary.LittleEndian.Uint32(buffer[idx:]))
 	idx += 4
-	m.Name = string(buffer[idx:idx+l0_1])
-	idx+=len(m.Name)
-	m.BirthDay = int64(binary.LittleEndian.Uint64(buffer[idx:]))
-	idx+=8
-	l2_1 := int(binary.LittleEndian.Uint32(buffer[idx:]))
+	if l0_1 < 0 || len(buffer)-idx < l0_1 {
+		return ErrTruncated
+	}
+	m.Cookie = make([]byte, l0_1)
+	for i := 0; i < int(l0_1); i++ {
+		if len(buffer)-idx < 1 {
+			return ErrTruncated
+		}
+		m.Cookie[i] = buffer[idx]
+
+		idx+=1
+	}
+	if len(buffer)-idx < 4 {
+		return ErrTruncated
+	}
+	l1_1 := int(binary.LittleEndian.Uint32(buffer[idx:]))
 	idx += 4
-	m.Phone = string(buffer[idx:idx+l2_1])
-	idx+=len(m.Phone)
-	m.Siblings = int32(binary.LittleEndian.Uint32(buffer[idx:]))
-	idx+=4
-	m.Spouse = buffer[idx]
+	if l1_1 < 0 || len(buffer)-idx < l1_1 {
+		return ErrTruncated
+	}
+	m.Token = make([]byte, l1_1)
+	for i := 0; i < int(l1_1); i++ {
+		if len(buffer)-idx < 1 {
+			return ErrTruncated
+		}
+		m.Token[i] = buffer[idx]
 
-	idx+=1
+		idx+=1
+	}
+	if len(buffer)-idx < 4 {
+		return ErrTruncated
+	}
+	l2_1 := int(binary.LittleEndian.Uint32(buffer[idx:]))
+	idx += 4
+	if l2_1 < 0 || len(buffer)-idx < l2_1 {
+		return ErrTruncated
+	}
+	m.Proof = make([]byte, l2_1)
+	for i := 0; i < int(l2_1); i++ {
+		if len(buffer)-idx < 1 {
+			return ErrTruncated
+		}
+		m.Proof[i] = buffer[idx]
+
+		idx+=1
+	}
+
+	_ = idx
+	return nil
+}
+
+func (m *Connect) Len() int {
+	mylen := 0
+	mylen += 4 + len(m.Cookie)
+	mylen += 4 + len(m.Token)
+	mylen += 4 + len(m.Proof)
+	return mylen
+}
+
+type ConnectChallenge struct {
+	Cookie []byte
+}
+
+func (m *ConnectChallenge) Serialize(buffer []byte) {
+	idx := 0
+	binary.LittleEndian.PutUint32(buffer[idx:], uint32(len(m.Cookie)))
+	idx += 4
+	copy(buffer[idx:], m.Cookie)
+	idx+=len(m.Cookie)
+
+	_ = idx
+}
+
+func (m *ConnectChallenge) Deserialize(buffer []byte) error {
+	idx := 0
+	if len(buffer)-idx < 4 {
+		return ErrTruncated
+	}
+	l0_1 := int(binary.LittleEndian.Uint32(buffer[idx:]))
+	idx += 4
+	if l0_1 < 0 || len(buffer)-idx < l0_1 {
+		return ErrTruncated
+	}
+	m.Cookie = make([]byte, l0_1)
+	for i := 0; i < int(l0_1); i++ {
+		if len(buffer)-idx < 1 {
+			return ErrTruncated
+		}
+		m.Cookie[i] = buffer[idx]
+
+		idx+=1
+	}
+
+	_ = idx
+	return nil
+}
+
+func (m *ConnectChallenge) Len() int {
+	mylen := 0
+	mylen += 4 + len(m.Cookie)
+	return mylen
+}
+
+type SessionKey struct {
+	Key []byte
+}
+
+func (m *SessionKey) Serialize(buffer []byte) {
+	idx := 0
+	binary.LittleEndian.PutUint32(buffer[idx:], uint32(len(m.Key)))
+	idx += 4
+	copy(buffer[idx:], m.Key)
+	idx+=len(m.Key)
+
+	_ = idx
+}
+
+func (m *SessionKey) Deserialize(buffer []byte) error {
+	idx := 0
+	if len(buffer)-idx < 4 {
+		return ErrTruncated
+	}
+	l0_1 := int(binary.LittleEndian.Uint32(buffer[idx:]))
+	idx += 4
+	if l0_1 < 0 || len(buffer)-idx < l0_1 {
+		return ErrTruncated
+	}
+	m.Key = make([]byte, l0_1)
+	for i := 0; i < int(l0_1); i++ {
+		if len(buffer)-idx < 1 {
+			return ErrTruncated
+		}
+		m.Key[i] = buffer[idx]
+
+		idx+=1
+	}
+
+	_ = idx
+	return nil
+}
+
+func (m *SessionKey) Len() int {
+	mylen := 0
+	mylen += 4 + len(m.Key)
+	return mylen
+}
+
+type SessionKeyAck struct {
+}
+
+func (m *SessionKeyAck) Serialize(buffer []byte) {
+	idx := 0
+
+	_ = idx
+}
+
+func (m *SessionKeyAck) Deserialize(buffer []byte) error {
+	idx := 0
+
+	_ = idx
+	return nil
+}
+
+func (m *SessionKeyAck) Len() int {
+	mylen := 0
+	return mylen
+}
+
+type Encrypted struct {
+	Seq uint64
+	Data []byte
+}
+
+func (m *Encrypted) Serialize(buffer []byte) {
+	idx := 0
+	binary.LittleEndian.PutUint64(buffer[idx:], uint64(m.Seq))
+	idx+=8
+	binary.LittleEndian.PutUint32(buffer[idx:], uint32(len(m.Data)))
+	idx += 4
+	copy(buffer[idx:], m.Data)
+	idx+=len(m.Data)
+
+	_ = idx
+}
+
+func (m *Encrypted) Deserialize(buffer []byte) error {
+	idx := 0
+	if len(buffer)-idx < 8 {
+		return ErrTruncated
+	}
+	m.Seq = binary.LittleEndian.Uint64(buffer[idx:])
+	idx+=8
+	if len(buffer)-idx < 4 {
+		return ErrTruncated
+	}
+	l1_1 := int(binary.LittleEndian.Uint32(buffer[idx:]))
+	idx += 4
+	if l1_1 < 0 || len(buffer)-idx < l1_1 {
+		return ErrTruncated
+	}
+	m.Data = make([]byte, l1_1)
+	for i := 0; i < int(l1_1); i++ {
+		if len(buffer)-idx < 1 {
+			return ErrTruncated
+		}
+		m.Data[i] = buffer[idx]
+
+		idx+=1
+	}
+
+	_ = idx
+	return nil
+}
+
+func (m *Encrypted) Len() int {
+	mylen := 0
+	mylen += 8
+	mylen += 4 + len(m.Data)
+	return mylen
+}
+
+type Warning struct {
+	Reason string
+}
+
+func (m *Warning) Serialize(buffer []byte) {
+	idx := 0
+	binary.LittleEndian.PutUint32(buffer[idx:], uint32(len(m.Reason)))
+	idx += 4
+	copy(buffer[idx:], []byte(m.Reason))
+	idx+=len(m.Reason)
+
+	_ = idx
+}
+
+func (m *Warning) Deserialize(buffer []byte) error {
+	idx := 0
+	if len(buffer)-idx < 4 {
+		return ErrTruncated
+	}
+	l0_1 := int(binary.LittleEndian.Uint32(buffer[idx:]))
+	idx += 4
+	if l0_1 < 0 || len(buffer)-idx < l0_1 {
+		return ErrTruncated
+	}
+	m.Reason = string(buffer[idx:idx+l0_1])
+	idx+=len(m.Reason)
+
+	_ = idx
+	return nil
+}
+
+func (m *Warning) Len() int {
+	mylen := 0
+	mylen += 4 + len(m.Reason)
+	return mylen
+}
+
+type MTUProbe struct {
+	Size uint16
+	Padding []byte
+}
+
+func (m *MTUProbe) Serialize(buffer []byte) {
+	idx := 0
+	binary.LittleEndian.PutUint16(buffer[idx:], uint16(m.Size))
+	idx+=2
+	binary.LittleEndian.PutUint32(buffer[idx:], uint32(len(m.Padding)))
+	idx += 4
+	copy(buffer[idx:], m.Padding)
+	idx+=len(m.Padding)
+
+	_ = idx
+}
+
+func (m *MTUProbe) Deserialize(buffer []byte) error {
+	idx := 0
+	if len(buffer)-idx < 2 {
+		return ErrTruncated
+	}
+	m.Size = binary.LittleEndian.Uint16(buffer[idx:])
+	idx+=2
+	if len(buffer)-idx < 4 {
+		return ErrTruncated
+	}
+	l1_1 := int(binary.LittleEndian.Uint32(buffer[idx:]))
+	idx += 4
+	if l1_1 < 0 || len(buffer)-idx < l1_1 {
+		return ErrTruncated
+	}
+	m.Padding = make([]byte, l1_1)
+	for i := 0; i < int(l1_1); i++ {
+		if len(buffer)-idx < 1 {
+			return ErrTruncated
+		}
+		m.Padding[i] = buffer[idx]
+
+		idx+=1
+	}
+
+	_ = idx
+	return nil
+}
+
+func (m *MTUProbe) Len() int {
+	mylen := 0
+	mylen += 2
+	mylen += 4 + len(m.Padding)
+	return mylen
+}
+
+type MTUProbeAck struct {
+	Size uint16
+}
+
+func (m *MTUProbeAck) Serialize(buffer []byte) {
+	idx := 0
+	binary.LittleEndian.PutUint16(buffer[idx:], uint16(m.Size))
+	idx+=2
+
+	_ = idx
+}
+
+func (m *MTUProbeAck) Deserialize(buffer []byte) error {
+	idx := 0
+	if len(buffer)-idx < 2 {
+		return ErrTruncated
+	}
+	m.Size = binary.LittleEndian.Uint16(buffer[idx:])
+	idx+=2
+
+	_ = idx
+	return nil
+}
+
+func (m *MTUProbeAck) Len() int {
+	mylen := 0
+	mylen += 2
+	return mylen
+}
+
+type JoinGameFailed struct {
+	Reason string
+}
+
+func (m *JoinGameFailed) Serialize(buffer []byte) {
+	idx := 0
+	binary.LittleEndian.PutUint32(buffer[idx:], uint32(len(m.Reason)))
+	idx += 4
+	copy(buffer[idx:], []byte(m.Reason))
+	idx+=len(m.Reason)
+
+	_ = idx
+}
+
+func (m *JoinGameFailed) Deserialize(buffer []byte) error {
+	idx := 0
+	if len(buffer)-idx < 4 {
+		return ErrTruncated
+	}
+	l0_1 := int(binary.LittleEndian.Uint32(buffer[idx:]))
+	idx += 4
+	if l0_1 < 0 || len(buffer)-idx < l0_1 {
+		return ErrTruncated
+	}
+	m.Reason = string(buffer[idx:idx+l0_1])
+	idx+=len(m.Reason)
+
+	_ = idx
+	return nil
+}
+
+func (m *JoinGameFailed) Len() int {
+	mylen := 0
+	mylen += 4 + len(m.Reason)
+	return mylen
+}
+
+type GuestLogin struct {
+}
+
+func (m *GuestLogin) Serialize(buffer []byte) {
+	idx := 0
+
+	_ = idx
+}
+
+func (m *GuestLogin) Deserialize(buffer []byte) error {
+	idx := 0
+
+	_ = idx
+	return nil
+}
+
+func (m *GuestLogin) Len() int {
+	mylen := 0
+	return mylen
+}
+
+type PlayerStats struct {
+	Name string
+	GamesPlayed uint32
+	Kills uint32
+	Deaths uint32
+	PeakLength uint32
+	FoodEaten uint32
+	TimeAlive uint32
+}
+
+func (m *PlayerStats) Serialize(buffer []byte) {
+	idx := 0
+	binary.LittleEndian.PutUint32(buffer[idx:], uint32(len(m.Name)))
+	idx += 4
+	copy(buffer[idx:], []byte(m.Name))
+	idx+=len(m.Name)
+	binary.LittleEndian.PutUint32(buffer[idx:], uint32(m.GamesPlayed))
+	idx+=4
+	binary.LittleEndian.PutUint32(buffer[idx:], uint32(m.Kills))
+	idx+=4
+	binary.LittleEndian.PutUint32(buffer[idx:], uint32(m.Deaths))
+	idx+=4
+	binary.LittleEndian.PutUint32(buffer[idx:], uint32(m.PeakLength))
+	idx+=4
+	binary.LittleEndian.PutUint32(buffer[idx:], uint32(m.FoodEaten))
+	idx+=4
+	binary.LittleEndian.PutUint32(buffer[idx:], uint32(m.TimeAlive))
+	idx+=4
+
+	_ = idx
+}
+
+func (m *PlayerStats) Deserialize(buffer []byte) error {
+	idx := 0
+	if len(buffer)-idx < 4 {
+		return ErrTruncated
+	}
+	l0_1 := int(binary.LittleEndian.Uint32(buffer[idx:]))
+	idx += 4
+	if l0_1 < 0 || len(buffer)-idx < l0_1 {
+		return ErrTruncated
+	}
+	m.Name = string(buffer[idx:idx+l0_1])
+	idx+=len(m.Name)
+	if len(buffer)-idx < 4 {
+		return ErrTruncated
+	}
+	m.GamesPlayed = binary.LittleEndian.Uint32(buffer[idx:])
+	idx+=4
+	if len(buffer)-idx < 4 {
+		return ErrTruncated
+	}
+	m.Kills = binary.LittleEndian.Uint32(buffer[idx:])
+	idx+=4
+	if len(buffer)-idx < 4 {
+		return ErrTruncated
+	}
+	m.Deaths = binary.LittleEndian.Uint32(buffer[idx:])
+	idx+=4
+	if len(buffer)-idx < 4 {
+		return ErrTruncated
+	}
+	m.PeakLength = binary.LittleEndian.Uint32(buffer[idx:])
+	idx+=4
+	if len(buffer)-idx < 4 {
+		return ErrTruncated
+	}
+	m.FoodEaten = binary.LittleEndian.Uint32(buffer[idx:])
+	idx+=4
+	if len(buffer)-idx < 4 {
+		return ErrTruncated
+	}
+	m.TimeAlive = binary.LittleEndian.Uint32(buffer[idx:])
+	idx+=4
+
+	_ = idx
+	return nil
+}
+
+func (m *PlayerStats) Len() int {
+	mylen := 0
+	mylen += 4 + len(m.Name)
+	mylen += 4
+	mylen += 4
+	mylen += 4
+	mylen += 4
+	mylen += 4
+	mylen += 4
+	return mylen
+}
+
+type TopPlayersReq struct {
+	Stat byte
+	Daily byte
+}
+
+func (m *TopPlayersReq) Serialize(buffer []byte) {
+	idx := 0
+	buffer[idx] = m.Stat
+	idx+=1
+	buffer[idx] = m.Daily
+	idx+=1
+
+	_ = idx
+}
+
+func (m *TopPlayersReq) Deserialize(buffer []byte) error {
+	idx := 0
+	if len(buffer)-idx < 1 {
+		return ErrTruncated
+	}
+	m.Stat = buffer[idx]
+
+	idx+=1
+	if len(buffer)-idx < 1 {
+		return ErrTruncated
+	}
+	m.Daily = buffer[idx]
+
+	idx+=1
+
+	_ = idx
+	return nil
+}
+
+func (m *TopPlayersReq) Len() int {
+	mylen := 0
+	mylen += 1
+	mylen += 1
+	return mylen
+}
+
+type TopPlayers struct {
+	Stat byte
+	Daily byte
+	Players []*PlayerStats
+}
+
+func (m *TopPlayers) Serialize(buffer []byte) {
+	idx := 0
+	buffer[idx] = m.Stat
+	idx+=1
+	buffer[idx] = m.Daily
+	idx+=1
+	binary.LittleEndian.PutUint32(buffer[idx:], uint32(len(m.Players)))
+	idx += 4
+	for _, v2 := range m.Players {
+		v2.Serialize(buffer[idx:])
+		idx+=v2.Len()
+	}
+
+	_ = idx
+}
+
+func (m *TopPlayers) Deserialize(buffer []byte) error {
+	idx := 0
+	if len(buffer)-idx < 1 {
+		return ErrTruncated
+	}
+	m.Stat = buffer[idx]
+
+	idx+=1
+	if len(buffer)-idx < 1 {
+		return ErrTruncated
+	}
+	m.Daily = buffer[idx]
+
+	idx+=1
+	if len(buffer)-idx < 4 {
+		return ErrTruncated
+	}
+	l2_1 := int(binary.LittleEndian.Uint32(buffer[idx:]))
+	idx += 4
+	if l2_1 < 0 || len(buffer)-idx < l2_1 {
+		return ErrTruncated
+	}
+	m.Players = make([]*PlayerStats, l2_1)
+	for i := 0; i < int(l2_1); i++ {
+		m.Players[i] = new(PlayerStats)
+		if err := m.Players[i].Deserialize(buffer[idx:]); err != nil {
+			return err
+		}
+		idx+=m.Players[i].Len()
+	}
+
+	_ = idx
+	return nil
+}
+
+func (m *TopPlayers) Len() int {
+	mylen := 0
+	mylen += 1
+	mylen += 1
+	mylen += 4
+	for _, v2 := range m.Players {
+	_ = v2
+		mylen += v2.Len()
+	}
+
+	return mylen
+}
+
+type LeaderboardEntry struct {
+	SnakeID uint32
+	Name string
+	Size int32
+}
+
+func (m *LeaderboardEntry) Serialize(buffer []byte) {
+	idx := 0
+	binary.LittleEndian.PutUint32(buffer[idx:], uint32(m.SnakeID))
+	idx+=4
+	binary.LittleEndian.PutUint32(buffer[idx:], uint32(len(m.Name)))
+	idx += 4
+	copy(buffer[idx:], []byte(m.Name))
+	idx+=len(m.Name)
+	binary.LittleEndian.PutUint32(buffer[idx:], uint32(m.Size))
+	idx+=4
+
+	_ = idx
+}
+
+func (m *LeaderboardEntry) Deserialize(buffer []byte) error {
+	idx := 0
+	if len(buffer)-idx < 4 {
+		return ErrTruncated
+	}
+	m.SnakeID = binary.LittleEndian.Uint32(buffer[idx:])
+	idx+=4
+	if len(buffer)-idx < 4 {
+		return ErrTruncated
+	}
+	l1_1 := int(binary.LittleEndian.Uint32(buffer[idx:]))
+	idx += 4
+	if l1_1 < 0 || len(buffer)-idx < l1_1 {
+		return ErrTruncated
+	}
+	m.Name = string(buffer[idx:idx+l1_1])
+	idx+=len(m.Name)
+	if len(buffer)-idx < 4 {
+		return ErrTruncated
+	}
+	m.Size = int32(binary.LittleEndian.Uint32(buffer[idx:]))
+	idx+=4
+
+	_ = idx
+	return nil
+}
+
+func (m *LeaderboardEntry) Len() int {
+	mylen := 0
+	mylen += 4
+	mylen += 4 + len(m.Name)
+	mylen += 4
+	return mylen
+}
+
+type Leaderboard struct {
+	Entries []*LeaderboardEntry
+	Rank uint32
+	Players uint32
+}
+
+func (m *Leaderboard) Serialize(buffer []byte) {
+	idx := 0
+	binary.LittleEndian.PutUint32(buffer[idx:], uint32(len(m.Entries)))
+	idx += 4
+	for _, v2 := range m.Entries {
+		v2.Serialize(buffer[idx:])
+		idx+=v2.Len()
+	}
+	binary.LittleEndian.PutUint32(buffer[idx:], uint32(m.Rank))
+	idx+=4
+	binary.LittleEndian.PutUint32(buffer[idx:], uint32(m.Players))
+	idx+=4
+
+	_ = idx
+}
+
+func (m *Leaderboard) Deserialize(buffer []byte) error {
+	idx := 0
+	if len(buffer)-idx < 4 {
+		return ErrTruncated
+	}
+	l0_1 := int(binary.LittleEndian.Uint32(buffer[idx:]))
+	idx += 4
+	if l0_1 < 0 || len(buffer)-idx < l0_1 {
+		return ErrTruncated
+	}
+	m.Entries = make([]*LeaderboardEntry, l0_1)
+	for i := 0; i < int(l0_1); i++ {
+		m.Entries[i] = new(LeaderboardEntry)
+		if err := m.Entries[i].Deserialize(buffer[idx:]); err != nil {
+			return err
+		}
+		idx+=m.Entries[i].Len()
+	}
+	if len(buffer)-idx < 4 {
+		return ErrTruncated
+	}
+	m.Rank = binary.LittleEndian.Uint32(buffer[idx:])
+	idx+=4
+	if len(buffer)-idx < 4 {
+		return ErrTruncated
+	}
+	m.Players = binary.LittleEndian.Uint32(buffer[idx:])
+	idx+=4
+
+	_ = idx
+	return nil
+}
+
+func (m *Leaderboard) Len() int {
+	mylen := 0
+	mylen += 4
+	for _, v2 := range m.Entries {
+	_ = v2
+		mylen += v2.Len()
+	}
+
+	mylen += 4
+	mylen += 4
+	return mylen
+}
+
+type MinimapSnake struct {
+	ID uint32
+	X int32
+	Y int32
+	Size int32
+}
+
+func (m *MinimapSnake) Serialize(buffer []byte) {
+	idx := 0
+	binary.LittleEndian.PutUint32(buffer[idx:], uint32(m.ID))
+	idx+=4
+	binary.LittleEndian.PutUint32(buffer[idx:], uint32(m.X))
+	idx+=4
+	binary.LittleEndian.PutUint32(buffer[idx:], uint32(m.Y))
+	idx+=4
+	binary.LittleEndian.PutUint32(buffer[idx:], uint32(m.Size))
+	idx+=4
+
+	_ = idx
+}
+
+func (m *MinimapSnake) Deserialize(buffer []byte) error {
+	idx := 0
+	if len(buffer)-idx < 4 {
+		return ErrTruncated
+	}
+	m.ID = binary.LittleEndian.Uint32(buffer[idx:])
+	idx+=4
+	if len(buffer)-idx < 4 {
+		return ErrTruncated
+	}
+	m.X = int32(binary.LittleEndian.Uint32(buffer[idx:]))
+	idx+=4
+	if len(buffer)-idx < 4 {
+		return ErrTruncated
+	}
+	m.Y = int32(binary.LittleEndian.Uint32(buffer[idx:]))
+	idx+=4
+	if len(buffer)-idx < 4 {
+		return ErrTruncated
+	}
+	m.Size = int32(binary.LittleEndian.Uint32(buffer[idx:]))
+	idx+=4
+
+	_ = idx
+	return nil
+}
+
+func (m *MinimapSnake) Len() int {
+	mylen := 0
+	mylen += 4
+	mylen += 4
+	mylen += 4
+	mylen += 4
+	return mylen
+}
+
+type Minimap struct {
+	Cells uint16
+	MapSize int32
+	Food []byte
+	Snakes []*MinimapSnake
+}
+
+func (m *Minimap) Serialize(buffer []byte) {
+	idx := 0
+	binary.LittleEndian.PutUint16(buffer[idx:], uint16(m.Cells))
+	idx+=2
+	binary.LittleEndian.PutUint32(buffer[idx:], uint32(m.MapSize))
+	idx+=4
+	binary.LittleEndian.PutUint32(buffer[idx:], uint32(len(m.Food)))
+	idx += 4
+	copy(buffer[idx:], m.Food)
+	idx+=len(m.Food)
+	binary.LittleEndian.PutUint32(buffer[idx:], uint32(len(m.Snakes)))
+	idx += 4
+	for _, v2 := range m.Snakes {
+		v2.Serialize(buffer[idx:])
+		idx+=v2.Len()
+	}
+
+	_ = idx
+}
+
+func (m *Minimap) Deserialize(buffer []byte) error {
+	idx := 0
+	if len(buffer)-idx < 2 {
+		return ErrTruncated
+	}
+	m.Cells = binary.LittleEndian.Uint16(buffer[idx:])
+	idx+=2
+	if len(buffer)-idx < 4 {
+		return ErrTruncated
+	}
+	m.MapSize = int32(binary.LittleEndian.Uint32(buffer[idx:]))
+	idx+=4
+	if len(buffer)-idx < 4 {
+		return ErrTruncated
+	}
+	l2_1 := int(binary.LittleEndian.Uint32(buffer[idx:]))
+	idx += 4
+	if l2_1 < 0 || len(buffer)-idx < l2_1 {
+		return ErrTruncated
+	}
+	m.Food = make([]byte, l2_1)
+	for i := 0; i < int(l2_1); i++ {
+		if len(buffer)-idx < 1 {
+			return ErrTruncated
+		}
+		m.Food[i] = buffer[idx]
+
+		idx+=1
+	}
+	if len(buffer)-idx < 4 {
+		return ErrTruncated
+	}
+	l3_1 := int(binary.LittleEndian.Uint32(buffer[idx:]))
+	idx += 4
+	if l3_1 < 0 || len(buffer)-idx < l3_1 {
+		return ErrTruncated
+	}
+	m.Snakes = make([]*MinimapSnake, l3_1)
+	for i := 0; i < int(l3_1); i++ {
+		m.Snakes[i] = new(MinimapSnake)
+		if err := m.Snakes[i].Deserialize(buffer[idx:]); err != nil {
+			return err
+		}
+		idx+=m.Snakes[i].Len()
+	}
+
+	_ = idx
+	return nil
+}
+
+func (m *Minimap) Len() int {
+	mylen := 0
+	mylen += 2
+	mylen += 4
+	mylen += 4 + len(m.Food)
+	mylen += 4
+	for _, v2 := range m.Snakes {
+	_ = v2
+		mylen += v2.Len()
+	}
+
+	return mylen
+}
+
+type ChatSend struct {
+	Channel byte
+	Text string
+}
+
+func (m *ChatSend) Serialize(buffer []byte) {
+	idx := 0
+	buffer[idx] = m.Channel
+	idx+=1
+	binary.LittleEndian.PutUint32(buffer[idx:], uint32(len(m.Text)))
+	idx += 4
+	copy(buffer[idx:], []byte(m.Text))
+	idx+=len(m.Text)
+
+	_ = idx
+}
+
+func (m *ChatSend) Deserialize(buffer []byte) error {
+	idx := 0
+	if len(buffer)-idx < 1 {
+		return ErrTruncated
+	}
+	m.Channel = buffer[idx]
+
+	idx+=1
+	if len(buffer)-idx < 4 {
+		return ErrTruncated
+	}
+	l1_1 := int(binary.LittleEndian.Uint32(buffer[idx:]))
+	idx += 4
+	if l1_1 < 0 || len(buffer)-idx < l1_1 {
+		return ErrTruncated
+	}
+	m.Text = string(buffer[idx:idx+l1_1])
+	idx+=len(m.Text)
+
+	_ = idx
+	return nil
+}
+
+func (m *ChatSend) Len() int {
+	mylen := 0
+	mylen += 1
+	mylen += 4 + len(m.Text)
+	return mylen
+}
+
+type Chat struct {
+	Channel byte
+	From string
+	SnakeID uint32
+	Text string
+}
+
+func (m *Chat) Serialize(buffer []byte) {
+	idx := 0
+	buffer[idx] = m.Channel
+	idx+=1
+	binary.LittleEndian.PutUint32(buffer[idx:], uint32(len(m.From)))
+	idx += 4
+	copy(buffer[idx:], []byte(m.From))
+	idx+=len(m.From)
+	binary.LittleEndian.PutUint32(buffer[idx:], uint32(m.SnakeID))
+	idx+=4
+	binary.LittleEndian.PutUint32(buffer[idx:], uint32(len(m.Text)))
+	idx += 4
+	copy(buffer[idx:], []byte(m.Text))
+	idx+=len(m.Text)
+
+	_ = idx
+}
+
+func (m *Chat) Deserialize(buffer []byte) error {
+	idx := 0
+	if len(buffer)-idx < 1 {
+		return ErrTruncated
+	}
+	m.Channel = buffer[idx]
+
+	idx+=1
+	if len(buffer)-idx < 4 {
+		return ErrTruncated
+	}
+	l1_1 := int(binary.LittleEndian.Uint32(buffer[idx:]))
+	idx += 4
+	if l1_1 < 0 || len(buffer)-idx < l1_1 {
+		return ErrTruncated
+	}
+	m.From = string(buffer[idx:idx+l1_1])
+	idx+=len(m.From)
+	if len(buffer)-idx < 4 {
+		return ErrTruncated
+	}
+	m.SnakeID = binary.LittleEndian.Uint32(buffer[idx:])
+	idx+=4
+	if len(buffer)-idx < 4 {
+		return ErrTruncated
+	}
+	l3_1 := int(binary.LittleEndian.Uint32(buffer[idx:]))
+	idx += 4
+	if l3_1 < 0 || len(buffer)-idx < l3_1 {
+		return ErrTruncated
+	}
+	m.Text = string(buffer[idx:idx+l3_1])
+	idx+=len(m.Text)
+
+	_ = idx
+	return nil
+}
+
+func (m *Chat) Len() int {
+	mylen := 0
+	mylen += 1
+	mylen += 4 + len(m.From)
+	mylen += 4
+	mylen += 4 + len(m.Text)
+	return mylen
+}
+
+type ChatMuted struct {
+	Seconds uint32
+	Reason string
+}
+
+func (m *ChatMuted) Serialize(buffer []byte) {
+	idx := 0
+	binary.LittleEndian.PutUint32(buffer[idx:], uint32(m.Seconds))
+	idx+=4
+	binary.LittleEndian.PutUint32(buffer[idx:], uint32(len(m.Reason)))
+	idx += 4
+	copy(buffer[idx:], []byte(m.Reason))
+	idx+=len(m.Reason)
+
+	_ = idx
+}
+
+func (m *ChatMuted) Deserialize(buffer []byte) error {
+	idx := 0
+	if len(buffer)-idx < 4 {
+		return ErrTruncated
+	}
+	m.Seconds = binary.LittleEndian.Uint32(buffer[idx:])
+	idx+=4
+	if len(buffer)-idx < 4 {
+		return ErrTruncated
+	}
+	l1_1 := int(binary.LittleEndian.Uint32(buffer[idx:]))
+	idx += 4
+	if l1_1 < 0 || len(buffer)-idx < l1_1 {
+		return ErrTruncated
+	}
+	m.Reason = string(buffer[idx:idx+l1_1])
+	idx+=len(m.Reason)
+
+	_ = idx
+	return nil
+}
+
+func (m *ChatMuted) Len() int {
+	mylen := 0
+	mylen += 4
+	mylen += 4 + len(m.Reason)
+	return mylen
+}
+
+type Spectate struct {
+	SnakeID uint32
+}
+
+func (m *Spectate) Serialize(buffer []byte) {
+	idx := 0
+	binary.LittleEndian.PutUint32(buffer[idx:], uint32(m.SnakeID))
+	idx+=4
+
+	_ = idx
+}
+
+func (m *Spectate) Deserialize(buffer []byte) error {
+	idx := 0
+	if len(buffer)-idx < 4 {
+		return ErrTruncated
+	}
+	m.SnakeID = binary.LittleEndian.Uint32(buffer[idx:])
+	idx+=4
+
+	_ = idx
+	return nil
+}
+
+func (m *Spectate) Len() int {
+	mylen := 0
+	mylen += 4
+	return mylen
+}
+
+type Spectating struct {
+	SnakeID uint32
+}
+
+func (m *Spectating) Serialize(buffer []byte) {
+	idx := 0
+	binary.LittleEndian.PutUint32(buffer[idx:], uint32(m.SnakeID))
+	idx+=4
+
+	_ = idx
+}
+
+func (m *Spectating) Deserialize(buffer []byte) error {
+	idx := 0
+	if len(buffer)-idx < 4 {
+		return ErrTruncated
+	}
+	m.SnakeID = binary.LittleEndian.Uint32(buffer[idx:])
+	idx+=4
+
+	_ = idx
+	return nil
+}
+
+func (m *Spectating) Len() int {
+	mylen := 0
+	mylen += 4
+	return mylen
+}
+
+type AreaFood struct {
+	Food []*Entity
+}
+
+func (m *AreaFood) Serialize(buffer []byte) {
+	idx := 0
+	binary.LittleEndian.PutUint32(buffer[idx:], uint32(len(m.Food)))
+	idx += 4
+	for _, v2 := range m.Food {
+		v2.Serialize(buffer[idx:])
+		idx+=v2.Len()
+	}
+
+	_ = idx
+}
+
+func (m *AreaFood) Deserialize(buffer []byte) error {
+	idx := 0
+	if len(buffer)-idx < 4 {
+		return ErrTruncated
+	}
+	l0_1 := int(binary.LittleEndian.Uint32(buffer[idx:]))
+	idx += 4
+	if l0_1 < 0 || len(buffer)-idx < l0_1 {
+		return ErrTruncated
+	}
+	m.Food = make([]*Entity, l0_1)
+	for i := 0; i < int(l0_1); i++ {
+		m.Food[i] = new(Entity)
+		if err := m.Food[i].Deserialize(buffer[idx:]); err != nil {
+			return err
+		}
+		idx+=m.Food[i].Len()
+	}
+
+	_ = idx
+	return nil
+}
+
+func (m *AreaFood) Len() int {
+	mylen := 0
+	mylen += 4
+	for _, v2 := range m.Food {
+	_ = v2
+		mylen += v2.Len()
+	}
+
+	return mylen
+}
+
+type A struct {
+	Name string
+	BirthDay int64
+	Phone string
+	Siblings int32
+	Spouse byte
+	Money float64
+}
+
+func (m *A) Serialize(buffer []byte) {
+	idx := 0
+	binary.LittleEndian.PutUint32(buffer[idx:], uint32(len(m.Name)))
+	idx += 4
+	copy(buffer[idx:], []byte(m.Name))
+	idx+=len(m.Name)
+	binary.LittleEndian.PutUint64(buffer[idx:], uint64(m.BirthDay))
+	idx+=8
+	binary.LittleEndian.PutUint32(buffer[idx:], uint32(len(m.Phone)))
+	idx += 4
+	copy(buffer[idx:], []byte(m.Phone))
+	idx+=len(m.Phone)
+	binary.LittleEndian.PutUint32(buffer[idx:], uint32(m.Siblings))
+	idx+=4
+	buffer[idx] = m.Spouse
+	idx+=1
+	binary.LittleEndian.PutUint64(buffer[idx:], math.Float64bits(m.Money))
+	idx+=8
+
+	_ = idx
+}
+
+func (m *A) Deserialize(buffer []byte) error {
+	idx := 0
+	if len(buffer)-idx < 4 {
+		return ErrTruncated
+	}
+	l0_1 := int(binary.LittleEndian.Uint32(buffer[idx:]))
+	idx += 4
+	if l0_1 < 0 || len(buffer)-idx < l0_1 {
+		return ErrTruncated
+	}
+	m.Name = string(buffer[idx:idx+l0_1])
+	idx+=len(m.Name)
+	if len(buffer)-idx < 8 {
+		return ErrTruncated
+	}
+	m.BirthDay = int64(binary.LittleEndian.Uint64(buffer[idx:]))
+	idx+=8
+	if len(buffer)-idx < 4 {
+		return ErrTruncated
+	}
+	l2_1 := int(binary.LittleEndian.Uint32(buffer[idx:]))
+	idx += 4
+	if l2_1 < 0 || len(buffer)-idx < l2_1 {
+		return ErrTruncated
+	}
+	m.Phone = string(buffer[idx:idx+l2_1])
+	idx+=len(m.Phone)
+	if len(buffer)-idx < 4 {
+		return ErrTruncated
+	}
+	m.Siblings = int32(binary.LittleEndian.Uint32(buffer[idx:]))
+	idx+=4
+	if len(buffer)-idx < 1 {
+		return ErrTruncated
+	}
+	m.Spouse = buffer[idx]
+
+	idx+=1
+	if len(buffer)-idx < 8 {
+		return ErrTruncated
+	}
 	m.Money = math.Float64frombits(binary.LittleEndian.Uint64(buffer[idx:]))
 	idx+=8
 
 	_ = idx
+	return nil
 }
 
 func (m *A) Len() int {
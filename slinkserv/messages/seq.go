@@ -0,0 +1,37 @@
+package messages
+
+// SeqTracker estimates packet loss from the Seq numbers of the packets that arrive.
+// A jump forward counts the skipped numbers as lost and a packet arriving late takes one back off.
+// Heartbeat.Received and Heartbeat.Lost are filled in from it when a client answers a heartbeat.
+type SeqTracker struct {
+	started  bool
+	last     uint16
+	Received uint32
+	Lost     uint32
+}
+
+// Track records a packet with the given Seq.
+func (st *SeqTracker) Track(seq uint16) {
+	st.Received++
+	if !st.started {
+		st.started = true
+		st.last = seq
+		return
+	}
+	diff := int16(seq - st.last)
+	if diff > 0 {
+		st.Lost += uint32(diff - 1)
+		st.last = seq
+	} else if st.Lost > 0 {
+		st.Lost--
+	}
+}
+
+// LossRate returns the fraction of packets lost so far.
+func (st *SeqTracker) LossRate() float64 {
+	total := st.Received + st.Lost
+	if total == 0 {
+		return 0
+	}
+	return float64(st.Lost) / float64(total)
+}
@@ -0,0 +1,13 @@
+package messages
+
+import "testing"
+
+func TestSeqTrackerWraps(t *testing.T) {
+	var st SeqTracker
+	for _, seq := range []uint16{65534, 65535, 1} {
+		st.Track(seq)
+	}
+	if st.Received != 3 || st.Lost != 1 {
+		t.Fatalf("Expected 3 received and 1 lost across the wrap, got %d and %d", st.Received, st.Lost)
+	}
+}
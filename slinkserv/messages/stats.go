@@ -0,0 +1,10 @@
+package messages
+
+// Values of TopPlayersReq.Stat, what players are ranked by.
+const (
+	StatPeakLength  byte = iota // Largest size a snake reached.
+	StatKills                   // Snakes that ran into this player's.
+	StatFoodEaten               // Food eaten.
+	StatTimeAlive               // Seconds spent alive.
+	StatGamesPlayed             // Games joined.
+)
@@ -0,0 +1,72 @@
+package slinkserv
+
+import (
+	"github.com/lologarithm/slink/slinkserv/messages"
+	"github.com/lologarithm/survival/physics/quadtree"
+)
+
+// The minimap splits the playable map into a minimapCells by minimapCells grid.
+// It is small enough to always fit in one datagram and is sent every minimapTicks.
+const (
+	minimapCells  = 16
+	minimapSnakes = 10
+	minimapTicks  = 100
+)
+
+// Minimap builds a coarse picture of the world: how much food is in each cell of the grid,
+// scaled so the fullest cell is 255, and where the biggest snakes are.
+// Cells run along X first, starting from the lowest X and Y.
+func (gw *GameWorld) Minimap() *messages.Minimap {
+	mm := &messages.Minimap{
+		Cells:   minimapCells,
+		MapSize: MapInternalSize,
+		Food:    make([]byte, minimapCells*minimapCells),
+	}
+	counts := make([]int, len(mm.Food))
+	most := 0
+	cell := int32(2 * MapInternalSize / minimapCells)
+	for y := int32(0); y < minimapCells; y++ {
+		for x := int32(0); x < minimapCells; x++ {
+			box := quadtree.BoundingBox{
+				MinX: -MapInternalSize + x*cell,
+				MinY: -MapInternalSize + y*cell,
+			}
+			box.MaxX, box.MaxY = box.MinX+cell, box.MinY+cell
+			idx := y*minimapCells + x
+			for _, b := range gw.Tree.Query(box) {
+				// Food on a cell edge is found by both cells, only count it where its center is.
+				e := b.(*Entity)
+				if e.EType == ETypeFood && e.Position.X >= box.MinX && e.Position.X < box.MaxX &&
+					e.Position.Y >= box.MinY && e.Position.Y < box.MaxY {
+					counts[idx]++
+				}
+			}
+			if counts[idx] > most {
+				most = counts[idx]
+			}
+		}
+	}
+	if most > 0 {
+		for i, c := range counts {
+			mm.Food[i] = byte(c * 255 / most)
+		}
+	}
+	snakes := gw.snakesBySize()
+	if len(snakes) > minimapSnakes {
+		snakes = snakes[:minimapSnakes]
+	}
+	mm.Snakes = make([]*messages.MinimapSnake, len(snakes))
+	for i, s := range snakes {
+		mm.Snakes[i] = &messages.MinimapSnake{ID: s.ID, X: s.Position.X, Y: s.Position.Y, Size: s.Size}
+	}
+	return mm
+}
+
+// sendMinimap sends the same minimap to every player. It is replaced every few seconds
+// so it goes out as cosmetic.
+func (g *GameSession) sendMinimap() {
+	if len(g.Clients)+len(g.Spectators) == 0 {
+		return
+	}
+	g.sendToAll(NewOutgoingMsg(nil, messages.MinimapMsgType, g.World.Minimap()))
+}
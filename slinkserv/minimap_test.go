@@ -0,0 +1,37 @@
+package slinkserv
+
+import (
+	"testing"
+
+	"github.com/lologarithm/slink/slinkserv/messages"
+	"github.com/lologarithm/survival/physics"
+)
+
+func TestMinimap(t *testing.T) {
+	g := NewGame(make(chan GameMessage, 100))
+	cell := int32(2 * MapInternalSize / minimapCells)
+	// Two food in the lowest corner cell, one in the cell to its right, and one on the edge between them.
+	for i, pos := range []physics.Vect2{
+		{X: -MapInternalSize + 10, Y: -MapInternalSize + 10},
+		{X: -MapInternalSize + 20, Y: -MapInternalSize + 20},
+		{X: -MapInternalSize + cell + 10, Y: -MapInternalSize + 10},
+		{X: -MapInternalSize + cell, Y: -MapInternalSize + 50},
+	} {
+		g.addEntity(uint32(1000+i), ETypeFood, pos, 50)
+	}
+	for i := uint32(0); i < minimapSnakes+2; i++ {
+		g.addSnake(i*20+1, "snake")
+		g.World.Snakes[i*20+1].Size = int32(300 + i)
+	}
+
+	mm := g.World.Minimap()
+	if mm.Food[0] != 255 || mm.Food[1] != 255 || mm.Food[minimapCells] != 0 {
+		t.Fatalf("Expected the first two cells to be full, got %v", mm.Food[:2])
+	}
+	if len(mm.Snakes) != minimapSnakes || mm.Snakes[0].Size != 300+minimapSnakes+1 {
+		t.Fatalf("Expected the %d biggest snakes, biggest first.", minimapSnakes)
+	}
+	if size := mm.Len() + messages.FrameLen; size > defaultPacketSize {
+		t.Fatalf("Minimap is %d bytes, doesn't fit in a %d byte datagram.", size, defaultPacketSize)
+	}
+}
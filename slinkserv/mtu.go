@@ -0,0 +1,136 @@
+package slinkserv
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/lologarithm/slink/slinkserv/messages"
+)
+
+// probeTries is how many probes of a size go unanswered before we decide it is too big.
+const probeTries = 2
+
+// probeInterval is how long a probe has to be answered before the next one is sent.
+const probeInterval = 250 * time.Millisecond
+
+// mtuProber binary searches for the largest datagram that makes it to a client.
+// Probes are sent from the client's heartbeat goroutine and acks arrive in ProcessBytes.
+type mtuProber struct {
+	mu       sync.Mutex
+	min, max int // Configured range, min is assumed to always work.
+	low      int // Largest size known to get through.
+	high     int // Largest size that might still get through.
+	probing  int // Size of the outstanding probe, 0 if there isn't one.
+	tries    int
+}
+
+func newMTUProber(min, max int) *mtuProber {
+	p := &mtuProber{min: min, max: max}
+	p.reset()
+	return p
+}
+
+// reset starts the search over, used when the client's address changes.
+func (p *mtuProber) reset() {
+	p.mu.Lock()
+	p.low, p.high = p.min, p.max
+	p.probing, p.tries = 0, 0
+	p.mu.Unlock()
+}
+
+// next returns the size of the next probe to send, or 0 if the search is finished.
+// It is called once per probe interval so an outstanding probe that hasn't been acked counts as lost.
+func (p *mtuProber) next() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.probing != 0 && p.tries >= probeTries {
+		p.high = p.probing - 1
+		p.probing, p.tries = 0, 0
+	}
+	if p.low >= p.high {
+		return 0
+	}
+	if p.probing == 0 {
+		p.probing = p.low + (p.high-p.low+1)/2
+	}
+	p.tries++
+	return p.probing
+}
+
+// ack records that a probe made it through. Returns the new largest size known to work
+// and true if it went up.
+func (p *mtuProber) ack(size int) (int, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if size <= p.low || size > p.high {
+		return p.low, false
+	}
+	p.low = size
+	if size == p.probing {
+		p.probing, p.tries = 0, 0
+	}
+	return p.low, true
+}
+
+// PacketSize returns the largest datagram the server will send this client.
+func (client *Client) PacketSize() int {
+	if size := atomic.LoadInt64(&client.packetSize); size > 0 {
+		return int(size)
+	}
+	return defaultPacketSize
+}
+
+func (client *Client) setPacketSize(size int) {
+	atomic.StoreInt64(&client.packetSize, int64(size))
+}
+
+// restartProbing drops the client back to the smallest packet size and searches again.
+func (client *Client) restartProbing() {
+	if client.mtu == nil {
+		return
+	}
+	client.mtu.reset()
+	client.setPacketSize(client.mtu.min)
+}
+
+// sendProbe queues the next MTU probe for the client, if there is one.
+func (client *Client) sendProbe() {
+	if client.mtu == nil {
+		return
+	}
+	size := client.mtu.next()
+	if size == 0 {
+		return
+	}
+	msg := NewOutgoingMsg(client, messages.MTUProbeMsgType, &messages.MTUProbe{Size: uint16(size)})
+	msg.probe = size
+	msg.priority = PriorityCosmetic
+	client.queue(msg)
+}
+
+// probeAcked raises the client's packet size after it answered a probe.
+func (client *Client) probeAcked(ack *messages.MTUProbeAck) {
+	if client.mtu == nil {
+		return
+	}
+	if size, ok := client.mtu.ack(int(ack.Size)); ok {
+		client.setPacketSize(size)
+	}
+}
+
+// probePacket builds a probe padded so the datagram carrying it, sealed or not, is exactly size bytes.
+// Returns nil if size is too small to hold a probe at all.
+func probePacket(msg OutgoingMessage, sc *messages.SessionCipher) []byte {
+	padding := msg.probe - messages.FrameLen - (&messages.MTUProbe{}).Len()
+	if sc != nil {
+		padding -= messages.EncryptionOverhead
+	}
+	if padding < 0 {
+		return nil
+	}
+	probe := msg.msg.NetMsg.(*messages.MTUProbe)
+	probe.Padding = make([]byte, padding)
+	msg.msg.Frame.ContentLength = uint16(probe.Len())
+	return msg.msg.Pack()
+}
@@ -0,0 +1,51 @@
+package slinkserv
+
+import (
+	"testing"
+
+	"github.com/lologarithm/slink/slinkserv/messages"
+)
+
+func TestMTUProber(t *testing.T) {
+	// Pretend the path drops anything over 1000 bytes.
+	const pathMTU = 1000
+	p := newMTUProber(512, 1400)
+	known := 512
+	for i := 0; i < 100; i++ {
+		size := p.next()
+		if size == 0 {
+			break
+		}
+		if size <= pathMTU {
+			known, _ = p.ack(size)
+		}
+	}
+	if p.next() != 0 {
+		t.Fatalf("Probing should have finished.")
+	}
+	if known != pathMTU {
+		t.Fatalf("Expected to find packet size %d, got %d", pathMTU, known)
+	}
+
+	p.reset()
+	if size := p.next(); size <= 512 || size > 1400 {
+		t.Fatalf("Reset should start probing over, got probe size %d", size)
+	}
+}
+
+func TestProbePacketSize(t *testing.T) {
+	client := &Client{}
+	msg := NewOutgoingMsg(client, messages.MTUProbeMsgType, &messages.MTUProbe{Size: 900})
+	msg.probe = 900
+	if n := len(probePacket(msg, nil)); n != 900 {
+		t.Fatalf("Expected a 900 byte probe, got %d", n)
+	}
+	sc, err := messages.NewSessionCipher(make([]byte, 32), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg.msg.NetMsg = &messages.MTUProbe{Size: 900}
+	if n := len(sc.Seal(probePacket(msg, sc))); n != 900 {
+		t.Fatalf("Expected a 900 byte sealed probe, got %d", n)
+	}
+}
@@ -0,0 +1,88 @@
+package slinkserv
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Limits on player names.
+const (
+	minNameLen  = 3
+	maxNameLen  = 16
+	guestPrefix = "Guest"
+)
+
+// reservedNames can't be registered, checked without case. Names starting with
+// guestPrefix are also reserved so nobody can pass themselves off as a guest.
+var reservedNames = []string{"admin", "administrator", "moderator", "mod", "server", "system", "slink"}
+
+// leet maps digits players use in place of letters, so blocked words can't be dodged with them.
+var leet = strings.NewReplacer("0", "o", "1", "i", "3", "e", "4", "a", "5", "s", "7", "t", "8", "b", "_", "", "-", "")
+
+// nameFilter decides which names players can use.
+type nameFilter struct {
+	blocked []string // Lowercase words that can't appear anywhere in a name.
+}
+
+// loadNameFilter reads blocked words from path, one per line. Blank lines and lines starting
+// with # are skipped. An empty path gives a filter that only applies the built in rules.
+func loadNameFilter(path string) (*nameFilter, error) {
+	nf := &nameFilter{}
+	if path == "" {
+		return nf, nil
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		word := strings.ToLower(strings.TrimSpace(scanner.Text()))
+		if word == "" || strings.HasPrefix(word, "#") {
+			continue
+		}
+		nf.blocked = append(nf.blocked, word)
+	}
+	return nf, scanner.Err()
+}
+
+// check returns why name can't be used, or an empty string if it's fine.
+func (nf *nameFilter) check(name string) string {
+	if len(name) < minNameLen || len(name) > maxNameLen {
+		return fmt.Sprintf("Names must be %d to %d characters long.", minNameLen, maxNameLen)
+	}
+	for _, c := range name {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_' || c == '-') {
+			return "Names can only use letters, numbers, _ and -."
+		}
+	}
+	lower := strings.ToLower(name)
+	if strings.HasPrefix(lower, strings.ToLower(guestPrefix)) {
+		return "That name is reserved."
+	}
+	for _, r := range reservedNames {
+		if lower == r {
+			return "That name is reserved."
+		}
+	}
+	// Blocked words are matched anywhere in the name, with and without undoing number swaps.
+	plain := leet.Replace(lower)
+	for _, word := range nf.blocked {
+		if strings.Contains(lower, word) || strings.Contains(plain, word) {
+			return "That name isn't allowed."
+		}
+	}
+	return ""
+}
+
+// guestName makes up a name for a guest, one that no registered account can have.
+func guestName() string {
+	var b [4]byte
+	rand.Read(b[:])
+	return fmt.Sprintf("%s%06d", guestPrefix, binary.LittleEndian.Uint32(b[:])%1000000)
+}
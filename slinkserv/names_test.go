@@ -0,0 +1,89 @@
+package slinkserv
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/lologarithm/slink/slinkserv/messages"
+)
+
+func TestNameFilter(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "blocklist.txt")
+	os.WriteFile(path, []byte("# Words players can't use.\nbadword\n\n  Rude \n"), 0600)
+	nf, err := loadNameFilter(path)
+	if err != nil {
+		t.Fatalf("Failed to load blocklist: %s", err)
+	}
+	for name, ok := range map[string]bool{
+		"snake_eater-9":     true,
+		"ab":                false, // Too short.
+		"abcdefghijklmnopq": false, // Too long.
+		"snake eater":       false, // Spaces aren't allowed.
+		"snäke":             false,
+		"Admin":             false,
+		"guest123":          false,
+		"xXBADWORDXx":       false,
+		"b4dw0rd":           false, // Number swaps don't get around the blocklist.
+		"r_u_d_e":           false,
+		"ruler":             true,
+	} {
+		if reason := nf.check(name); (reason == "") != ok {
+			t.Fatalf("Expected %q allowed=%v, got reason %q", name, ok, reason)
+		}
+	}
+	if reason := nf.check(guestName()); reason == "" {
+		t.Fatalf("Guest names should be reserved.")
+	}
+}
+
+func TestGuestLogin(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.PasswordIterations = 1000
+	gm, clients := newTestManager(cfg, 2)
+	defer func() {
+		for _, g := range gm.Games {
+			g.Exit <- 1
+		}
+	}()
+	gm.Users[1].Account = nil
+	reply := func() messages.Net {
+		msg, ok := clients[1].out.pop()
+		if !ok {
+			t.Fatalf("No reply sent.")
+		}
+		return msg.msg.NetMsg
+	}
+
+	// Players have to log in before they can play.
+	gm.joinGame(GameMessage{client: clients[1], net: &messages.JoinGame{}})
+	if _, ok := reply().(*messages.JoinGameFailed); !ok || gm.Users[1].GameID != 0 {
+		t.Fatalf("Expected joining without logging in to fail.")
+	}
+
+	gm.createAccount(GameMessage{client: clients[1], net: &messages.CreateAcct{Name: "x", Password: "pass"}})
+	if resp := reply().(*messages.CreateAcctResp); resp.AccountID != 0 || resp.Reason == "" {
+		t.Fatalf("Expected a bad name to be refused with a reason, got %+v", resp)
+	}
+
+	gm.guestLogin(GameMessage{client: clients[1]})
+	lr := reply().(*messages.LoginResp)
+	if lr.Success != 1 || !strings.HasPrefix(lr.Name, guestPrefix) || len(lr.Token) == 0 {
+		t.Fatalf("Expected a guest login, got %+v", lr)
+	}
+	// Asking again, say because the reply was lost, gets the same guest back.
+	gm.guestLogin(GameMessage{client: clients[1]})
+	if again := reply().(*messages.LoginResp); again.Success != 1 || again.Name != lr.Name {
+		t.Fatalf("Expected the same guest login again, got %+v", again)
+	}
+	gm.joinGame(GameMessage{client: clients[1], net: &messages.JoinGame{}})
+	if gm.Users[1].GameID == 0 || !gm.guests[lr.Name] {
+		t.Fatalf("Expected the guest to join a game.")
+	}
+	// The name is free again once the guest leaves.
+	gm.handleDisconnect(GameMessage{client: clients[1]})
+	if gm.guests[lr.Name] {
+		t.Fatalf("Guest name still taken after leaving.")
+	}
+}
@@ -0,0 +1,229 @@
+package slinkserv
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/lologarithm/slink/slinkserv/messages"
+)
+
+// Priority classes for outgoing messages. A client's queue always sends everything
+// waiting in a higher class before anything in a lower one.
+type Priority byte
+
+const (
+	// PriorityControl is for connection and account messages the client can't do without.
+	// These are never dropped to make room, if the queue is full the new message is dropped.
+	PriorityControl Priority = iota
+	// PriorityState is for game state. Anything lost is fixed by the next master frame
+	// so when the queue is full the oldest message is dropped.
+	PriorityState
+	// PriorityCosmetic is for anything the client could live without, also drop oldest.
+	PriorityCosmetic
+
+	numPriorities
+)
+
+// priorityOf returns the default class for a message type.
+func priorityOf(mtype messages.MessageType) Priority {
+	switch mtype {
+	case messages.GameMasterFrameMsgType, messages.TurnSnakeMsgType,
+		messages.UpdateEntityMsgType, messages.RemoveEntityMsgType:
+		return PriorityState
+	case messages.LeaderboardMsgType, messages.MinimapMsgType:
+		return PriorityCosmetic
+	}
+	return PriorityControl
+}
+
+// OutQueueLimits is how many messages of each class a single client can have waiting to be sent.
+type OutQueueLimits struct {
+	Control  int
+	State    int
+	Cosmetic int
+}
+
+// DefaultOutQueueLimits holds a couple seconds of game state for a client that is falling behind.
+func DefaultOutQueueLimits() OutQueueLimits {
+	return OutQueueLimits{
+		Control:  64,
+		State:    256,
+		Cosmetic: 64,
+	}
+}
+
+// msgRing is a fixed size FIFO of outgoing messages.
+type msgRing struct {
+	msgs []OutgoingMessage
+	head int
+	n    int
+}
+
+func (r *msgRing) full() bool {
+	return r.n == len(r.msgs)
+}
+
+func (r *msgRing) push(msg OutgoingMessage) {
+	r.msgs[(r.head+r.n)%len(r.msgs)] = msg
+	r.n++
+}
+
+func (r *msgRing) pop() OutgoingMessage {
+	msg := r.msgs[r.head]
+	r.msgs[r.head] = OutgoingMessage{}
+	r.head = (r.head + 1) % len(r.msgs)
+	r.n--
+	return msg
+}
+
+// outQueue holds the messages waiting to be sent to one client.
+// Games and the GameManager push to it without ever blocking, the sender pool drains it.
+type outQueue struct {
+	client *Client
+	pool   *senderPool
+
+	mu        sync.Mutex
+	classes   [numPriorities]msgRing
+	scheduled bool // Set while the client is waiting in the pool or being drained by a sender.
+
+	dropped uint64 // Messages thrown away because the queue was full, use atomic.
+}
+
+func newOutQueue(client *Client, pool *senderPool, limits OutQueueLimits) *outQueue {
+	q := &outQueue{client: client, pool: pool}
+	for p, size := range [numPriorities]int{limits.Control, limits.State, limits.Cosmetic} {
+		if size < 1 {
+			size = 1
+		}
+		q.classes[p].msgs = make([]OutgoingMessage, size)
+	}
+	return q
+}
+
+// push queues a message and makes sure a sender will pick it up.
+// Returns false if the message had to be dropped.
+func (q *outQueue) push(msg OutgoingMessage) bool {
+	q.mu.Lock()
+	ring := &q.classes[msg.priority]
+	accepted := true
+	if ring.full() {
+		atomic.AddUint64(&q.dropped, 1)
+		if msg.priority == PriorityControl {
+			accepted = false
+		} else {
+			ring.pop()
+		}
+	}
+	if accepted {
+		ring.push(msg)
+	}
+	schedule := accepted && !q.scheduled
+	if schedule {
+		q.scheduled = true
+	}
+	q.mu.Unlock()
+
+	if schedule && q.pool != nil {
+		q.pool.ready(q)
+	}
+	return accepted
+}
+
+// pop returns the next message to send, highest priority first.
+func (q *outQueue) pop() (OutgoingMessage, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for p := range q.classes {
+		if q.classes[p].n > 0 {
+			return q.classes[p].pop(), true
+		}
+	}
+	return OutgoingMessage{}, false
+}
+
+// finish is called by a sender when it is done draining the queue.
+// Returns true if more messages showed up and the queue needs to be scheduled again.
+func (q *outQueue) finish() bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for p := range q.classes {
+		if q.classes[p].n > 0 {
+			return true
+		}
+	}
+	q.scheduled = false
+	return false
+}
+
+// senderPool hands client queues with waiting messages to a fixed number of sender goroutines.
+// A queue is only ever in the pool once, so a client's messages are always sent by one sender
+// at a time and its Seq, GroupID and session cipher don't need locking.
+// Queues are held for the flush interval after they become ready so messages queued together,
+// like a burst of spawns, can be packed into the same datagram.
+type senderPool struct {
+	mu     sync.Mutex
+	cond   *sync.Cond
+	queue  []pendingQueue
+	flush  time.Duration
+	closed bool
+}
+
+type pendingQueue struct {
+	q   *outQueue
+	due time.Time
+}
+
+func newSenderPool(flush time.Duration) *senderPool {
+	sp := &senderPool{flush: flush}
+	sp.cond = sync.NewCond(&sp.mu)
+	return sp
+}
+
+func (sp *senderPool) ready(q *outQueue) {
+	sp.mu.Lock()
+	if !sp.closed {
+		sp.queue = append(sp.queue, pendingQueue{q: q, due: time.Now().Add(sp.flush)})
+		sp.cond.Signal()
+	}
+	sp.mu.Unlock()
+}
+
+// next blocks until a queue is ready to send. Returns false once the pool is closed.
+func (sp *senderPool) next() (*outQueue, bool) {
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
+	for !sp.closed {
+		if len(sp.queue) == 0 {
+			sp.cond.Wait()
+			continue
+		}
+		// Queues are in the order they became ready so nothing behind the first is due any sooner.
+		// Senders wait for it without taking it, so a close or an earlier wake up isn't held up.
+		if wait := time.Until(sp.queue[0].due); wait > 0 {
+			timer := time.AfterFunc(wait, sp.wake)
+			sp.cond.Wait()
+			timer.Stop()
+			continue
+		}
+		pending := sp.queue[0]
+		sp.queue[0] = pendingQueue{}
+		sp.queue = sp.queue[1:]
+		return pending.q, true
+	}
+	return nil, false
+}
+
+// wake gets the senders to look at the pool again once the first queue is due.
+func (sp *senderPool) wake() {
+	sp.mu.Lock()
+	sp.cond.Broadcast()
+	sp.mu.Unlock()
+}
+
+func (sp *senderPool) close() {
+	sp.mu.Lock()
+	sp.closed = true
+	sp.cond.Broadcast()
+	sp.mu.Unlock()
+}
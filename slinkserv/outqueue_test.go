@@ -0,0 +1,96 @@
+package slinkserv
+
+import (
+	"testing"
+	"time"
+
+	"github.com/lologarithm/slink/slinkserv/messages"
+)
+
+func TestOutQueuePriorities(t *testing.T) {
+	client := &Client{}
+	client.out = newOutQueue(client, nil, OutQueueLimits{Control: 2, State: 2, Cosmetic: 2})
+
+	for tick := uint32(1); tick <= 3; tick++ {
+		if !client.send(messages.GameMasterFrameMsgType, &messages.GameMasterFrame{Tick: tick}) {
+			t.Fatalf("State messages should never be refused.")
+		}
+	}
+	client.send(messages.HeartbeatMsgType, &messages.Heartbeat{})
+	client.send(messages.HeartbeatMsgType, &messages.Heartbeat{})
+	if client.send(messages.HeartbeatMsgType, &messages.Heartbeat{}) {
+		t.Fatalf("Control message should be refused when its queue is full.")
+	}
+
+	expected := []messages.MessageType{messages.HeartbeatMsgType, messages.HeartbeatMsgType, messages.GameMasterFrameMsgType, messages.GameMasterFrameMsgType}
+	for i, mtype := range expected {
+		msg, ok := client.out.pop()
+		if !ok || msg.msg.Frame.MsgType != mtype {
+			t.Fatalf("Message %d: expected type %d, got %d", i, mtype, msg.msg.Frame.MsgType)
+		}
+		if msg.dest != client {
+			t.Fatalf("Queued message should be addressed to its client.")
+		}
+		if mtype == messages.GameMasterFrameMsgType && msg.msg.NetMsg.(*messages.GameMasterFrame).Tick == 1 {
+			t.Fatalf("Oldest state message should have been dropped.")
+		}
+	}
+	if _, ok := client.out.pop(); ok {
+		t.Fatalf("Queue should be empty.")
+	}
+	if client.out.dropped != 2 {
+		t.Fatalf("Expected 2 dropped messages, got %d", client.out.dropped)
+	}
+}
+
+func TestOutQueueSchedulesOnce(t *testing.T) {
+	pool := newSenderPool(0)
+	client := &Client{}
+	client.out = newOutQueue(client, pool, DefaultOutQueueLimits())
+
+	client.send(messages.HeartbeatMsgType, &messages.Heartbeat{})
+	client.send(messages.HeartbeatMsgType, &messages.Heartbeat{})
+	if len(pool.queue) != 1 {
+		t.Fatalf("Client should be in the pool once, found %d times.", len(pool.queue))
+	}
+	q, _ := pool.next()
+	q.pop()
+	if !q.finish() {
+		t.Fatalf("Queue with messages left should be scheduled again.")
+	}
+	q.pop()
+	if q.finish() {
+		t.Fatalf("Empty queue should not be scheduled again.")
+	}
+	client.send(messages.HeartbeatMsgType, &messages.Heartbeat{})
+	if len(pool.queue) != 1 {
+		t.Fatalf("Client should go back in the pool when new messages arrive.")
+	}
+	pool.close()
+	if _, ok := pool.next(); ok {
+		t.Fatalf("Closed pool should not hand out queues.")
+	}
+}
+
+func TestSenderPoolFlush(t *testing.T) {
+	flush := 50 * time.Millisecond
+	pool := newSenderPool(flush)
+	client := &Client{}
+	client.out = newOutQueue(client, pool, DefaultOutQueueLimits())
+
+	start := time.Now()
+	client.send(messages.HeartbeatMsgType, &messages.Heartbeat{})
+	if q, ok := pool.next(); !ok || q != client.out || time.Since(start) < flush {
+		t.Fatalf("Expected the queue once it had waited the flush interval.")
+	}
+
+	// Closing the pool doesn't wait for a queue that isn't due yet.
+	client.out.pop()
+	client.out.finish()
+	client.send(messages.HeartbeatMsgType, &messages.Heartbeat{})
+	time.AfterFunc(flush/5, pool.close)
+	start = time.Now()
+	if _, ok := pool.next(); ok || time.Since(start) >= flush {
+		t.Fatalf("Expected the closed pool to give up right away.")
+	}
+}
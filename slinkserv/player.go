@@ -1,16 +1,47 @@
 package slinkserv
 
+import (
+	"time"
+
+	"github.com/lologarithm/survival/physics"
+)
+
 // User maps a connection to a list of accounts
 type User struct {
 	Account *Account // List of authenticated accounts
 	Client  *Client  // Client connection
 	GameID  uint32   // Currently connected game ID
 	SnakeID uint32   // Current ID of users snake
+	Lost    bool     // Connection was lost, waiting for the client to resume its session.
+	Name    string   // Name shown in game.
+
+	Spectator bool   // Watching the game without a snake.
+	Watching  uint32 // Snake a spectator's camera follows, 0 if there are none.
+
+	mutedUntil time.Time     // Chat is dropped until then, only used by the game.
+	area       physics.Vect2 // Center of the area a spectator is sent food for, only used by the game.
+	hasArea    bool          // The spectator has been sent an area, so moving it only sends what's new.
 }
 
 // Account is a container for user storage and has a password for auth.
 type Account struct {
-	ID       uint32
-	Name     string
-	Password string
+	ID           uint32
+	Name         string
+	PasswordHash string // From hashPassword.
+	Password     string `json:",omitempty"` // Plaintext from before passwords were hashed, replaced on the next login.
+	Guest        bool   `json:"-"`          // Made up for a guest, never saved.
+
+	Stats Stats  // All time totals.
+	Today Stats  // Totals for Day only.
+	Day   string // UTC date Today is for, as 2006-01-02.
+}
+
+// Stats are a player's totals across every game they've played.
+type Stats struct {
+	GamesPlayed uint32
+	Kills       uint32
+	Deaths      uint32
+	PeakLength  uint32 // Largest size any of their snakes reached.
+	FoodEaten   uint32
+	TimeAlive   uint32 // Seconds.
 }
@@ -0,0 +1,220 @@
+package slinkserv
+
+import (
+	"time"
+
+	"github.com/lologarithm/slink/slinkserv/messages"
+)
+
+// RateLimit configures a token bucket. Rate tokens are added every second up to Burst.
+// A zero Rate disables the limit.
+type RateLimit struct {
+	Rate  float64
+	Burst float64
+}
+
+// RateLimits configures how much inbound traffic the server accepts and how it escalates
+// when a client goes over its limits.
+type RateLimits struct {
+	Global    RateLimit                          // All datagrams read by the server.
+	PerClient RateLimit                          // All packets from a single client.
+	PerType   map[messages.MessageType]RateLimit // Packets of a single type from a single client.
+
+	// Violations are counted per client over ViolationWindow.
+	// Every violation drops the packet, WarnAt sends the client a warning
+	// and DisconnectAt drops the client entirely.
+	ViolationWindow time.Duration
+	WarnAt          int
+	DisconnectAt    int
+
+	// An address that gets disconnected BanAfter times within BanTime is banned for BanTime.
+	BanAfter int
+	BanTime  time.Duration
+}
+
+// DefaultRateLimits are generous enough for a real player but stop a client from
+// flooding the game with turns or account requests.
+func DefaultRateLimits() RateLimits {
+	return RateLimits{
+		Global:    RateLimit{Rate: 20000, Burst: 40000},
+		PerClient: RateLimit{Rate: 60, Burst: 120},
+		PerType: map[messages.MessageType]RateLimit{
+			messages.TurnSnakeMsgType:     {Rate: 20, Burst: 40},
+			messages.HeartbeatMsgType:     {Rate: 5, Burst: 10},
+			messages.CreateAcctMsgType:    {Rate: 1, Burst: 5},
+			messages.LoginMsgType:         {Rate: 1, Burst: 5},
+			messages.GuestLoginMsgType:    {Rate: 1, Burst: 5},
+			messages.TopPlayersReqMsgType: {Rate: 1, Burst: 5},
+			messages.ChatSendMsgType:      {Rate: 1, Burst: 5},
+			messages.SpectateMsgType:      {Rate: 5, Burst: 10},
+			messages.JoinGameMsgType:      {Rate: 1, Burst: 5},
+		},
+		ViolationWindow: 10 * time.Second,
+		WarnAt:          10,
+		DisconnectAt:    100,
+		BanAfter:        3,
+		BanTime:         5 * time.Minute,
+	}
+}
+
+type tokenBucket struct {
+	limit  RateLimit
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(limit RateLimit, now time.Time) *tokenBucket {
+	return &tokenBucket{
+		limit:  limit,
+		tokens: limit.Burst,
+		last:   now,
+	}
+}
+
+// take removes a token from the bucket, returns false if there wasn't one.
+func (tb *tokenBucket) take(now time.Time) bool {
+	if tb.limit.Rate == 0 {
+		return true
+	}
+	tb.tokens += now.Sub(tb.last).Seconds() * tb.limit.Rate
+	if tb.tokens > tb.limit.Burst {
+		tb.tokens = tb.limit.Burst
+	}
+	tb.last = now
+	if tb.tokens < 1 {
+		return false
+	}
+	tb.tokens--
+	return true
+}
+
+type limitAction byte
+
+const (
+	limitAllow limitAction = iota
+	limitDrop
+	limitWarn
+	limitDisconnect
+)
+
+// clientLimiter tracks the buckets for a single client.
+// Only the client's ProcessBytes goroutine should use it.
+type clientLimiter struct {
+	limits      *RateLimits
+	total       *tokenBucket
+	byType      map[messages.MessageType]*tokenBucket
+	violations  int
+	windowStart time.Time
+}
+
+func newClientLimiter(limits *RateLimits, now time.Time) *clientLimiter {
+	cl := &clientLimiter{
+		limits:      limits,
+		total:       newTokenBucket(limits.PerClient, now),
+		byType:      make(map[messages.MessageType]*tokenBucket, len(limits.PerType)),
+		windowStart: now,
+	}
+	for mtype, limit := range limits.PerType {
+		cl.byType[mtype] = newTokenBucket(limit, now)
+	}
+	return cl
+}
+
+// check takes a token for a packet of the given type and returns what should be done with it.
+func (cl *clientLimiter) check(mtype messages.MessageType, now time.Time) limitAction {
+	allowed := cl.total.take(now)
+	if tb, ok := cl.byType[mtype]; ok && allowed {
+		allowed = tb.take(now)
+	}
+	if allowed {
+		return limitAllow
+	}
+
+	if now.Sub(cl.windowStart) > cl.limits.ViolationWindow {
+		cl.windowStart = now
+		cl.violations = 0
+	}
+	cl.violations++
+	switch {
+	case cl.limits.DisconnectAt > 0 && cl.violations >= cl.limits.DisconnectAt:
+		return limitDisconnect
+	case cl.violations == cl.limits.WarnAt:
+		return limitWarn
+	}
+	return limitDrop
+}
+
+type strike struct {
+	count int
+	last  time.Time
+}
+
+// banList tracks addresses that have been disconnected for going over their limits.
+// Only the server's network goroutine should use it.
+type banList struct {
+	limits  *RateLimits
+	bans    map[string]time.Time // Address -> time ban ends
+	strikes map[string]*strike
+	swept   time.Time // Last time old strikes and bans were cleared out.
+}
+
+func newBanList(limits *RateLimits) *banList {
+	return &banList{
+		limits:  limits,
+		bans:    map[string]time.Time{},
+		strikes: map[string]*strike{},
+	}
+}
+
+// banned returns true if the address is currently banned.
+func (bl *banList) banned(addr string, now time.Time) bool {
+	end, ok := bl.bans[addr]
+	if !ok {
+		return false
+	}
+	if now.After(end) {
+		delete(bl.bans, addr)
+		return false
+	}
+	return true
+}
+
+// strike records a rate limit disconnect against an address and returns true if it is now banned.
+func (bl *banList) strike(addr string, now time.Time) bool {
+	if bl.limits.BanAfter == 0 {
+		return false
+	}
+	bl.sweep(now)
+	s, ok := bl.strikes[addr]
+	if !ok || now.Sub(s.last) > bl.limits.BanTime {
+		s = &strike{}
+		bl.strikes[addr] = s
+	}
+	s.count++
+	s.last = now
+	if s.count < bl.limits.BanAfter {
+		return false
+	}
+	delete(bl.strikes, addr)
+	bl.bans[addr] = now.Add(bl.limits.BanTime)
+	return true
+}
+
+// sweep forgets strikes that are too old to count and bans that are over, so addresses that
+// never come back don't stay around forever. It only looks through them once per BanTime.
+func (bl *banList) sweep(now time.Time) {
+	if now.Sub(bl.swept) < bl.limits.BanTime {
+		return
+	}
+	bl.swept = now
+	for addr, s := range bl.strikes {
+		if now.Sub(s.last) > bl.limits.BanTime {
+			delete(bl.strikes, addr)
+		}
+	}
+	for addr, end := range bl.bans {
+		if now.After(end) {
+			delete(bl.bans, addr)
+		}
+	}
+}
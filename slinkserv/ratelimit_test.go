@@ -0,0 +1,73 @@
+package slinkserv
+
+import (
+	"testing"
+	"time"
+
+	"github.com/lologarithm/slink/slinkserv/messages"
+)
+
+func TestTokenBucket(t *testing.T) {
+	now := time.Now()
+	tb := newTokenBucket(RateLimit{Rate: 10, Burst: 5}, now)
+	for i := 0; i < 5; i++ {
+		if !tb.take(now) {
+			t.Fatalf("Bucket should allow the full burst, failed on %d.", i)
+		}
+	}
+	if tb.take(now) {
+		t.Fatalf("Bucket should be empty after burst.")
+	}
+	if !tb.take(now.Add(100 * time.Millisecond)) {
+		t.Fatalf("Bucket should refill at its rate.")
+	}
+	if !newTokenBucket(RateLimit{}, now).take(now) {
+		t.Fatalf("Zero rate should be unlimited.")
+	}
+}
+
+func TestClientLimiterEscalates(t *testing.T) {
+	limits := DefaultRateLimits()
+	limits.PerType[messages.TurnSnakeMsgType] = RateLimit{Rate: 1, Burst: 1}
+	limits.WarnAt = 2
+	limits.DisconnectAt = 4
+
+	now := time.Now()
+	cl := newClientLimiter(&limits, now)
+	expected := []limitAction{limitAllow, limitDrop, limitWarn, limitDrop, limitDisconnect}
+	for i, exp := range expected {
+		if action := cl.check(messages.TurnSnakeMsgType, now); action != exp {
+			t.Fatalf("Turn %d: expected action %d, got %d", i, exp, action)
+		}
+	}
+	if action := cl.check(messages.HeartbeatMsgType, now); action != limitAllow {
+		t.Fatalf("Other message types should have their own limit, got %d", action)
+	}
+}
+
+func TestBanList(t *testing.T) {
+	limits := DefaultRateLimits()
+	bl := newBanList(&limits)
+	now := time.Now()
+	for i := 1; i < limits.BanAfter; i++ {
+		if bl.strike("10.0.0.1", now) {
+			t.Fatalf("Should not ban after %d strikes.", i)
+		}
+	}
+	if !bl.strike("10.0.0.1", now) {
+		t.Fatalf("Should ban after %d strikes.", limits.BanAfter)
+	}
+	if !bl.banned("10.0.0.1", now) || bl.banned("10.0.0.2", now) {
+		t.Fatalf("Only the struck address should be banned.")
+	}
+	if bl.banned("10.0.0.1", now.Add(limits.BanTime+time.Second)) {
+		t.Fatalf("Ban should expire.")
+	}
+
+	// Strikes that are too old to count are forgotten, not kept forever.
+	bl.strike("10.0.0.2", now)
+	bl.strike("10.0.0.3", now.Add(limits.BanTime*2))
+	if _, ok := bl.strikes["10.0.0.2"]; ok || len(bl.strikes) != 1 {
+		t.Fatalf("Expected only the new strike to be kept, got %d.", len(bl.strikes))
+	}
+}
@@ -1,13 +1,18 @@
 package slinkserv
 
 import (
-	"crypto/rsa"
+	"crypto/hmac"
+	"encoding/binary"
+	"encoding/hex"
 	"fmt"
+	"io"
 	"log"
 	"net"
 	"os"
+	"sync/atomic"
 	"time"
 
+	"github.com/lologarithm/slink/slinkserv/capture"
 	"github.com/lologarithm/slink/slinkserv/messages"
 )
 
@@ -15,13 +20,80 @@ const (
 	port string = ":24816"
 )
 
+// Config holds the tunable settings for a Server.
+type Config struct {
+	Limits            RateLimits
+	SessionGrace      time.Duration // How long a client that stopped responding can resume its session.
+	ClientTimeout     time.Duration // Clients that send nothing for this long are dropped, or lost if they have a session.
+	RequireEncryption bool          // Refuse logins from clients that haven't set up an encrypted session.
+	OutQueue          OutQueueLimits
+	InQueue           int           // Datagrams from a client waiting to be processed, more than this are dropped.
+	Senders           int           // Number of goroutines writing queued messages to the socket.
+	FlushInterval     time.Duration // How long messages wait in a client's queue for others to share their datagram.
+
+	// Every client starts out with datagrams of MaxPacketSize, which should get through any network.
+	// The server then probes each client for the largest size up to MaxProbeSize that makes it
+	// through so clients on good networks get fewer fragments. Set MaxProbeSize to 0 to disable probing.
+	MaxPacketSize int
+	MaxProbeSize  int
+
+	CompressThreshold int // Packets bigger than this are deflated before sending, 0 disables compression.
+
+	CapturePath string // Record every datagram to this file, decode it with slinkcap. Empty disables capturing.
+
+	AccountsPath string // File accounts are saved to. Empty keeps them in memory, so they are lost on restart.
+
+	NameBlocklistPath string // Words that can't be used in names, one per line. Empty only applies the built in rules.
+
+	ServerKeyPath string // File the server's private key is kept in, created if missing. Empty uses a new key every start.
+
+	PasswordIterations int // PBKDF2 work factor for new password hashes, 0 uses the default.
+	Logins             LoginLimits
+
+	MaxPlayers      int           // Players per game, new games are started when they are all full. 0 for no limit.
+	GameIdleTimeout time.Duration // Games that have been empty this long are shut down, 0 keeps them forever.
+}
+
+// DefaultConfig returns the settings used by the server launcher.
+func DefaultConfig() Config {
+	return Config{
+		Limits:            DefaultRateLimits(),
+		SessionGrace:      30 * time.Second,
+		ClientTimeout:     5 * time.Second,
+		OutQueue:          DefaultOutQueueLimits(),
+		InQueue:           defaultInQueue,
+		Senders:           4,
+		FlushInterval:     2 * time.Millisecond,
+		MaxPacketSize:     defaultPacketSize,
+		MaxProbeSize:      1400,
+		CompressThreshold: 256,
+		MaxPlayers:        32,
+		GameIdleTimeout:   2 * time.Minute,
+		Logins:            DefaultLoginLimits(),
+	}
+}
+
 type Server struct {
 	conn             *net.UDPConn
-	disconnectPlayer chan Client
-	outToNetwork     chan OutgoingMessage
+	disconnectPlayer chan *Client
+	senders          *senderPool
+	outQueueLimits   OutQueueLimits
+	inQueueSize      int
+	numSenders       int
+	packetSize       int
+	maxProbeSize     int
+	compressAbove    int
+	compression      *compressionStats
+	capture          *capture.Writer // nil unless capturing.
 	toGameManager    chan GameMessage
 	inputBuffer      []byte
-	encryptionKey    *rsa.PrivateKey
+	encryptionKeys   *serverKeys
+	cookies          *cookieJar
+	limits           *RateLimits
+	globalLimit      *tokenBucket
+	bans             *banList
+	sessions         *sessionTable
+	clientTimeout    time.Duration
 
 	connections map[string]*Client
 	gameManager *GameManager
@@ -30,34 +102,139 @@ type Server struct {
 
 func (s *Server) handleMessage() {
 	// TODO: Add timeout on read to check for stale connections and add new user connections.
-	s.conn.SetReadDeadline(time.Now().Add(time.Second * 5))
+	// Reads give up as often as clients can time out, so stopped clients are noticed promptly.
+	s.conn.SetReadDeadline(time.Now().Add(s.clientTimeout))
 	n, addr, err := s.conn.ReadFromUDP(s.inputBuffer)
 
 	if err != nil {
 		return
 	}
+	now := time.Now().UTC()
+	if !s.globalLimit.take(now) || s.bans.banned(addr.IP.String(), now) {
+		return
+	}
 	addrkey := addr.String()
 	if n == 0 {
 		s.DisconnectConn(addrkey)
 	}
-	if _, ok := s.connections[addrkey]; !ok {
-		s.clientID++
-		// fmt.Printf("New Connection: %v, ID: %d\n", addrkey, s.clientID)
-		s.connections[addrkey] = &Client{
-			address:         addr,
-			FromNetwork:     NewBytePipe(0),
-			ToNetwork:       s.outToNetwork,
-			FromGameManager: make(chan InternalMessage, 10),
-			toGameManager:   s.toGameManager,
-			ID:              s.clientID,
+	client, ok := s.connections[addrkey]
+	if !ok {
+		s.record(capture.Inbound, 0, addr, s.inputBuffer[:n])
+		s.handshake(addr, s.inputBuffer[:n])
+		return
+	}
+	atomic.AddUint64(&client.stats.bytesIn, uint64(n))
+	data := s.inputBuffer[0:n]
+	if sc := client.sessionCipher(); sc != nil {
+		// Once a session is encrypted anything we can't open is dropped, including plaintext.
+		if data, ok = sc.Open(data); !ok {
+			return
 		}
-		go s.connections[addrkey].ProcessBytes(s.disconnectPlayer)
 	}
-	if s.connections[addrkey].FromNetwork.Write(s.inputBuffer[0:n]) == 0 {
+	s.record(capture.Inbound, client.ID, addr, data)
+	if err := client.FromNetwork.Push(data); err == io.ErrClosedPipe {
 		s.DisconnectConn(addrkey)
 	}
 }
 
+// handshake answers packets from addresses that don't have a Client yet.
+// Only a Connect echoing a valid cookie for the sender's address allocates a Client,
+// anything else gets at most a small challenge back so spoofed sources cost us nothing.
+func (s *Server) handshake(addr *net.UDPAddr, data []byte) {
+	packet, ok := messages.NextPacket(data)
+	if !ok || packet.Frame.MsgType != messages.ConnectMsgType {
+		return
+	}
+	now := time.Now().UTC()
+	connect := packet.NetMsg.(*messages.Connect)
+	if !s.cookies.valid(connect.Cookie, addr, now) {
+		challenge := messages.NewPacket(messages.ConnectChallengeMsgType, &messages.ConnectChallenge{
+			Cookie: s.cookies.issue(addr, now),
+		})
+		// Never answer with more bytes than we were sent or the challenge could be used to
+		// amplify traffic at a spoofed address. Clients pad their first Connect with a blank cookie.
+		if packet.Len() < challenge.Len() {
+			return
+		}
+		data := challenge.Pack()
+		s.record(capture.Outbound, 0, addr, data)
+		if n, err := s.conn.WriteToUDP(data, addr); err != nil {
+			fmt.Printf("Error writing challenge to %v: %s, Bytes Written:  %d", addr, err, n)
+		}
+		return
+	}
+	if len(connect.Token) > 0 && s.resumeSession(connect, addr, now) {
+		return
+	}
+
+	s.clientID++
+	// fmt.Printf("New Connection: %v, ID: %d\n", addr, s.clientID)
+	client := &Client{
+		address:         addr,
+		FromNetwork:     NewDatagramQueue(s.inQueueSize),
+		FromGameManager: make(chan InternalMessage, 10),
+		toGameManager:   s.toGameManager,
+		ID:              s.clientID,
+		limiter:         newClientLimiter(s.limits, now),
+		keys:            s.encryptionKeys,
+		timeout:         s.clientTimeout,
+	}
+	client.out = newOutQueue(client, s.senders, s.outQueueLimits)
+	client.setPacketSize(s.packetSize)
+	if s.maxProbeSize > s.packetSize {
+		client.mtu = newMTUProber(s.packetSize, s.maxProbeSize)
+	}
+	s.connections[addr.String()] = client
+	go client.ProcessBytes(s.disconnectPlayer)
+}
+
+// resumeSession moves the lost client owning token over to a new address, giving it a fresh
+// pipe and starting it back up. A client that is still connected is never taken over, so a
+// token can't be used to steal a session out from under a player.
+// An encrypted session also needs the Connect to carry proof of the old session key.
+// Returns false if there is no lost session to resume.
+func (s *Server) resumeSession(connect *messages.Connect, addr *net.UDPAddr, now time.Time) bool {
+	client := s.sessions.resume(connect.Token, now, func(c *Client) bool {
+		sc := c.sessionCipher()
+		// A session that was never encrypted only has its token to go on.
+		return sc == nil || hmac.Equal(sc.ResumeProof(connect.Cookie), connect.Proof)
+	})
+	if client == nil {
+		return false
+	}
+	log.Printf("Client %d resumed session from %v.", client.ID, addr)
+	client.setAddress(addr)
+	atomic.StoreInt32(&client.resumed, 1)
+	// The session key is exchanged again over the new connection.
+	client.setSessionCipher(nil)
+	s.connections[addr.String()] = client
+	client.FromNetwork = NewDatagramQueue(s.inQueueSize)
+	go client.ProcessBytes(s.disconnectPlayer)
+	return true
+}
+
+// clientStopped cleans up after a client's ProcessBytes exits and lets the GameManager know.
+// Clients that timed out but have a session are only marked lost so they can resume it.
+func (s *Server) clientStopped(client *Client) {
+	s.DisconnectConn(client.Address().String())
+	now := time.Now().UTC()
+	if client.rateLimited && s.bans.strike(client.Address().IP.String(), now) {
+		log.Printf("Banned %s for %s after repeatedly going over rate limits.", client.Address().IP, s.limits.BanTime)
+	}
+	lost := false
+	if client.quit || client.rateLimited {
+		s.sessions.remove(client.ID)
+	} else {
+		lost = s.sessions.lost(client.ID, now)
+	}
+	s.toGameManager <- GameMessage{
+		client: client,
+		net:    &messages.Disconnected{},
+		mtype:  messages.DisconnectedMsgType,
+		lost:   lost,
+	}
+}
+
 func (s *Server) DisconnectConn(addrkey string) {
 	// fmt.Printf("  Closing connection for client: %d.\n", s.connections[addrkey].ID)
 	if s.connections[addrkey] != nil && s.connections[addrkey].FromNetwork != nil {
@@ -66,68 +243,162 @@ func (s *Server) DisconnectConn(addrkey string) {
 	}
 }
 
-var maxPacketSize int = 512
+// defaultPacketSize is the largest datagram sent to a client before probing finds out it can take more.
+const defaultPacketSize = 512
 
+// sendMessages is run by each sender goroutine. It takes a client with queued messages
+// from the pool and sends a batch of them, packed into as few datagrams as possible,
+// before giving other clients a turn.
 func (s *Server) sendMessages() {
 	for {
-		msg, ok := <-s.outToNetwork
+		q, ok := s.senders.next()
 		if !ok {
 			fmt.Printf("Server Sender closed.\n")
 			return
 		}
-		msgcontent := msg.data
-		if len(msgcontent) == 0 {
-			msg.msg.Frame.Seq = msg.dest.Seq
-			msgcontent = msg.msg.Pack()
+		dg := &datagram{dest: q.client}
+		for i := 0; i < sendBatch; i++ {
+			msg, ok := q.pop()
+			if !ok {
+				break
+			}
+			s.sendMessage(dg, msg)
+		}
+		s.flush(dg)
+		if q.finish() {
+			s.senders.ready(q)
 		}
-		totallen := len(msgcontent)
-		if totallen > maxPacketSize {
-			// calculate how many parts we have to split this into
-			maxsize := maxPacketSize - (&messages.Multipart{}).Len() - messages.FrameLen
-			parts := totallen/maxsize + 1
-			msg.dest.GroupID++
-			bstart := 0
-			for i := 0; i < parts; i++ {
-				bend := bstart + maxsize
-				if i+1 == parts {
-					bend = bstart + (totallen % maxsize)
-				}
-				wrapper := &messages.Multipart{
-					ID:       uint16(i),
-					GroupID:  msg.dest.GroupID,
-					NumParts: uint16(parts),
-					Content:  msgcontent[bstart:bend],
-				}
-				packet := &messages.Packet{
-					Frame: messages.Frame{
-						MsgType:       messages.MultipartMsgType,
-						Seq:           msg.dest.Seq,
-						ContentLength: uint16(wrapper.Len()),
-					},
-					NetMsg: wrapper,
-				}
-				msg.dest.Seq++
-				bstart = bend
-				if n, err := s.conn.WriteToUDP(packet.Pack(), msg.dest.address); err != nil {
-					fmt.Printf("Error writing to client(%v): %s, Bytes Written:  %d", msg.dest, err, n)
-				}
+	}
+}
+
+// sendBatch is how many messages a sender writes for one client before moving on to the next.
+const sendBatch = 64
+
+// datagram collects packets for one client so they can go out in a single write.
+type datagram struct {
+	dest *Client
+	sc   *messages.SessionCipher
+	buf  []byte
+}
+
+func (s *Server) sendMessage(dg *datagram, msg OutgoingMessage) {
+	if sc := msg.dest.sessionCipher(); sc != dg.sc {
+		// Encryption started part way through the batch, don't mix plaintext in with sealed packets.
+		s.flush(dg)
+		dg.sc = sc
+	}
+	msg.msg.Frame.Seq = msg.dest.Seq
+	if msg.probe > 0 {
+		// Probes have to arrive as a datagram of exactly their size so they always go alone.
+		s.flush(dg)
+		if dg.buf = probePacket(msg, dg.sc); dg.buf != nil {
+			msg.dest.Seq++
+			s.flush(dg)
+		}
+		return
+	}
+	msgcontent := msg.data
+	if len(msgcontent) == 0 {
+		msgcontent = msg.msg.Pack()
+	} else {
+		// Shared with every other client this was sent to, copy it to stamp our Seq.
+		msgcontent = append([]byte(nil), msgcontent...)
+		binary.LittleEndian.PutUint16(msgcontent[2:], msg.dest.Seq)
+	}
+	if s.compressAbove > 0 && len(msgcontent) > s.compressAbove {
+		// Compress before fragmenting so big frames need fewer parts.
+		if compressed, ok := messages.Compress(msgcontent); ok {
+			s.compression.add(len(msgcontent), len(compressed))
+			msgcontent = compressed
+		}
+	}
+	packetSize := msg.dest.PacketSize()
+	if dg.sc != nil {
+		packetSize -= messages.EncryptionOverhead
+	}
+	totallen := len(msgcontent)
+	if totallen > packetSize {
+		// calculate how many parts we have to split this into
+		maxsize := packetSize - (&messages.Multipart{}).Len() - messages.FrameLen
+		parts := totallen/maxsize + 1
+		msg.dest.GroupID++
+		bstart := 0
+		for i := 0; i < parts; i++ {
+			bend := bstart + maxsize
+			if i+1 == parts {
+				bend = bstart + (totallen % maxsize)
 			}
-		} else {
-			if n, err := s.conn.WriteToUDP(msgcontent, msg.dest.address); err != nil {
-				fmt.Printf("Error writing to client(%v): %s, Bytes Written:  %d", msg.dest, err, n)
-			} else {
-				// log.Printf("Wrote message (%v) with %d bytes to %v.", msg.msg.Pack(), n, msg.dest.address)
+			wrapper := &messages.Multipart{
+				ID:       uint16(i),
+				GroupID:  msg.dest.GroupID,
+				NumParts: uint16(parts),
+				Content:  msgcontent[bstart:bend],
+			}
+			packet := &messages.Packet{
+				Frame: messages.Frame{
+					MsgType:       messages.MultipartMsgType,
+					Seq:           msg.dest.Seq,
+					ContentLength: uint16(wrapper.Len()),
+				},
+				NetMsg: wrapper,
 			}
 			msg.dest.Seq++
+			bstart = bend
+			atomic.AddUint64(&msg.dest.stats.fragmentsOut, 1)
+			s.appendPacket(dg, packet.Pack(), packetSize)
 		}
+	} else {
+		s.appendPacket(dg, msgcontent, packetSize)
+		msg.dest.Seq++
+	}
+}
+
+// appendPacket adds a packet to the datagram, sending what is already there first if it wouldn't fit.
+func (s *Server) appendPacket(dg *datagram, packet []byte, packetSize int) {
+	if len(dg.buf)+len(packet) > packetSize {
+		s.flush(dg)
+	}
+	dg.buf = append(dg.buf, packet...)
+}
+
+// flush sends whatever is in the datagram, sealing it first if the session is encrypted.
+func (s *Server) flush(dg *datagram) {
+	if len(dg.buf) == 0 {
+		return
+	}
+	addr := dg.dest.Address()
+	s.record(capture.Outbound, dg.dest.ID, addr, dg.buf)
+	data := dg.buf
+	if dg.sc != nil {
+		data = dg.sc.Seal(data)
 	}
+	if n, err := s.conn.WriteToUDP(data, addr); err != nil {
+		fmt.Printf("Error writing to client(%v): %s, Bytes Written:  %d", dg.dest, err, n)
+	}
+	atomic.AddUint64(&dg.dest.stats.bytesOut, uint64(len(data)))
+	dg.buf = dg.buf[:0]
 }
 
-func NewServer(exit chan int) Server {
+func NewServer(exit chan int, cfg Config) Server {
 	toGameManager := make(chan GameMessage, 1024)
-	outToNetwork := make(chan OutgoingMessage, 1024)
 
-	manager := NewGameManager(exit, toGameManager, outToNetwork)
+	sessions := newSessionTable(cfg.SessionGrace)
+	var accounts AccountStore = NewMemoryStore()
+	if cfg.AccountsPath != "" {
+		store, err := OpenFileStore(cfg.AccountsPath)
+		if err != nil {
+			log.Printf("Failed to open account store: %s", err)
+			os.Exit(1)
+		}
+		accounts = store
+	}
+	names, err := loadNameFilter(cfg.NameBlocklistPath)
+	if err != nil {
+		log.Printf("Failed to load name blocklist: %s", err)
+		os.Exit(1)
+	}
+	manager := NewGameManager(exit, toGameManager, sessions, accounts, cfg)
+	manager.names = names
 	go manager.Run()
 
 	udpAddr, err := net.ResolveUDPAddr("udp", port)
@@ -139,10 +410,36 @@ func NewServer(exit chan int) Server {
 
 	var s Server
 	s.connections = make(map[string]*Client, 512)
-	s.inputBuffer = make([]byte, 8092)
+	s.inputBuffer = make([]byte, maxDatagram)
 	s.toGameManager = toGameManager
-	s.outToNetwork = outToNetwork
-	s.disconnectPlayer = make(chan Client, 512)
+	s.senders = newSenderPool(cfg.FlushInterval)
+	s.outQueueLimits = cfg.OutQueue
+	s.inQueueSize = cfg.InQueue
+	s.numSenders = cfg.Senders
+	s.packetSize = cfg.MaxPacketSize
+	s.maxProbeSize = cfg.MaxProbeSize
+	s.compressAbove = cfg.CompressThreshold
+	s.compression = &compressionStats{}
+	s.disconnectPlayer = make(chan *Client, 512)
+	s.cookies = newCookieJar()
+	s.limits = &cfg.Limits
+	s.globalLimit = newTokenBucket(cfg.Limits.Global, time.Now().UTC())
+	s.bans = newBanList(s.limits)
+	s.sessions = sessions
+	s.clientTimeout = cfg.ClientTimeout
+	s.gameManager = manager
+	if s.encryptionKeys, err = loadServerKeys(cfg.ServerKeyPath, cfg.RequireEncryption); err != nil {
+		log.Printf("Failed to load server key: %s", err)
+		os.Exit(1)
+	}
+	fmt.Println("Server public key:", hex.EncodeToString(s.encryptionKeys.public))
+	if cfg.CapturePath != "" {
+		if s.capture, err = capture.Create(cfg.CapturePath); err != nil {
+			log.Printf("Failed to create capture file: %s", err)
+			os.Exit(1)
+		}
+		fmt.Println("Capturing datagrams to", cfg.CapturePath)
+	}
 	s.conn, err = net.ListenUDP("udp", udpAddr)
 	if err != nil {
 		log.Printf("Failed to open UDP port: %s", err)
@@ -153,7 +450,9 @@ func NewServer(exit chan int) Server {
 }
 
 func RunServer(s Server, exit chan int, complete chan int) {
-	go s.sendMessages()
+	for i := 0; i < s.numSenders; i++ {
+		go s.sendMessages()
+	}
 	fmt.Println("Server Started!")
 
 	run := true
@@ -161,11 +460,17 @@ func RunServer(s Server, exit chan int, complete chan int) {
 		select {
 		case <-exit:
 			fmt.Println("Killing Socket Server")
+			if stats := s.CompressionStats(); stats.Packets > 0 {
+				fmt.Printf("Compressed %d packets, saved %d of %d bytes.\n", stats.Packets, stats.BytesIn-stats.BytesOut, stats.BytesIn)
+			}
 			s.conn.Close()
-			close(s.outToNetwork)
+			s.senders.close()
+			if s.capture != nil {
+				s.capture.Close()
+			}
 			run = false
 		case client := <-s.disconnectPlayer:
-			s.DisconnectConn(client.address.String())
+			s.clientStopped(client)
 		default:
 			s.handleMessage()
 		}
@@ -173,8 +478,52 @@ func RunServer(s Server, exit chan int, complete chan int) {
 	complete <- 1
 }
 
+// record adds a plaintext datagram to the capture, if there is one.
+func (s *Server) record(dir capture.Direction, clientID uint32, addr *net.UDPAddr, data []byte) {
+	if s.capture == nil {
+		return
+	}
+	rec := capture.Record{Time: time.Now().UTC(), ClientID: clientID, Dir: dir, Addr: addr.String(), Data: data}
+	if err := s.capture.Write(rec); err != nil {
+		log.Printf("Failed to write capture, capturing stopped: %s", err)
+	}
+}
+
+// GameManager returns the manager running the server's games, for admin commands like muting players.
+func (s *Server) GameManager() *GameManager {
+	return s.gameManager
+}
+
+// CompressionStats shows how much sending compressed packets has saved.
+type CompressionStats struct {
+	Packets  uint64 // Packets that were sent compressed.
+	BytesIn  uint64 // Size of those packets before compression.
+	BytesOut uint64 // Size of those packets after compression.
+}
+
+type compressionStats struct {
+	packets, in, out uint64
+}
+
+func (cs *compressionStats) add(in, out int) {
+	atomic.AddUint64(&cs.packets, 1)
+	atomic.AddUint64(&cs.in, uint64(in))
+	atomic.AddUint64(&cs.out, uint64(out))
+}
+
+// CompressionStats returns the totals for every packet the server has compressed so far.
+func (s *Server) CompressionStats() CompressionStats {
+	return CompressionStats{
+		Packets:  atomic.LoadUint64(&s.compression.packets),
+		BytesIn:  atomic.LoadUint64(&s.compression.in),
+		BytesOut: atomic.LoadUint64(&s.compression.out),
+	}
+}
+
 type OutgoingMessage struct {
-	dest *Client
-	msg  messages.Packet
-	data []byte
+	dest     *Client
+	msg      messages.Packet
+	data     []byte
+	priority Priority
+	probe    int // Set on MTU probes, the size the datagram carrying it must be padded to.
 }
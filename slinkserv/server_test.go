@@ -1,18 +1,28 @@
 package slinkserv
 
 import (
+	"bytes"
 	"fmt"
 	"net"
+	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
 	"github.com/lologarithm/slink/slinkserv/messages"
 )
 
+// testConfig is the default config with cheap password hashing so logins are quick.
+func testConfig() Config {
+	cfg := DefaultConfig()
+	cfg.PasswordIterations = 1000
+	return cfg
+}
+
 func TestBasicServer(t *testing.T) {
 	exit := make(chan int, 10)
 	complete := make(chan int, 1)
-	s := NewServer(exit)
+	s := NewServer(exit, testConfig())
 	go RunServer(s, exit, complete)
 
 	time.Sleep(time.Millisecond * 100)
@@ -26,28 +36,21 @@ func TestBasicServer(t *testing.T) {
 		fmt.Println(err)
 		t.FailNow()
 	}
+	connect(t, conn, nil)
 	packet := messages.NewPacket(messages.LoginMsgType, &messages.Login{
 		Name:     "testuser",
 		Password: "testpass",
 	})
-	msgBytes := packet.Pack()
-	_, err = conn.Write(msgBytes)
+	_, err = conn.Write(packet.Pack())
 	if err != nil {
 		fmt.Printf("Failed to write to connection.")
 		fmt.Println(err)
 		t.FailNow()
 	}
-	buf := make([]byte, 512)
-	n, err := conn.Read(buf[0:])
-	if err != nil {
-		fmt.Printf("Failed to read from conn.")
-		fmt.Println(err)
-		t.FailNow()
-	}
-	if n < 5 || buf[0] != byte(messages.LoginRespMsgType) {
-		fmt.Printf("buffer: %d\n", buf[:128])
-		fmt.Printf("Incorrect response message! Expected: %d, Actual: %d\n", byte(messages.LoginRespMsgType), buf[0])
-		t.FailNow()
+	// The password is checked off the manager so other messages may arrive first.
+	lr := readPacket(t, conn, messages.LoginRespMsgType).NetMsg.(*messages.LoginResp)
+	if lr.Success != 0 || lr.Reason != messages.LoginBadCredentials {
+		t.Fatalf("Expected login to an unknown account to fail, got %+v", lr)
 	}
 	packet = messages.NewPacket(messages.DisconnectedMsgType, &messages.Disconnected{})
 	conn.Write(packet.Pack())
@@ -59,16 +62,299 @@ func TestBasicServer(t *testing.T) {
 	fmt.Printf("TestBasicServer complete.\n")
 }
 
+// connect runs the cookie handshake on conn and fails the test if the server never confirms it.
+// Passing a session token resumes that session instead of creating a new client.
+func connect(t *testing.T, conn *net.UDPConn, token []byte) *messages.Connected {
+	return connectProof(t, conn, token, nil)
+}
+
+// connectProof is connect with proof of the old session key, if there is one, for resuming an encrypted session.
+func connectProof(t *testing.T, conn *net.UDPConn, token []byte, old *messages.SessionCipher) *messages.Connected {
+	buf := make([]byte, 512)
+	cookie := make([]byte, cookieLen)
+	for attempt := 0; attempt < 5; attempt++ {
+		connect := &messages.Connect{Cookie: cookie, Token: token}
+		if old != nil {
+			connect.Proof = old.ResumeProof(cookie)
+		}
+		conn.Write(messages.NewPacket(messages.ConnectMsgType, connect).Pack())
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+		n, err := conn.Read(buf)
+		if err != nil {
+			continue
+		}
+		if resp, ok := findPacket(buf[:n], messages.ConnectedMsgType); ok {
+			conn.SetReadDeadline(time.Time{})
+			return resp.NetMsg.(*messages.Connected)
+		}
+		if resp, ok := findPacket(buf[:n], messages.ConnectChallengeMsgType); ok {
+			cookie = resp.NetMsg.(*messages.ConnectChallenge).Cookie
+		}
+	}
+	t.Fatalf("Server never completed the handshake.")
+	return nil
+}
+
+func TestHandshakeIgnoresUnknownAddress(t *testing.T) {
+	exit := make(chan int, 10)
+	complete := make(chan int, 1)
+	s := NewServer(exit, testConfig())
+	go RunServer(s, exit, complete)
+
+	time.Sleep(time.Millisecond * 100)
+	ra, err := net.ResolveUDPAddr("udp", "localhost:24816")
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn, err := net.DialUDP("udp", nil, ra)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Login before connecting should be dropped, and an unpadded Connect gets no challenge.
+	for _, packet := range []*messages.Packet{
+		messages.NewPacket(messages.LoginMsgType, &messages.Login{Name: "testuser", Password: "testpass"}),
+		messages.NewPacket(messages.ConnectMsgType, &messages.Connect{}),
+	} {
+		conn.Write(packet.Pack())
+	}
+	buf := make([]byte, 512)
+	conn.SetReadDeadline(time.Now().Add(time.Millisecond * 200))
+	if n, err := conn.Read(buf); err == nil {
+		t.Fatalf("Expected no response before handshake, got %d bytes: %v", n, buf[:n])
+	}
+	for i := 0; i < 10; i++ {
+		exit <- 1
+	}
+	conn.Write(messages.NewPacket(messages.ConnectMsgType, &messages.Connect{}).Pack()) // wake up the reader
+	conn.Close()
+	<-complete
+}
+
+// readPacket reads packets off conn until one of the given type shows up.
+func readPacket(t *testing.T, conn *net.UDPConn, mtype messages.MessageType) messages.Packet {
+	buf := make([]byte, 8092)
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	defer conn.SetReadDeadline(time.Time{})
+	for {
+		n, err := conn.Read(buf)
+		if err != nil {
+			t.Fatalf("Never got message type %d: %s", mtype, err)
+		}
+		if packet, ok := findPacket(buf[:n], mtype); ok {
+			return packet
+		}
+	}
+}
+
+// findPacket returns the first packet of the given type in a datagram.
+func findPacket(datagram []byte, mtype messages.MessageType) (messages.Packet, bool) {
+	for len(datagram) > 0 {
+		packet, ok := messages.NextPacket(datagram)
+		if !ok {
+			break
+		}
+		if packet.Frame.MsgType == mtype {
+			return packet, true
+		}
+		datagram = datagram[packet.Len():]
+	}
+	return messages.Packet{}, false
+}
+
+func TestSessionResume(t *testing.T) {
+	exit := make(chan int, 10)
+	complete := make(chan int, 1)
+	cfg := testConfig()
+	cfg.ClientTimeout = time.Second
+	s := NewServer(exit, cfg)
+	go RunServer(s, exit, complete)
+
+	time.Sleep(time.Millisecond * 100)
+	ra, err := net.ResolveUDPAddr("udp", "localhost:24816")
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldconn, err := net.DialUDP("udp", nil, ra)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if connect(t, oldconn, nil).Resumed != 0 {
+		t.Fatalf("Expected a new connection not to be marked resumed.")
+	}
+	oldconn.Write(messages.NewPacket(messages.CreateAcctMsgType, &messages.CreateAcct{
+		Name:     "resumeuser",
+		Password: "testpass",
+	}).Pack())
+	resp := readPacket(t, oldconn, messages.CreateAcctRespMsgType).NetMsg.(*messages.CreateAcctResp)
+	if len(resp.Token) == 0 {
+		t.Fatalf("Expected a session token with the new account.")
+	}
+
+	// Another address can't take the session while its owner is still connected.
+	thief, err := net.DialUDP("udp", nil, ra)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if connect(t, thief, resp.Token).Resumed != 0 {
+		t.Fatalf("A live session should not be handed to a second address.")
+	}
+	thief.Write(messages.NewPacket(messages.DisconnectedMsgType, &messages.Disconnected{}).Pack())
+	thief.Close()
+	oldconn.Write(messages.NewPacket(messages.LoginMsgType, &messages.Login{
+		Name:     "resumeuser",
+		Password: "testpass",
+	}).Pack())
+	// Logging in again hands out a new token.
+	token := readPacket(t, oldconn, messages.LoginRespMsgType).NetMsg.(*messages.LoginResp).Token
+
+	// Go quiet until the server gives up on the old connection.
+	time.Sleep(cfg.ClientTimeout * 3)
+
+	// Same session from a new address, responses should follow us there.
+	newconn, err := net.DialUDP("udp", nil, ra)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if connect(t, newconn, token).Resumed != 1 {
+		t.Fatalf("Expected the client to be told it got its session back.")
+	}
+	newconn.Write(messages.NewPacket(messages.LoginMsgType, &messages.Login{
+		Name:     "resumeuser",
+		Password: "testpass",
+	}).Pack())
+	lr := readPacket(t, newconn, messages.LoginRespMsgType).NetMsg.(*messages.LoginResp)
+	if lr.AccountID != resp.AccountID {
+		t.Fatalf("Resumed session should still be able to log in, got account %d", lr.AccountID)
+	}
+
+	newconn.Write(messages.NewPacket(messages.DisconnectedMsgType, &messages.Disconnected{}).Pack())
+	for i := 0; i < 10; i++ {
+		exit <- 1
+	}
+	oldconn.Close()
+	newconn.Close()
+	<-complete
+}
+
+func TestEncryptedSession(t *testing.T) {
+	exit := make(chan int, 10)
+	complete := make(chan int, 1)
+	cfg := testConfig()
+	cfg.RequireEncryption = true
+	cfg.ClientTimeout = time.Second
+	s := NewServer(exit, cfg)
+	go RunServer(s, exit, complete)
+
+	time.Sleep(time.Millisecond * 100)
+	ra, err := net.ResolveUDPAddr("udp", "localhost:24816")
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn, err := net.DialUDP("udp", nil, ra)
+	if err != nil {
+		t.Fatal(err)
+	}
+	connect(t, conn, nil)
+	login := messages.NewPacket(messages.LoginMsgType, &messages.Login{Name: "cryptuser", Password: "testpass"})
+	conn.Write(login.Pack())
+	readPacket(t, conn, messages.WarningMsgType)
+
+	key, clientPublic, err := messages.NewSessionKey(s.encryptionKeys.public)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sc, err := messages.NewSessionCipher(key, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.Write(messages.NewPacket(messages.SessionKeyMsgType, &messages.SessionKey{Key: clientPublic}).Pack())
+	readSealed(t, conn, sc, messages.SessionKeyAckMsgType)
+
+	// Plaintext is ignored once the session is encrypted.
+	conn.Write(login.Pack())
+	conn.Write(sc.Seal(login.Pack()))
+	readSealed(t, conn, sc, messages.LoginRespMsgType)
+	conn.Write(sc.Seal(messages.NewPacket(messages.CreateAcctMsgType, &messages.CreateAcct{Name: "cryptuser", Password: "testpass"}).Pack()))
+	token := readSealed(t, conn, sc, messages.CreateAcctRespMsgType).NetMsg.(*messages.CreateAcctResp).Token
+
+	// Once the connection is lost the token, which goes out in the clear, isn't enough to resume it.
+	time.Sleep(cfg.ClientTimeout * 3)
+	thief, err := net.DialUDP("udp", nil, ra)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if connect(t, thief, token).Resumed != 0 {
+		t.Fatalf("An encrypted session should not resume without proof of its key.")
+	}
+	thief.Close()
+	newconn, err := net.DialUDP("udp", nil, ra)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if connectProof(t, newconn, token, sc).Resumed != 1 {
+		t.Fatalf("Expected the session to resume with proof of its key.")
+	}
+
+	newconn.Write(messages.NewPacket(messages.DisconnectedMsgType, &messages.Disconnected{}).Pack())
+	for i := 0; i < 10; i++ {
+		exit <- 1
+	}
+	conn.Close()
+	newconn.Close()
+	<-complete
+}
+
+func TestServerKeyFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "server.key")
+	first, err := loadServerKeys(path, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, err := loadServerKeys(path, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(first.public, again.public) {
+		t.Fatalf("Expected the saved key to be used again after a restart.")
+	}
+	os.WriteFile(path, []byte("not a key"), 0600)
+	if _, err := loadServerKeys(path, true); err == nil {
+		t.Fatalf("Expected a bad key file to be refused.")
+	}
+}
+
+// readSealed reads datagrams off conn, opening them with sc, until a packet of the given type shows up.
+func readSealed(t *testing.T, conn *net.UDPConn, sc *messages.SessionCipher, mtype messages.MessageType) messages.Packet {
+	buf := make([]byte, 8092)
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	defer conn.SetReadDeadline(time.Time{})
+	for {
+		n, err := conn.Read(buf)
+		if err != nil {
+			t.Fatalf("Never got sealed message type %d: %s", mtype, err)
+		}
+		plain, ok := sc.Open(buf[:n])
+		if !ok {
+			continue
+		}
+		if packet, ok := findPacket(plain, mtype); ok {
+			return packet
+		}
+	}
+}
+
 func BenchmarkServerParsing(b *testing.B) {
 	gamechan := make(chan GameMessage, 100)
-	donechan := make(chan Client, 1)
+	donechan := make(chan *Client, 1)
 	fakeClient := &Client{
 		address:         &net.UDPAddr{},
-		FromNetwork:     NewBytePipe(0),
+		FromNetwork:     NewDatagramQueue(0),
 		FromGameManager: make(chan InternalMessage, 10),
 		toGameManager:   gamechan,
 		ID:              1,
 	}
+	fakeClient.out = newOutQueue(fakeClient, nil, DefaultOutQueueLimits())
 	go fakeClient.ProcessBytes(donechan)
 
 	packet := messages.NewPacket(messages.LoginMsgType, &messages.Login{
@@ -81,7 +367,7 @@ func BenchmarkServerParsing(b *testing.B) {
 	b.ResetTimer()
 	t := 0
 	for i := 0; i < b.N; i++ {
-		fakeClient.FromNetwork.Write(msgBytes)
+		fakeClient.FromNetwork.Push(msgBytes)
 		<-gamechan
 		t += len(msgBytes)
 	}
@@ -91,11 +377,13 @@ func BenchmarkServerParsing(b *testing.B) {
 }
 
 func TestMultipartMessage(t *testing.T) {
-	maxPacketSize = 256 // shrink max size to make test work
-
 	exit := make(chan int, 10)
 	complete := make(chan int, 1)
-	s := NewServer(exit)
+	cfg := testConfig()
+	cfg.MaxPacketSize = 256 // shrink max size to make test work
+	cfg.MaxProbeSize = 0
+	cfg.CompressThreshold = 0
+	s := NewServer(exit, cfg)
 	go RunServer(s, exit, complete)
 
 	time.Sleep(time.Millisecond * 100)
@@ -111,6 +399,7 @@ func TestMultipartMessage(t *testing.T) {
 		t.FailNow()
 		return
 	}
+	connect(t, clientconn, nil)
 
 	packet := messages.NewPacket(messages.CreateAcctMsgType, &messages.CreateAcct{
 		Name:     "testuser",
@@ -165,7 +454,6 @@ func TestMultipartMessage(t *testing.T) {
 			}
 		}
 	}
-	maxPacketSize = 512
 	packet = messages.NewPacket(messages.DisconnectedMsgType, &messages.Disconnected{})
 	clientconn.Write(packet.Pack())
 	for i := 0; i < 10; i++ {
@@ -175,3 +463,68 @@ func TestMultipartMessage(t *testing.T) {
 	<-complete
 
 }
+
+func TestCoalescedDatagrams(t *testing.T) {
+	var s Server
+	var err error
+	s.conn, err = net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.conn.Close()
+	recv, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer recv.Close()
+
+	client := &Client{address: recv.LocalAddr().(*net.UDPAddr)}
+	dg := &datagram{dest: client}
+	for i := 0; i < 3; i++ {
+		s.sendMessage(dg, NewOutgoingMsg(client, messages.HeartbeatMsgType, &messages.Heartbeat{Time: int64(i)}))
+	}
+	s.flush(dg)
+
+	buf := make([]byte, 1024)
+	recv.SetReadDeadline(time.Now().Add(time.Second))
+	n, err := recv.Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := buf[:n]
+	for i := 0; i < 3; i++ {
+		packet, ok := messages.NextPacket(data)
+		if !ok || packet.NetMsg.(*messages.Heartbeat).Time != int64(i) {
+			t.Fatalf("Expected heartbeat %d in the datagram.", i)
+		}
+		data = data[packet.Len():]
+	}
+	if len(data) != 0 {
+		t.Fatalf("Expected only 3 packets in the datagram, %d bytes left over.", len(data))
+	}
+
+	// Clients can pack their packets together too.
+	gamechan := make(chan GameMessage, 10)
+	client = &Client{
+		address:         &net.UDPAddr{},
+		FromNetwork:     NewDatagramQueue(0),
+		FromGameManager: make(chan InternalMessage, 10),
+		toGameManager:   gamechan,
+	}
+	client.out = newOutQueue(client, nil, DefaultOutQueueLimits())
+	go client.ProcessBytes(make(chan *Client, 1))
+	<-gamechan // Connected
+	login := messages.NewPacket(messages.LoginMsgType, &messages.Login{Name: "testuser", Password: "testpass"}).Pack()
+	client.FromNetwork.Push(append(append([]byte{}, login...), login...))
+	for i := 0; i < 2; i++ {
+		select {
+		case msg := <-gamechan:
+			if msg.mtype != messages.LoginMsgType {
+				t.Fatalf("Expected login, got message type %d", msg.mtype)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("Only got %d of 2 logins from the datagram.", i)
+		}
+	}
+	client.FromNetwork.Close()
+}
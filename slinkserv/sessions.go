@@ -0,0 +1,105 @@
+package slinkserv
+
+import (
+	"crypto/rand"
+	"sync"
+	"time"
+)
+
+// sessionTokenLen is the number of random bytes in a session token.
+const sessionTokenLen = 16
+
+type session struct {
+	client *Client
+	lostAt time.Time // When the client stopped responding, zero while it is connected.
+}
+
+// sessionTable maps session tokens to clients so a player can pick their Client back up
+// from a new address. Tokens are issued by the GameManager on login and used by the
+// Server when a reconnecting client presents one, so all access is locked.
+type sessionTable struct {
+	mu       sync.Mutex
+	grace    time.Duration
+	byToken  map[string]*session
+	byClient map[uint32]string
+}
+
+func newSessionTable(grace time.Duration) *sessionTable {
+	return &sessionTable{
+		grace:    grace,
+		byToken:  map[string]*session{},
+		byClient: map[uint32]string{},
+	}
+}
+
+// issue creates a new token for the client, replacing any token it had before.
+func (st *sessionTable) issue(client *Client) []byte {
+	token := make([]byte, sessionTokenLen)
+	if _, err := rand.Read(token); err != nil {
+		panic("unable to generate session token: " + err.Error())
+	}
+
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if old, ok := st.byClient[client.ID]; ok {
+		delete(st.byToken, old)
+	}
+	st.byToken[string(token)] = &session{client: client}
+	st.byClient[client.ID] = string(token)
+	return token
+}
+
+// lost marks the client's session as lost, starting its grace window.
+// Returns false if the client has no session to resume.
+func (st *sessionTable) lost(clientID uint32, now time.Time) bool {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	token, ok := st.byClient[clientID]
+	if !ok {
+		return false
+	}
+	st.byToken[token].lostAt = now
+	return true
+}
+
+// resume finds the client for a token whose connection was lost within the grace window,
+// and makes the session live again if proven accepts the client. Returns nil if the token is
+// unknown, has expired, belongs to a client that is still connected or isn't proven.
+func (st *sessionTable) resume(token []byte, now time.Time, proven func(*Client) bool) *Client {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	sess, ok := st.byToken[string(token)]
+	if !ok || sess.lostAt.IsZero() || now.Sub(sess.lostAt) > st.grace || !proven(sess.client) {
+		return nil
+	}
+	sess.lostAt = time.Time{}
+	return sess.client
+}
+
+// expire removes the client's session if it was lost longer than the grace window ago.
+// Returns true if it was removed and the client is gone for good.
+func (st *sessionTable) expire(clientID uint32, now time.Time) bool {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	token, ok := st.byClient[clientID]
+	if !ok {
+		return true
+	}
+	sess := st.byToken[token]
+	if sess.lostAt.IsZero() || now.Sub(sess.lostAt) < st.grace {
+		return false
+	}
+	delete(st.byToken, token)
+	delete(st.byClient, clientID)
+	return true
+}
+
+// remove drops the client's session, if it has one.
+func (st *sessionTable) remove(clientID uint32) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if token, ok := st.byClient[clientID]; ok {
+		delete(st.byToken, token)
+		delete(st.byClient, clientID)
+	}
+}
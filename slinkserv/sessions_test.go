@@ -0,0 +1,56 @@
+package slinkserv
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSessionTable(t *testing.T) {
+	grace := 10 * time.Second
+	st := newSessionTable(grace)
+	client := &Client{ID: 1}
+	token := st.issue(client)
+	now := time.Now()
+	proven := func(*Client) bool { return true }
+
+	if c := st.resume(token, now, proven); c != nil {
+		t.Fatalf("A session that is still connected should not be taken over.")
+	}
+	if c := st.resume([]byte("not a real token"), now, proven); c != nil {
+		t.Fatalf("Unknown token should not resume.")
+	}
+	if st.lost(2, now) {
+		t.Fatalf("Client without a session can't be lost.")
+	}
+
+	if !st.lost(client.ID, now) {
+		t.Fatalf("Client with a session should be marked lost.")
+	}
+	if st.expire(client.ID, now.Add(grace/2)) {
+		t.Fatalf("Session should not expire inside the grace window.")
+	}
+	if c := st.resume(token, now.Add(grace/2), func(*Client) bool { return false }); c != nil {
+		t.Fatalf("Lost client should not resume without proof it owns the session.")
+	}
+	if c := st.resume(token, now.Add(grace/2), proven); c != client {
+		t.Fatalf("Lost client should resume inside the grace window.")
+	}
+	if st.expire(client.ID, now.Add(grace*2)) {
+		t.Fatalf("Resumed session should not expire.")
+	}
+
+	st.lost(client.ID, now)
+	if !st.expire(client.ID, now.Add(grace)) {
+		t.Fatalf("Session should expire after the grace window.")
+	}
+	if c := st.resume(token, now, proven); c != nil {
+		t.Fatalf("Expired session should not resume.")
+	}
+
+	old := st.issue(client)
+	st.issue(client)
+	st.lost(client.ID, now)
+	if c := st.resume(old, now, proven); c != nil {
+		t.Fatalf("Reissuing a token should invalidate the old one.")
+	}
+}
@@ -0,0 +1,189 @@
+package slinkserv
+
+import (
+	"sort"
+
+	"github.com/lologarithm/slink/slinkserv/messages"
+	"github.com/lologarithm/survival/physics"
+	"github.com/lologarithm/survival/physics/quadtree"
+)
+
+// spectateRadius is how far from the snake they are watching spectators are sent food.
+// Snakes are always sent, the area only limits food since that is most of the world.
+const spectateRadius = 5000
+
+// areaBatch is how much food goes in each AreaFood message.
+const areaBatch = 100
+
+// addSpectator lets a client watch the game without a snake, following the first snake.
+// They get the same game state as players, with the food around that snake.
+func (g *GameSession) addSpectator(ap AddPlayer) {
+	user := &User{
+		Account:    ap.Account,
+		GameID:     g.ID,
+		Client:     ap.Client,
+		Name:       ap.Entity.Name,
+		Spectator:  true,
+		Watching:   g.nextSnake(0),
+		mutedUntil: ap.MutedUntil,
+	}
+	if snake := g.World.Snakes[user.Watching]; snake != nil {
+		user.area, user.hasArea = snake.Position, true
+	}
+	g.Spectators[ap.Client.ID] = user
+	g.sendGameConnected(ap.Client, 0)
+	user.Client.send(messages.SpectatingMsgType, &messages.Spectating{SnakeID: user.Watching})
+}
+
+// user returns a player or spectator in this game, nil if the client isn't here.
+func (g *GameSession) user(clientID uint32) *User {
+	if user := g.Clients[clientID]; user != nil {
+		return user
+	}
+	return g.Spectators[clientID]
+}
+
+// nextSnake returns the snake after the one given, in ID order, wrapping around to the first.
+// Returns 0 if there are no snakes.
+func (g *GameSession) nextSnake(after uint32) uint32 {
+	ids := make([]uint32, 0, len(g.World.Snakes))
+	for id := range g.World.Snakes {
+		ids = append(ids, id)
+	}
+	if len(ids) == 0 {
+		return 0
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	for _, id := range ids {
+		if id > after {
+			return id
+		}
+	}
+	return ids[0]
+}
+
+// handleSpectate points a spectator's camera at the snake they asked for, or the next one if they didn't say.
+func (g *GameSession) handleSpectate(clientID uint32, sp *messages.Spectate) {
+	user := g.Spectators[clientID]
+	if user == nil {
+		return
+	}
+	target := sp.SnakeID
+	if g.World.Snakes[target] == nil {
+		target = g.nextSnake(user.Watching)
+	}
+	g.follow(user, target)
+}
+
+// follow moves a spectator's camera to a snake and sends them the food around it.
+func (g *GameSession) follow(user *User, snakeID uint32) {
+	user.Watching = snakeID
+	user.Client.send(messages.SpectatingMsgType, &messages.Spectating{SnakeID: snakeID})
+	g.sendArea(user)
+}
+
+// areaBox is the part of the world a spectator with an area centered on center is sent food for.
+func areaBox(center physics.Vect2) quadtree.BoundingBox {
+	return quadtree.BoundingBox{
+		MinX: center.X - spectateRadius,
+		MinY: center.Y - spectateRadius,
+		MaxX: center.X + spectateRadius,
+		MaxY: center.Y + spectateRadius,
+	}
+}
+
+func inAreaBox(center, pos physics.Vect2) bool {
+	dx, dy := pos.X-center.X, pos.Y-center.Y
+	return dx >= -spectateRadius && dx <= spectateRadius && dy >= -spectateRadius && dy <= spectateRadius
+}
+
+// areaFood returns the food around center.
+func (g *GameSession) areaFood(center physics.Vect2) []*messages.Entity {
+	var food []*messages.Entity
+	for _, b := range g.World.Tree.Query(areaBox(center)) {
+		if e := b.(*Entity); e.EType == ETypeFood {
+			food = append(food, e.toMsg())
+		}
+	}
+	return food
+}
+
+// sendArea moves a spectator's area to the snake they are watching. They already have the
+// food in their old area, so only food that wasn't in it is sent, a batch at a time.
+// Like spawns it goes out as cosmetic, the next master frame has anything that gets dropped.
+func (g *GameSession) sendArea(user *User) {
+	snake := g.World.Snakes[user.Watching]
+	if snake == nil {
+		return
+	}
+	old, hadArea := user.area, user.hasArea
+	user.area, user.hasArea = snake.Position, true
+	var food []*messages.Entity
+	for _, e := range g.areaFood(user.area) {
+		if !hadArea || !inAreaBox(old, physics.Vect2{X: e.X, Y: e.Y}) {
+			food = append(food, e)
+		}
+	}
+	for len(food) > 0 {
+		n := len(food)
+		if n > areaBatch {
+			n = areaBatch
+		}
+		msg := NewOutgoingMsg(user.Client, messages.AreaFoodMsgType, &messages.AreaFood{Food: food[:n]})
+		msg.priority = PriorityCosmetic
+		user.Client.queue(msg)
+		food = food[n:]
+	}
+}
+
+// inArea reports whether pos is in the area a spectator gets food updates for.
+func (user *User) inArea(pos physics.Vect2) bool {
+	return user.hasArea && inAreaBox(user.area, pos)
+}
+
+// spectatorEntities is what a spectator is sent instead of the world's entities: everything but
+// food, like players get, plus the food in their area.
+func (g *GameSession) spectatorEntities(user *User) []*messages.Entity {
+	ents := g.World.EntitiesMsg()
+	if user.hasArea {
+		ents = append(ents, g.areaFood(user.area)...)
+	}
+	return ents
+}
+
+// updateSpectators moves spectators on when the snake they are watching is gone, and
+// moves their area along once their snake has wandered away from its center.
+func (g *GameSession) updateSpectators() {
+	for _, user := range g.Spectators {
+		if user.Lost {
+			continue
+		}
+		snake := g.World.Snakes[user.Watching]
+		if snake == nil {
+			if next := g.nextSnake(user.Watching); next != 0 || user.Watching != 0 {
+				g.follow(user, next)
+			}
+			continue
+		}
+		// Move the area once the snake is more than half way to its edge.
+		dx, dy := int64(snake.Position.X-user.area.X), int64(snake.Position.Y-user.area.Y)
+		if dx*dx+dy*dy > spectateRadius*spectateRadius/4 {
+			g.sendArea(user)
+		}
+	}
+}
+
+// sendNear sends a message about something at pos to every player, and to the spectators watching near it.
+func (g *GameSession) sendNear(msg OutgoingMessage, pos physics.Vect2) {
+	msg.data = msg.msg.Pack()
+	for _, c := range g.Clients {
+		if !c.Lost {
+			c.Client.queue(msg)
+		}
+	}
+	for _, c := range g.Spectators {
+		if !c.Lost && c.inArea(pos) {
+			c.Client.queue(msg)
+		}
+	}
+}
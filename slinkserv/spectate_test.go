@@ -0,0 +1,204 @@
+package slinkserv
+
+import (
+	"testing"
+	"time"
+
+	"github.com/lologarithm/slink/slinkserv/messages"
+	"github.com/lologarithm/survival/physics"
+)
+
+func TestSpectate(t *testing.T) {
+	g := NewGame(make(chan GameMessage, 100))
+	_, clients := newTestManager(DefaultConfig(), 3)
+	for id := 1; id <= 2; id++ {
+		g.addPlayer(AddPlayer{Entity: &Entity{Name: "snake"}, Client: clients[id]})
+		clients[id].out.pop() // GameConnected
+	}
+	first, second := g.Clients[1].SnakeID, g.Clients[2].SnakeID
+	g.World.Snakes[first].Position = physics.Vect2{X: 0, Y: 0}
+	g.World.Snakes[second].Position = physics.Vect2{X: 100000, Y: 0}
+	g.addEntity(5000, ETypeFood, physics.Vect2{X: 100, Y: 100}, 50)
+	g.addEntity(5002, ETypeFood, physics.Vect2{X: 50000, Y: 0}, 50)
+
+	foodIn := func(ents []*messages.Entity) map[uint32]bool {
+		food := map[uint32]bool{}
+		for _, e := range ents {
+			if e.EType == ETypeFood {
+				food[e.ID] = true
+			}
+		}
+		return food
+	}
+	expectFood := func(got map[uint32]bool, want ...uint32) {
+		if len(got) != len(want) {
+			t.Fatalf("Expected food %v, got %v", want, got)
+		}
+		for _, id := range want {
+			if !got[id] {
+				t.Fatalf("Expected food %v, got %v", want, got)
+			}
+		}
+	}
+	// areaFood reads the AreaFood batches waiting for the spectator, returning the food and how many batches it came in.
+	areaFood := func() (map[uint32]bool, int) {
+		food, batches := map[uint32]bool{}, 0
+		for {
+			msg, ok := clients[3].out.pop()
+			if !ok {
+				return food, batches
+			}
+			af, ok := msg.msg.NetMsg.(*messages.AreaFood)
+			if !ok {
+				t.Fatalf("Expected only area food, got %v", msg.msg.NetMsg)
+			}
+			for id := range foodIn(af.Food) {
+				food[id] = true
+			}
+			batches++
+		}
+	}
+	expectWatching := func(snakeID uint32, food ...uint32) int {
+		msg, _ := clients[3].out.pop()
+		if sp, ok := msg.msg.NetMsg.(*messages.Spectating); !ok || sp.SnakeID != snakeID {
+			t.Fatalf("Expected to be watching snake %d, got %v", snakeID, msg.msg.NetMsg)
+		}
+		got, batches := areaFood()
+		expectFood(got, food...)
+		return batches
+	}
+
+	g.addPlayer(AddPlayer{Entity: &Entity{Name: "watcher"}, Client: clients[3], Spectate: true})
+	if len(g.Clients) != 2 || len(g.World.Snakes) != 2 {
+		t.Fatalf("Expected a spectator not to get a snake.")
+	}
+	msg, _ := clients[3].out.pop()
+	gc := msg.msg.NetMsg.(*messages.GameConnected)
+	if gc.SnakeID != 0 || len(gc.Snakes) != 2 {
+		t.Fatalf("Expected the spectator to be connected without a snake.")
+	}
+	// The food around the snake they start watching comes with the game, and nothing else.
+	expectFood(foodIn(gc.Entities), 5000)
+	expectWatching(first)
+
+	// Food is only sent to spectators near the snake they are watching, players get all of it.
+	g.addEntity(5001, ETypeFood, physics.Vect2{X: 1000, Y: -1000}, 50)
+	g.addEntity(5003, ETypeFood, physics.Vect2{X: 60000, Y: 0}, 50)
+	g.sendSpawns([]*messages.UpdateEntity{
+		{Ent: g.World.Entities[5001].toMsg()},
+		{Ent: g.World.Entities[5003].toMsg()},
+	})
+	if msg, _ := clients[3].out.pop(); msg.msg.NetMsg.(*messages.UpdateEntity).Ent.ID != 5001 {
+		t.Fatalf("Expected the spectator to get the food near their snake.")
+	}
+	if _, ok := clients[3].out.pop(); ok {
+		t.Fatalf("Expected food away from the spectated snake not to be sent.")
+	}
+	for i := 0; i < 2; i++ {
+		if _, ok := clients[1].out.pop(); !ok {
+			t.Fatalf("Expected players to get every spawn.")
+		}
+	}
+
+	g.handleSpectate(3, &messages.Spectate{})
+	expectWatching(second)
+	g.handleSpectate(3, &messages.Spectate{})
+	expectWatching(first, 5000, 5001) // Wraps around, with the food spawned since.
+	g.handleSpectate(3, &messages.Spectate{SnakeID: second})
+	expectWatching(second)
+
+	// As the snake moves only food that wasn't already in the area is sent.
+	g.addEntity(5004, ETypeFood, physics.Vect2{X: 104000, Y: 0}, 50)
+	g.addEntity(5005, ETypeFood, physics.Vect2{X: 108000, Y: 0}, 50)
+	g.World.Snakes[second].Position = physics.Vect2{X: 104000, Y: 0}
+	g.updateSpectators()
+	got, _ := areaFood()
+	expectFood(got, 5005)
+
+	// Spectators may still have food from an area they've left, so they hear about all of it being eaten.
+	g.sendEat(g.World.Snakes[first], g.World.Entities[5001])
+	if msg, _ := clients[3].out.pop(); msg.msg.NetMsg.(*messages.RemoveEntity).Ent.ID != 5001 {
+		t.Fatalf("Expected the spectator to be told about food eaten away from their area.")
+	}
+	clients[3].out.pop() // The snake that ate it grew.
+
+	// Master frames carry the food in a spectator's area, players get it as it spawns.
+	g.SendMasterFrame()
+	msg, _ = clients[3].out.pop()
+	expectFood(foodIn(msg.msg.NetMsg.(*messages.GameMasterFrame).Entities), 5004, 5005)
+	for {
+		msg, ok := clients[1].out.pop()
+		if !ok {
+			t.Fatalf("Expected players to get the master frame.")
+		}
+		if mf, ok := msg.msg.NetMsg.(*messages.GameMasterFrame); ok {
+			expectFood(foodIn(mf.Entities))
+			break
+		}
+	}
+
+	// The camera moves on when the snake it follows is gone, with lots of food sent in a few batches.
+	want := []uint32{5000, 5001}
+	for i := 0; i < 2*areaBatch; i++ {
+		g.addEntity(uint32(6000+i), ETypeFood, physics.Vect2{X: int32(i), Y: 200}, 50)
+		want = append(want, uint32(6000+i))
+	}
+	g.removeSnake(g.World.Snakes[second])
+	g.updateSpectators()
+	if batches := expectWatching(first, want...); batches != 3 {
+		t.Fatalf("Expected the food in 3 batches, got %d", batches)
+	}
+	if g.Clients[3] != nil || g.Spectators[3] == nil {
+		t.Fatalf("Expected the spectator to be kept apart from players.")
+	}
+}
+
+func TestSpectateJoin(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.MaxPlayers = 1
+	cfg.GameIdleTimeout = time.Minute
+	gm, clients := newTestManager(cfg, 3)
+	defer func() {
+		for _, g := range gm.Games {
+			g.Exit <- 1
+		}
+	}()
+	watch := func(id int) *messages.JoinGameFailed {
+		gm.joinGame(GameMessage{client: clients[id], net: &messages.JoinGame{Spectate: 1}})
+		// The game runs on its own, so anything else it has sent is skipped.
+		for {
+			msg, ok := clients[id].out.pop()
+			if !ok {
+				return nil
+			}
+			if failed, ok := msg.msg.NetMsg.(*messages.JoinGameFailed); ok {
+				return failed
+			}
+		}
+	}
+	if failed := watch(1); failed == nil || len(gm.Games) != 0 {
+		t.Fatalf("Expected no game to be started just to watch.")
+	}
+
+	gm.joinGame(GameMessage{client: clients[2], net: &messages.JoinGame{}})
+	<-clients[2].FromGameManager
+	// The only game is full, but there is always room to watch.
+	if failed := watch(3); failed != nil {
+		t.Fatalf("Expected to watch a full game, got: %s", failed.Reason)
+	}
+	if cg := (<-clients[3].FromGameManager).(ConnectedGame); cg.ID != 1 || gm.players[1] != 1 || gm.spectators[1] != 1 {
+		t.Fatalf("Expected the spectator in game 1 without taking a spot.")
+	}
+
+	// A game everyone has left is kept going while someone watches it.
+	gm.handleDisconnect(GameMessage{client: clients[2]})
+	gm.closeIdleGames(time.Now().UTC().Add(time.Hour))
+	if gm.Games[1] == nil {
+		t.Fatalf("Expected a game with spectators not to be shut down.")
+	}
+	gm.handleDisconnect(GameMessage{client: clients[3]})
+	gm.closeIdleGames(time.Now().UTC().Add(time.Hour))
+	if len(gm.Games) != 0 {
+		t.Fatalf("Expected the game to close once nobody was watching.")
+	}
+}
@@ -0,0 +1,150 @@
+package slinkserv
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/lologarithm/slink/slinkserv/messages"
+)
+
+// rttWindow is how many round trip samples the min, max and jitter are taken over.
+const rttWindow = 16
+
+// ClientStats is a snapshot of the quality of a client's connection.
+type ClientStats struct {
+	Latency int64 // Average round trip in milliseconds.
+	RTTMin  int64 // Shortest round trip in the recent window, in milliseconds.
+	RTTMax  int64 // Longest round trip in the recent window, in milliseconds.
+	Jitter  int64 // Average change between consecutive round trips, in milliseconds.
+
+	LossIn  float64 // Fraction of packets from the client that never made it to the server.
+	LossOut float64 // Fraction of packets from the server that never made it to the client, as reported by the client.
+
+	BytesInPerSec  float64
+	BytesOutPerSec float64
+	FragmentsIn    uint64 // Multipart fragments received from the client.
+	FragmentsOut   uint64 // Multipart fragments sent to the client.
+}
+
+// connStats collects the numbers behind ClientStats. Byte and fragment counts are
+// updated atomically by the network goroutines, everything else is behind mu.
+type connStats struct {
+	bytesIn      uint64
+	bytesOut     uint64
+	fragmentsIn  uint64
+	fragmentsOut uint64
+
+	mu      sync.Mutex
+	rtt     [rttWindow]int64
+	rttN    int
+	inbound messages.SeqTracker // Seqs of packets from the client.
+	lossOut float64
+
+	// Totals at the last rate calculation.
+	rateAt                time.Time
+	rateIn, rateOut       uint64
+	bytesInPS, bytesOutPS float64
+}
+
+func (cs *connStats) addRTT(ms int64) {
+	cs.mu.Lock()
+	cs.rtt[cs.rttN%rttWindow] = ms
+	cs.rttN++
+	cs.mu.Unlock()
+}
+
+func (cs *connStats) trackSeq(seq uint16) {
+	cs.mu.Lock()
+	cs.inbound.Track(seq)
+	cs.mu.Unlock()
+}
+
+// clientReport takes the loss the client saw from its answer to a heartbeat.
+func (cs *connStats) clientReport(hb *messages.Heartbeat) {
+	total := hb.Received + hb.Lost
+	if total == 0 {
+		return
+	}
+	cs.mu.Lock()
+	cs.lossOut = float64(hb.Lost) / float64(total)
+	cs.mu.Unlock()
+}
+
+// updateRates works out bytes per second in each direction since the last update.
+func (cs *connStats) updateRates(now time.Time) {
+	in, out := atomic.LoadUint64(&cs.bytesIn), atomic.LoadUint64(&cs.bytesOut)
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	if elapsed := now.Sub(cs.rateAt).Seconds(); !cs.rateAt.IsZero() && elapsed > 0 {
+		cs.bytesInPS = float64(in-cs.rateIn) / elapsed
+		cs.bytesOutPS = float64(out-cs.rateOut) / elapsed
+	}
+	cs.rateAt, cs.rateIn, cs.rateOut = now, in, out
+}
+
+func (cs *connStats) snapshot(latency int64) ClientStats {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	stats := ClientStats{
+		Latency:        latency,
+		LossIn:         cs.inbound.LossRate(),
+		LossOut:        cs.lossOut,
+		BytesInPerSec:  cs.bytesInPS,
+		BytesOutPerSec: cs.bytesOutPS,
+		FragmentsIn:    atomic.LoadUint64(&cs.fragmentsIn),
+		FragmentsOut:   atomic.LoadUint64(&cs.fragmentsOut),
+	}
+	n := cs.rttN
+	if n > rttWindow {
+		n = rttWindow
+	}
+	// Walk the window oldest to newest so jitter compares neighbouring samples.
+	start := cs.rttN - n
+	for i := 0; i < n; i++ {
+		rtt := cs.rtt[(start+i)%rttWindow]
+		if i == 0 || rtt < stats.RTTMin {
+			stats.RTTMin = rtt
+		}
+		if rtt > stats.RTTMax {
+			stats.RTTMax = rtt
+		}
+		if i > 0 {
+			diff := rtt - cs.rtt[(start+i-1)%rttWindow]
+			if diff < 0 {
+				diff = -diff
+			}
+			stats.Jitter += diff
+		}
+	}
+	if n > 1 {
+		stats.Jitter /= int64(n - 1)
+	}
+	return stats
+}
+
+// Stats returns a snapshot of the client's connection quality.
+// Bytes per second are averaged over the time between the last two heartbeats.
+func (client *Client) Stats() ClientStats {
+	return client.stats.snapshot(atomic.LoadInt64(&client.latency))
+}
+
+// heartbeat builds the heartbeat sent to the client, carrying a summary of its stats
+// so the game can show how good the connection is. Loss is sent in tenths of a percent.
+func (client *Client) heartbeat() *messages.Heartbeat {
+	client.stats.updateRates(time.Now().UTC())
+	stats := client.Stats()
+	return &messages.Heartbeat{
+		Time:           time.Now().UTC().UnixNano(),
+		Latency:        stats.Latency,
+		RTTMin:         stats.RTTMin,
+		RTTMax:         stats.RTTMax,
+		Jitter:         stats.Jitter,
+		LossIn:         uint16(stats.LossIn * 1000),
+		LossOut:        uint16(stats.LossOut * 1000),
+		BytesInPerSec:  uint32(stats.BytesInPerSec),
+		BytesOutPerSec: uint32(stats.BytesOutPerSec),
+		FragmentsIn:    uint32(stats.FragmentsIn),
+		FragmentsOut:   uint32(stats.FragmentsOut),
+	}
+}
@@ -0,0 +1,33 @@
+package slinkserv
+
+import (
+	"testing"
+
+	"github.com/lologarithm/slink/slinkserv/messages"
+)
+
+func TestConnStats(t *testing.T) {
+	var cs connStats
+	for _, rtt := range []int64{40, 60, 50, 70} {
+		cs.addRTT(rtt)
+	}
+	// Packet 3 goes missing and 6 shows up late.
+	for _, seq := range []uint16{1, 2, 4, 5, 7, 6, 8} {
+		cs.trackSeq(seq)
+	}
+	cs.clientReport(&messages.Heartbeat{Received: 90, Lost: 10})
+
+	stats := cs.snapshot(55)
+	if stats.RTTMin != 40 || stats.RTTMax != 70 {
+		t.Fatalf("Expected RTT range 40-70, got %d-%d", stats.RTTMin, stats.RTTMax)
+	}
+	if stats.Jitter != 16 { // (20 + 10 + 20) / 3
+		t.Fatalf("Expected jitter of 16, got %d", stats.Jitter)
+	}
+	if stats.LossIn != 1.0/8 {
+		t.Fatalf("Expected 1 in 8 packets lost inbound, got %f", stats.LossIn)
+	}
+	if stats.LossOut != 0.1 {
+		t.Fatalf("Expected client reported loss of 0.1, got %f", stats.LossOut)
+	}
+}